@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/keyring"
+	"cryptobackup/pkg/storage"
+)
+
+// handleKey 处理 key 子命令：管理本地密钥环
+func handleKey(args []string) {
+	if len(args) < 1 {
+		printKeyUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "add":
+		cmd := flag.NewFlagSet("key add", flag.ExitOnError)
+		name := cmd.String("name", "", "密钥名称（必需）")
+		keyType := cmd.String("type", keyring.TypeSymmetric, "密钥类型 (symmetric|x25519|age|ed25519)，ed25519 为签名密钥")
+		secret := cmd.String("key", "", "导入已有的密钥（16进制，age 为 AGE-SECRET-KEY-1...），为空时生成新密钥")
+		mnemonic := cmd.String("mnemonic", "", "从助记词导入密钥（与 -key 二选一）")
+		size := cmd.Int("size", 32, "生成对称密钥的大小（字节）")
+		path := cmd.String("keyring", "", "密钥环文件路径（默认 $CRYPTOBACKUP_KEYRING 或 ~/.cryptobackup/keyring）")
+		cmd.Parse(args[1:])
+		if *name == "" {
+			fmt.Println("错误: key add 命令需要 -name 参数")
+			cmd.PrintDefaults()
+			os.Exit(1)
+		}
+		if *mnemonic != "" {
+			if *secret != "" {
+				fmt.Println("错误: -key 和 -mnemonic 只能指定一个")
+				os.Exit(1)
+			}
+			var err error
+			if *secret, err = keyring.SecretFromMnemonic(*mnemonic); err != nil {
+				fmt.Printf("助记词无效: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		handleKeyAdd(*path, *name, *keyType, *secret, *size)
+
+	case "list":
+		cmd := flag.NewFlagSet("key list", flag.ExitOnError)
+		path := cmd.String("keyring", "", "密钥环文件路径")
+		cmd.Parse(args[1:])
+		handleKeyList(*path)
+
+	case "remove":
+		cmd := flag.NewFlagSet("key remove", flag.ExitOnError)
+		name := cmd.String("name", "", "要删除的密钥名称或密钥ID（必需）")
+		path := cmd.String("keyring", "", "密钥环文件路径")
+		cmd.Parse(args[1:])
+		if *name == "" {
+			fmt.Println("错误: key remove 命令需要 -name 参数")
+			cmd.PrintDefaults()
+			os.Exit(1)
+		}
+		handleKeyRemove(*path, *name)
+
+	case "export":
+		cmd := flag.NewFlagSet("key export", flag.ExitOnError)
+		name := cmd.String("name", "", "要导出的密钥名称或密钥ID（必需）")
+		public := cmd.Bool("public", false, "只导出公钥（仅 x25519 和 age）")
+		format := cmd.String("format", "key", "导出格式 (key|mnemonic|sheet|html)，sheet 和 html 为用于纸质保存的恢复单")
+		path := cmd.String("keyring", "", "密钥环文件路径")
+		cmd.Parse(args[1:])
+		if *name == "" {
+			fmt.Println("错误: key export 命令需要 -name 参数")
+			cmd.PrintDefaults()
+			os.Exit(1)
+		}
+		handleKeyExport(*path, *name, *public, *format)
+
+	case "split":
+		cmd := flag.NewFlagSet("key split", flag.ExitOnError)
+		keyHex := cmd.String("key", "", "要拆分的密钥（16进制字符串）")
+		name := cmd.String("name", "", "拆分密钥环中的密钥（名称或ID），与 -key 二选一")
+		shares := cmd.Int("shares", 5, "份额数量")
+		threshold := cmd.Int("threshold", 3, "恢复密钥需要的份额数量")
+		mnemonic := cmd.Bool("mnemonic", false, "以助记词形式输出份额")
+		path := cmd.String("keyring", "", "密钥环文件路径")
+		cmd.Parse(args[1:])
+		if (*keyHex == "") == (*name == "") {
+			fmt.Println("错误: key split 命令需要 -key 或 -name 参数")
+			cmd.PrintDefaults()
+			os.Exit(1)
+		}
+		handleKeySplit(*path, *keyHex, *name, *shares, *threshold, *mnemonic)
+
+	case "combine":
+		cmd := flag.NewFlagSet("key combine", flag.ExitOnError)
+		name := cmd.String("name", "", "将恢复的密钥以此名称添加到密钥环，为空时直接输出密钥")
+		keyType := cmd.String("type", keyring.TypeSymmetric, "添加到密钥环时的密钥类型 (symmetric|x25519)")
+		path := cmd.String("keyring", "", "密钥环文件路径")
+		cmd.Parse(args[1:])
+		handleKeyCombine(*path, *name, *keyType, cmd.Args())
+
+	default:
+		fmt.Printf("未知的 key 子命令: %s\n", args[0])
+		printKeyUsage()
+		os.Exit(1)
+	}
+}
+
+func printKeyUsage() {
+	fmt.Print(`用法:
+  cryptobackup key <add|list|remove|export|split|combine> [options]
+
+子命令:
+  add       添加密钥（导入已有密钥或生成新密钥）
+  list      列出密钥
+  remove    删除密钥
+  export    导出密钥
+  split     将密钥拆分为多个份额（Shamir 秘密分享），任意 -threshold 个份额可以恢复密钥
+  combine   使用份额恢复密钥，份额作为参数提供或从标准输入逐行读取
+
+密钥环使用口令加密，口令从环境变量 CRYPTOBACKUP_KEYRING_PASSPHRASE 读取或在终端输入。
+`)
+}
+
+func handleKeyAdd(path, name, keyType, secret string, size int) {
+	generated := secret == ""
+	if generated {
+		var err error
+		if secret, err = generateSecret(keyType, size); err != nil {
+			fmt.Printf("生成密钥失败: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ring, err := openKeyring(path, true)
+	if err != nil {
+		fmt.Printf("打开密钥环失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	key, err := ring.Add(name, keyType, secret)
+	if err != nil {
+		fmt.Printf("添加密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ring.Save(); err != nil {
+		fmt.Printf("保存密钥环失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if generated {
+		fmt.Printf("✓ 已生成并添加密钥 %s（ID: %s）\n", key.Name, key.ID)
+	} else {
+		fmt.Printf("✓ 已添加密钥 %s（ID: %s）\n", key.Name, key.ID)
+	}
+	if key.Type == keyring.TypeEd25519 {
+		fmt.Printf("签名公钥（用于 verify -pubkey）: %s\n", key.Public)
+	} else if key.Public != "" {
+		fmt.Printf("公钥（用于 -recipient）: %s\n", key.Public)
+	}
+}
+
+func handleKeyList(path string) {
+	ring, err := openKeyring(path, false)
+	if err != nil {
+		fmt.Printf("打开密钥环失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	keys := ring.Keys()
+	if len(keys) == 0 {
+		fmt.Println("密钥环为空")
+		return
+	}
+
+	fmt.Printf("%-20s %-10s %-16s %s\n", "名称", "类型", "ID", "添加时间")
+	fmt.Println("----------------------------------------------------------------")
+	for _, key := range keys {
+		fmt.Printf("%-20s %-10s %-16s %s\n", key.Name, key.Type, key.ID, key.Created.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+func handleKeyRemove(path, name string) {
+	ring, err := openKeyring(path, false)
+	if err != nil {
+		fmt.Printf("打开密钥环失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	key, err := ring.Remove(name)
+	if err != nil {
+		fmt.Printf("删除密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ring.Save(); err != nil {
+		fmt.Printf("保存密钥环失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ 已删除密钥 %s（ID: %s）\n", key.Name, key.ID)
+	fmt.Println("使用该密钥加密的文件需要其他副本才能解密！")
+}
+
+func handleKeyExport(path, name string, public bool, format string) {
+	ring, err := openKeyring(path, false)
+	if err != nil {
+		fmt.Printf("打开密钥环失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	key, err := ring.Get(name)
+	if err != nil {
+		fmt.Printf("导出密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if public {
+		if key.Public == "" {
+			fmt.Printf("密钥 %s 是对称密钥，没有公钥\n", key.Name)
+			os.Exit(1)
+		}
+		fmt.Println(key.Public)
+		return
+	}
+
+	switch format {
+	case "key":
+		fmt.Println(key.Secret)
+	case "mnemonic":
+		mnemonic, err := key.Mnemonic()
+		if err != nil {
+			fmt.Printf("无法生成助记词: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(mnemonic)
+	case "sheet":
+		fmt.Print(keyring.NewRecoverySheet(key).Text())
+	case "html":
+		if err := keyring.NewRecoverySheet(key).WriteHTML(os.Stdout); err != nil {
+			fmt.Printf("生成恢复单失败: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("不支持的导出格式: %s\n", format)
+		os.Exit(1)
+	}
+}
+
+// exportGeneratedKey 按 genkey 的选项输出新密钥的助记词和恢复单
+func exportGeneratedKey(keyType, secret string, opts genkeyOptions) {
+	if !opts.mnemonic && opts.sheetPath == "" {
+		return
+	}
+	key, err := keyring.NewKey("", keyType, secret)
+	if err != nil {
+		fmt.Printf("生成恢复信息失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if opts.mnemonic {
+		if mnemonic, err := key.Mnemonic(); err != nil {
+			fmt.Printf("\n无法生成助记词: %v\n", err)
+		} else {
+			fmt.Printf("\n助记词（可使用 key add -mnemonic 导入）:\n%s\n", mnemonic)
+		}
+	}
+	if opts.sheetPath != "" {
+		if err := writeRecoverySheet(opts.sheetPath, key); err != nil {
+			fmt.Printf("写入恢复单失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\n恢复单已写入 %s，打印后请删除该文件\n", opts.sheetPath)
+	}
+}
+
+// writeRecoverySheet 将恢复单写入文件，扩展名为 .html 或 .htm 时输出网页，否则输出纯文本
+func writeRecoverySheet(path string, key *keyring.Key) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	sheet := keyring.NewRecoverySheet(key)
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".html" || ext == ".htm" {
+		err = sheet.WriteHTML(f)
+	} else {
+		_, err = f.WriteString(sheet.Text())
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func handleKeySplit(path, keyHex, name string, shares, threshold int, mnemonic bool) {
+	if name != "" {
+		ring, err := openKeyring(path, false)
+		if err != nil {
+			fmt.Printf("打开密钥环失败: %v\n", err)
+			os.Exit(1)
+		}
+		key, err := ring.Get(name)
+		if err != nil {
+			fmt.Printf("读取密钥失败: %v\n", err)
+			os.Exit(1)
+		}
+		if key.Type == keyring.TypeAge {
+			fmt.Println("age 密钥不是16进制格式，无法拆分")
+			os.Exit(1)
+		}
+		keyHex = key.Secret
+	}
+
+	secret, err := hex.DecodeString(keyHex)
+	if err != nil {
+		fmt.Printf("无效的密钥格式，必须是16进制字符串: %v\n", err)
+		os.Exit(1)
+	}
+	if err := printShares(secret, shares, threshold, mnemonic); err != nil {
+		fmt.Printf("拆分密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func handleKeyCombine(path, name, keyType string, args []string) {
+	shares, err := readShares(args)
+	if err != nil {
+		fmt.Printf("读取份额失败: %v\n", err)
+		os.Exit(1)
+	}
+	secret, err := crypto.CombineShares(shares)
+	if err != nil {
+		fmt.Printf("恢复密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+	keyHex := hex.EncodeToString(secret)
+
+	if name == "" {
+		fmt.Printf("恢复的密钥 (%d 字节):\n%s\n", len(secret), keyHex)
+		fmt.Printf("\n密钥指纹: %s\n", crypto.FingerprintString(secret))
+		fmt.Println("请确认指纹与拆分时记录的一致，份额来自不同的拆分时会得到错误的密钥")
+		return
+	}
+
+	ring, err := openKeyring(path, true)
+	if err != nil {
+		fmt.Printf("打开密钥环失败: %v\n", err)
+		os.Exit(1)
+	}
+	key, err := ring.Add(name, keyType, keyHex)
+	if err != nil {
+		fmt.Printf("添加密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ring.Save(); err != nil {
+		fmt.Printf("保存密钥环失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ 已恢复并添加密钥 %s（ID: %s）\n", key.Name, key.ID)
+	if key.Public != "" {
+		fmt.Printf("公钥: %s\n", key.Public)
+	}
+	fmt.Printf("密钥指纹: %s\n", crypto.FingerprintString(secret))
+	fmt.Println("请确认指纹与拆分时记录的一致，份额来自不同的拆分时会得到错误的密钥")
+}
+
+// printShares 拆分密钥并输出份额和密钥指纹，不输出密钥本身
+func printShares(secret []byte, n, threshold int, mnemonic bool) error {
+	shares, err := crypto.SplitSecret(secret, n, threshold)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("密钥已拆分为 %d 个份额，任意 %d 个可以恢复密钥\n", n, threshold)
+	fmt.Printf("密钥指纹: %s（恢复后用于核对）\n", crypto.FingerprintString(secret))
+	for _, share := range shares {
+		text := share.String()
+		if mnemonic {
+			if text, err = share.Mnemonic(); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("\n份额 %d/%d:\n%s\n", share.Index, n, text)
+	}
+	fmt.Println("\n请将每个份额分别交给不同的保管人，恢复时使用 cryptobackup key combine")
+	return nil
+}
+
+// readShares 解析参数中的份额，没有参数时从标准输入逐行读取，直到份额数量达到门限或输入结束
+func readShares(args []string) ([]crypto.Share, error) {
+	var shares []crypto.Share
+	for _, arg := range args {
+		share, err := crypto.ParseShare(arg)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	if len(args) > 0 {
+		return shares, nil
+	}
+
+	fmt.Fprintln(os.Stderr, "请输入份额（文本或助记词），每行一个，输入空行结束:")
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			break
+		}
+		share, err := crypto.ParseShare(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "份额无效，请重新输入: %v\n", err)
+			continue
+		}
+		shares = append(shares, share)
+		if len(shares) >= share.Threshold {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// generateSecret 生成指定类型的新密钥
+func generateSecret(keyType string, size int) (string, error) {
+	switch keyType {
+	case keyring.TypeSymmetric:
+		if size <= 0 || size > 64 {
+			return "", fmt.Errorf("密钥大小必须在 1 到 64 字节之间")
+		}
+		key := make([]byte, size)
+		if _, err := rand.Read(key); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(key), nil
+	case keyring.TypeX25519:
+		priv, _, err := crypto.GenerateX25519KeyPair()
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(priv), nil
+	case keyring.TypeAge:
+		identity, _, err := crypto.GenerateAgeIdentity()
+		return identity, err
+	case keyring.TypeEd25519:
+		seed, _, err := crypto.GenerateSigningKeyPair()
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(seed), nil
+	default:
+		return "", fmt.Errorf("不支持的密钥类型: %s", keyType)
+	}
+}
+
+// openKeyring 打开密钥环，create 为 true 且文件不存在时创建新的密钥环（需要确认口令）
+func openKeyring(path string, create bool) (*keyring.Keyring, error) {
+	if path == "" {
+		var err error
+		if path, err = keyring.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	exists := keyring.Exists(path)
+	if !exists && !create {
+		return nil, fmt.Errorf("密钥环 %s 不存在，请先使用 key add 添加密钥", path)
+	}
+
+	prompt := "请输入密钥环口令"
+	if !exists {
+		prompt = "请设置新密钥环的口令"
+	}
+	passphrase, err := readPassphraseFrom("CRYPTOBACKUP_KEYRING_PASSPHRASE", prompt, !exists)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Open(path, passphrase)
+}
+
+// useKeyringKey 使用密钥环中的密钥填充命令行的密钥参数
+// 加密时非对称密钥使用公钥，解密时使用私钥
+func useKeyringKey(keys keyOptions, key *keyring.Key, encrypt bool) keyOptions {
+	keys.keyID = key.ID
+	keys.usePassphrase = false
+	switch {
+	case key.Type == keyring.TypeSymmetric:
+		keys.keyHex = key.Secret
+	case encrypt:
+		keys.recipients = key.Public
+	default:
+		keys.keyHex = key.Secret
+	}
+	return keys
+}
+
+// loadKeyringKey 从密钥环中取出 -key-name 指定的密钥
+func loadKeyringKey(keys keyOptions, encrypt bool) (keyOptions, error) {
+	ring, err := openKeyring(keys.keyringPath, false)
+	if err != nil {
+		return keys, err
+	}
+	key, err := ring.Get(keys.keyName)
+	if err != nil {
+		return keys, err
+	}
+	if key.Type == keyring.TypeEd25519 {
+		return keys, fmt.Errorf("%s 是签名密钥，不能用于加密，请使用 -sign-key-name", key.Name)
+	}
+	return useKeyringKey(keys, key, encrypt), nil
+}
+
+// resolveSigningKey 返回签名私钥（16进制），依次使用 -sign-key、-sign-key-name 和环境变量 CRYPTOBACKUP_SIGN_KEY
+// 都未提供时返回空字符串，表示不签名
+func resolveSigningKey(keyHex, keyName, keyringPath string) (string, error) {
+	if keyHex != "" {
+		return keyHex, nil
+	}
+	if keyName == "" {
+		return os.Getenv("CRYPTOBACKUP_SIGN_KEY"), nil
+	}
+
+	ring, err := openKeyring(keyringPath, false)
+	if err != nil {
+		return "", err
+	}
+	key, err := ring.Get(keyName)
+	if err != nil {
+		return "", err
+	}
+	if key.Type != keyring.TypeEd25519 {
+		return "", fmt.Errorf("%s 不是签名密钥（类型为 %s）", key.Name, key.Type)
+	}
+	return key.Secret, nil
+}
+
+// pickKeyringKey 根据远程文件的元数据从密钥环中选择解密密钥
+// 使用加密文件名时存储路径由密钥派生，依次尝试密钥环中的对称密钥
+func pickKeyringKey(store storage.Storage, remotePath string, keys keyOptions) (keyOptions, error) {
+	ring, err := openKeyring(keys.keyringPath, false)
+	if err != nil {
+		return keys, err
+	}
+
+	ctx := context.Background()
+	if keys.encryptNames {
+		for _, key := range ring.Keys() {
+			if key.Type != keyring.TypeSymmetric {
+				continue
+			}
+			names, err := createNameCipher(store, key.Secret, "")
+			if err != nil {
+				continue
+			}
+			storagePath, err := names.EncryptPath(remotePath)
+			if err != nil {
+				continue
+			}
+			if _, err := store.GetMetadata(ctx, storagePath); err == nil {
+				return useKeyringKey(keys, key, false), nil
+			}
+		}
+		return keys, fmt.Errorf("密钥环中没有与 %s 匹配的密钥", remotePath)
+	}
+
+	metadata, err := store.GetMetadata(ctx, remotePath)
+	if err != nil {
+		return keys, fmt.Errorf("获取元数据失败: %w", err)
+	}
+	key, err := ring.Match(metadata)
+	if err != nil {
+		return keys, fmt.Errorf("密钥环中没有与 %s 匹配的密钥", remotePath)
+	}
+	return useKeyringKey(keys, key, false), nil
+}
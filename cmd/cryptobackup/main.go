@@ -8,13 +8,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/keyring"
 	"cryptobackup/pkg/storage"
 	"cryptobackup/pkg/uploader"
 	"cryptobackup/pkg/web"
 
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
 )
 
 const (
@@ -29,41 +32,107 @@ func main() {
 	deleteCmd := flag.NewFlagSet("delete", flag.ExitOnError)
 	infoCmd := flag.NewFlagSet("info", flag.ExitOnError)
 	genkeyCmd := flag.NewFlagSet("genkey", flag.ExitOnError)
+	rekeyCmd := flag.NewFlagSet("rekey", flag.ExitOnError)
+	migrateCmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
 	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
 
 	// upload 命令参数
 	uploadFile := uploadCmd.String("file", "", "要上传的本地文件路径")
 	uploadRemote := uploadCmd.String("remote", "", "远程文件路径")
-	uploadAlgo := uploadCmd.String("algo", "aes", "加密算法 (aes|xor)")
+	uploadAlgo := uploadCmd.String("algo", "aes", "加密算法 (aes|chacha|x25519|age|plugin:<name>)，xor 需要同时指定 -insecure")
 	uploadKey := uploadCmd.String("key", "", "加密密钥（16进制字符串）")
-	uploadStorage := uploadCmd.String("storage", "./backup", "存储路径")
+	uploadPassphrase := uploadCmd.Bool("passphrase", false, "使用口令派生密钥（从环境变量 CRYPTOBACKUP_PASSPHRASE 读取或在终端输入）")
+	uploadKDF := uploadCmd.String("kdf", "argon2id", "口令模式的密钥派生算法 (argon2id|scrypt)")
+	uploadRecipient := uploadCmd.String("recipient", "", "X25519 接收者公钥（16进制或 age1...，多个用逗号分隔），备份主机无需持有私钥")
+	uploadEncryptNames := uploadCmd.Bool("encrypt-names", false, "在存储中使用加密后的文件名和目录名")
+	uploadSealMetadata := uploadCmd.Bool("seal-metadata", false, "加密元数据，只公开算法、格式版本和密钥标识")
+	uploadKeyName := uploadCmd.String("key-name", "", "使用密钥环中的密钥（名称或ID），元数据中记录密钥ID")
+	uploadKeyring := uploadCmd.String("keyring", "", "密钥环文件路径（默认 $CRYPTOBACKUP_KEYRING 或 ~/.cryptobackup/keyring）")
+	uploadInsecure := uploadCmd.Bool("insecure", false, "允许使用不安全的 xor 算法（没有完整性保护，仅用于测试）")
+	uploadCompress := uploadCmd.String("compress", "", "加密前压缩数据 (none|gzip|zstd)，已经压缩过的数据自动跳过")
+	uploadPad := uploadCmd.String("pad", "", "加密前填充数据以隐藏文件长度 (none|padme|pow2)，padme 最多增加约12%")
+	uploadHideSize := uploadCmd.Bool("hide-size", false, "不在元数据中公开原始文件大小")
+	uploadSignKey := uploadCmd.String("sign-key", "", "Ed25519 签名私钥（16进制），未指定时读取环境变量 CRYPTOBACKUP_SIGN_KEY")
+	uploadSignKeyName := uploadCmd.String("sign-key-name", "", "使用密钥环中的 Ed25519 签名密钥（名称或ID）")
+	uploadStorage := uploadCmd.String("storage", "./backup", "存储路径或地址（s3://、webdav://、sftp://、mem://）")
 
 	// download 命令参数
 	downloadRemote := downloadCmd.String("remote", "", "远程文件路径")
 	downloadFile := downloadCmd.String("file", "", "保存到本地的文件路径")
-	downloadAlgo := downloadCmd.String("algo", "aes", "加密算法 (aes|xor)")
-	downloadKey := downloadCmd.String("key", "", "解密密钥（16进制字符串）")
-	downloadStorage := downloadCmd.String("storage", "./backup", "存储路径")
+	downloadAlgo := downloadCmd.String("algo", "auto", "加密算法 (auto|aes|chacha|xor|x25519|age|plugin:<name>)，auto 根据文件头部自动识别，插件加密的文件需要指定插件")
+	downloadKey := downloadCmd.String("key", "", "解密密钥（16进制字符串，X25519 为私钥，age 为 AGE-SECRET-KEY-1...）")
+	downloadPassphrase := downloadCmd.Bool("passphrase", false, "使用口令解密（从环境变量 CRYPTOBACKUP_PASSPHRASE 读取或在终端输入）")
+	downloadEncryptNames := downloadCmd.Bool("encrypt-names", false, "文件上传时使用了加密文件名（-remote 为明文路径）")
+	downloadKeyName := downloadCmd.String("key-name", "", "使用密钥环中的密钥（名称或ID），未提供任何密钥时根据元数据自动选择")
+	downloadKeyring := downloadCmd.String("keyring", "", "密钥环文件路径（默认 $CRYPTOBACKUP_KEYRING 或 ~/.cryptobackup/keyring）")
+	downloadStorage := downloadCmd.String("storage", "./backup", "存储路径或地址（s3://、webdav://、sftp://、mem://）")
 
 	// list 命令参数
 	listPath := listCmd.String("path", "/", "要列出的远程目录路径")
-	listStorage := listCmd.String("storage", "./backup", "存储路径")
+	listKey := listCmd.String("key", "", "解密文件名使用的密钥（16进制字符串），提供时 -path 为明文路径")
+	listPassphrase := listCmd.Bool("passphrase", false, "使用口令解密文件名（从环境变量 CRYPTOBACKUP_PASSPHRASE 读取或在终端输入）")
+	listStorage := listCmd.String("storage", "./backup", "存储路径或地址（s3://、webdav://、sftp://、mem://）")
 
 	// delete 命令参数
 	deleteRemote := deleteCmd.String("remote", "", "要删除的远程文件路径")
-	deleteStorage := deleteCmd.String("storage", "./backup", "存储路径")
+	deleteKey := deleteCmd.String("key", "", "加密文件名使用的密钥（16进制字符串），与 -encrypt-names 一起使用")
+	deletePassphrase := deleteCmd.Bool("passphrase", false, "使用口令加密文件名（从环境变量 CRYPTOBACKUP_PASSPHRASE 读取或在终端输入）")
+	deleteEncryptNames := deleteCmd.Bool("encrypt-names", false, "文件上传时使用了加密文件名（-remote 为明文路径）")
+	deleteStorage := deleteCmd.String("storage", "./backup", "存储路径或地址（s3://、webdav://、sftp://、mem://）")
 
 	// info 命令参数
 	infoRemote := infoCmd.String("remote", "", "远程文件路径")
-	infoStorage := infoCmd.String("storage", "./backup", "存储路径")
+	infoAlgo := infoCmd.String("algo", "auto", "加密算法 (auto|aes|chacha|xor|x25519|age)，提供密钥时用于解密元数据")
+	infoKey := infoCmd.String("key", "", "解密元数据使用的密钥（16进制字符串，X25519 为私钥，age 为 AGE-SECRET-KEY-1...）")
+	infoPassphrase := infoCmd.Bool("passphrase", false, "使用口令解密元数据（从环境变量 CRYPTOBACKUP_PASSPHRASE 读取或在终端输入）")
+	infoEncryptNames := infoCmd.Bool("encrypt-names", false, "文件上传时使用了加密文件名（-remote 为明文路径）")
+	infoStorage := infoCmd.String("storage", "./backup", "存储路径或地址（s3://、webdav://、sftp://、mem://）")
 
 	// genkey 命令参数
 	genkeySize := genkeyCmd.Int("size", 32, "密钥大小（字节），AES推荐16/24/32")
+	genkeyType := genkeyCmd.String("type", "symmetric", "密钥类型 (symmetric|x25519|age|ed25519)，x25519/age 生成公钥/私钥对，ed25519 生成签名密钥对")
+	genkeyShares := genkeyCmd.Int("shares", 0, "将生成的密钥拆分为多个份额（Shamir 秘密分享），不直接输出密钥")
+	genkeyThreshold := genkeyCmd.Int("threshold", 0, "恢复密钥需要的份额数量（与 -shares 一起使用）")
+	genkeyMnemonic := genkeyCmd.Bool("mnemonic", false, "同时以助记词形式输出密钥（拆分时以助记词形式输出份额）")
+	genkeySheet := genkeyCmd.String("sheet", "", "将密钥恢复单写入文件（.html 为可打印的网页，其他为纯文本），用于纸质保存")
+
+	// rekey 命令参数
+	rekeyRemote := rekeyCmd.String("remote", "", "远程文件路径（只重新包装数据密钥）")
+	rekeyPath := rekeyCmd.String("path", "", "远程目录路径，完整解密并重新加密目录下的所有文件（与 -remote 二选一）")
+	rekeyAlgo := rekeyCmd.String("algo", "aes", "使用 -path 时新的加密算法 (aes|chacha|x25519|age|plugin:<name>)")
+	rekeyJournal := rekeyCmd.String("journal", "cryptobackup-rekey.journal", "使用 -path 时的进度日志，中断后使用同一日志再次执行即可继续")
+	rekeyKey := rekeyCmd.String("key", "", "当前主密钥（16进制字符串）")
+	rekeyPassphrase := rekeyCmd.Bool("passphrase", false, "当前主密钥为口令（从环境变量 CRYPTOBACKUP_PASSPHRASE 读取或在终端输入）")
+	rekeyNewKey := rekeyCmd.String("new-key", "", "新主密钥（16进制字符串）")
+	rekeyNewPassphrase := rekeyCmd.Bool("new-passphrase", false, "新主密钥为口令（从环境变量 CRYPTOBACKUP_NEW_PASSPHRASE 读取或在终端输入）")
+	rekeyKDF := rekeyCmd.String("kdf", "argon2id", "新口令的密钥派生算法 (argon2id|scrypt)")
+	rekeyEncryptNames := rekeyCmd.Bool("encrypt-names", false, "文件上传时使用了加密文件名（-remote 为明文路径）")
+	rekeySignKey := rekeyCmd.String("sign-key", "", "重新签名使用的 Ed25519 私钥（16进制，默认读取 CRYPTOBACKUP_SIGN_KEY），未提供时原有签名被移除")
+	rekeyStorage := rekeyCmd.String("storage", "./backup", "存储路径或地址（s3://、webdav://、sftp://、mem://）")
+
+	// migrate 命令参数
+	migratePath := migrateCmd.String("path", "/", "远程目录路径，迁移目录下所有 XOR 加密的文件")
+	migrateKey := migrateCmd.String("key", "", "XOR 加密使用的密钥（16进制字符串）")
+	migrateAlgo := migrateCmd.String("algo", "aes", "新的加密算法 (aes|chacha)")
+	migrateNewKey := migrateCmd.String("new-key", "", "新密钥（16进制字符串）")
+	migrateNewPassphrase := migrateCmd.Bool("new-passphrase", false, "新密钥为口令（从环境变量 CRYPTOBACKUP_NEW_PASSPHRASE 读取或在终端输入）")
+	migrateKDF := migrateCmd.String("kdf", "argon2id", "新口令的密钥派生算法 (argon2id|scrypt)")
+	migrateEncryptNames := migrateCmd.Bool("encrypt-names", false, "文件上传时使用了加密文件名（-path 为明文路径）")
+	migrateSignKey := migrateCmd.String("sign-key", "", "签名使用的 Ed25519 私钥（16进制，默认读取 CRYPTOBACKUP_SIGN_KEY）")
+	migrateJournal := migrateCmd.String("journal", "cryptobackup-migrate.journal", "进度日志，中断后使用同一日志再次执行即可继续")
+	migrateStorage := migrateCmd.String("storage", "./backup", "存储路径或地址（s3://、webdav://、sftp://、mem://）")
+
+	// verify 命令参数
+	verifyRemote := verifyCmd.String("remote", "", "要验证的文件在存储中的路径")
+	verifyPath := verifyCmd.String("path", "", "验证目录下所有文件的签名（与 -remote 二选一）")
+	verifyPubKey := verifyCmd.String("pubkey", "", "签名公钥（16进制）")
+	verifyStorage := verifyCmd.String("storage", "./backup", "存储路径或地址（s3://、webdav://、sftp://、mem://）")
 
 	// serve 命令参数
 	servePort := serveCmd.Int("port", 8080, "HTTP 服务端口")
 	serveHost := serveCmd.String("host", "0.0.0.0", "服务绑定地址")
-	serveStorage := serveCmd.String("storage", "./backup", "存储路径")
+	serveStorage := serveCmd.String("storage", "./backup", "存储路径或地址（s3://、webdav://、sftp://、mem://）")
 	serveUsername := serveCmd.String("username", "", "登录用户名（必需）")
 	servePassword := serveCmd.String("password", "", "登录密码（必需）")
 
@@ -77,25 +146,58 @@ func main() {
 	switch os.Args[1] {
 	case "upload":
 		uploadCmd.Parse(os.Args[2:])
-		if *uploadFile == "" || *uploadRemote == "" || *uploadKey == "" {
-			fmt.Println("错误: upload 命令需要 -file, -remote 和 -key 参数")
+		if *uploadFile == "" || *uploadRemote == "" || (*uploadKey == "" && !*uploadPassphrase && *uploadRecipient == "" && *uploadKeyName == "") {
+			fmt.Println("错误: upload 命令需要 -file, -remote 以及 -key、-passphrase、-recipient 或 -key-name 参数")
 			uploadCmd.PrintDefaults()
 			os.Exit(1)
 		}
-		handleUpload(*uploadFile, *uploadRemote, *uploadAlgo, *uploadKey, *uploadStorage)
+		keys := keyOptions{
+			algo:          *uploadAlgo,
+			keyHex:        *uploadKey,
+			usePassphrase: *uploadPassphrase,
+			kdf:           *uploadKDF,
+			recipients:    *uploadRecipient,
+			encryptNames:  *uploadEncryptNames,
+			sealMetadata:  *uploadSealMetadata,
+			keyName:       *uploadKeyName,
+			keyringPath:   *uploadKeyring,
+			insecure:      *uploadInsecure,
+			compression:   *uploadCompress,
+			padding:       *uploadPad,
+			hideSize:      *uploadHideSize,
+		}
+		signKey, err := resolveSigningKey(*uploadSignKey, *uploadSignKeyName, *uploadKeyring)
+		if err != nil {
+			fmt.Printf("读取签名密钥失败: %v\n", err)
+			os.Exit(1)
+		}
+		keys.signKey = signKey
+		handleUpload(*uploadFile, *uploadRemote, keys, *uploadStorage)
 
 	case "download":
 		downloadCmd.Parse(os.Args[2:])
-		if *downloadRemote == "" || *downloadFile == "" || *downloadKey == "" {
-			fmt.Println("错误: download 命令需要 -remote, -file 和 -key 参数")
+		if *downloadRemote == "" || *downloadFile == "" {
+			fmt.Println("错误: download 命令需要 -remote 和 -file 参数，密钥通过 -key、-passphrase 或 -key-name 提供，都未提供时从密钥环中自动选择")
 			downloadCmd.PrintDefaults()
 			os.Exit(1)
 		}
-		handleDownload(*downloadRemote, *downloadFile, *downloadAlgo, *downloadKey, *downloadStorage)
+		keys := keyOptions{
+			algo:          *downloadAlgo,
+			keyHex:        *downloadKey,
+			usePassphrase: *downloadPassphrase,
+			encryptNames:  *downloadEncryptNames,
+			keyName:       *downloadKeyName,
+			keyringPath:   *downloadKeyring,
+		}
+		handleDownload(*downloadRemote, *downloadFile, keys, *downloadStorage)
 
 	case "list":
 		listCmd.Parse(os.Args[2:])
-		handleList(*listPath, *listStorage)
+		keys := keyOptions{
+			keyHex:        *listKey,
+			usePassphrase: *listPassphrase,
+		}
+		handleList(*listPath, keys, *listStorage)
 
 	case "delete":
 		deleteCmd.Parse(os.Args[2:])
@@ -104,7 +206,17 @@ func main() {
 			deleteCmd.PrintDefaults()
 			os.Exit(1)
 		}
-		handleDelete(*deleteRemote, *deleteStorage)
+		if *deleteEncryptNames && *deleteKey == "" && !*deletePassphrase {
+			fmt.Println("错误: -encrypt-names 需要 -key 或 -passphrase 参数")
+			deleteCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		keys := keyOptions{
+			keyHex:        *deleteKey,
+			usePassphrase: *deletePassphrase,
+			encryptNames:  *deleteEncryptNames,
+		}
+		handleDelete(*deleteRemote, keys, *deleteStorage)
 
 	case "info":
 		infoCmd.Parse(os.Args[2:])
@@ -113,11 +225,104 @@ func main() {
 			infoCmd.PrintDefaults()
 			os.Exit(1)
 		}
-		handleInfo(*infoRemote, *infoStorage)
+		keys := keyOptions{
+			algo:          *infoAlgo,
+			keyHex:        *infoKey,
+			usePassphrase: *infoPassphrase,
+			encryptNames:  *infoEncryptNames,
+		}
+		handleInfo(*infoRemote, keys, *infoStorage)
 
 	case "genkey":
 		genkeyCmd.Parse(os.Args[2:])
-		handleGenKey(*genkeySize)
+		if (*genkeyShares == 0) != (*genkeyThreshold == 0) {
+			fmt.Println("错误: -shares 和 -threshold 需要同时指定")
+			genkeyCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		if *genkeyShares > 0 && *genkeySheet != "" {
+			fmt.Println("错误: 拆分密钥时不能输出包含完整密钥的恢复单")
+			os.Exit(1)
+		}
+		opts := genkeyOptions{
+			shares:    *genkeyShares,
+			threshold: *genkeyThreshold,
+			mnemonic:  *genkeyMnemonic,
+			sheetPath: *genkeySheet,
+		}
+		handleGenKey(*genkeySize, *genkeyType, opts)
+
+	case "key":
+		handleKey(os.Args[2:])
+
+	case "rekey":
+		rekeyCmd.Parse(os.Args[2:])
+		if (*rekeyRemote == "") == (*rekeyPath == "") || (*rekeyKey == "" && !*rekeyPassphrase) || (*rekeyNewKey == "" && !*rekeyNewPassphrase) {
+			fmt.Println("错误: rekey 命令需要 -remote 或 -path、当前密钥（-key 或 -passphrase）以及新密钥（-new-key 或 -new-passphrase）参数")
+			rekeyCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		oldKeys := keyOptions{
+			algo:          "auto",
+			keyHex:        *rekeyKey,
+			usePassphrase: *rekeyPassphrase,
+			encryptNames:  *rekeyEncryptNames,
+		}
+		newKeys := keyOptions{
+			keyHex:        *rekeyNewKey,
+			usePassphrase: *rekeyNewPassphrase,
+			kdf:           *rekeyKDF,
+			encryptNames:  *rekeyEncryptNames,
+			signKey:       *rekeySignKey,
+		}
+		if newKeys.signKey == "" {
+			newKeys.signKey = os.Getenv("CRYPTOBACKUP_SIGN_KEY")
+		}
+		if *rekeyPath != "" {
+			newKeys.algo = *rekeyAlgo
+			handleReencrypt(*rekeyPath, oldKeys, newKeys, *rekeyJournal, *rekeyStorage, false)
+		} else {
+			handleRekey(*rekeyRemote, oldKeys, newKeys, *rekeyStorage)
+		}
+
+	case "migrate":
+		migrateCmd.Parse(os.Args[2:])
+		if *migrateKey == "" || (*migrateNewKey == "" && !*migrateNewPassphrase) {
+			fmt.Println("错误: migrate 命令需要 -key 以及新密钥（-new-key 或 -new-passphrase）参数")
+			fmt.Println("XOR 会泄露密钥流，迁移后不应继续使用原来的密钥")
+			migrateCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		if *migrateAlgo != "aes" && *migrateAlgo != "chacha" {
+			fmt.Printf("错误: migrate 只能迁移到 aes 或 chacha，不支持 %s\n", *migrateAlgo)
+			os.Exit(1)
+		}
+		oldKeys := keyOptions{
+			algo:         "xor",
+			keyHex:       *migrateKey,
+			encryptNames: *migrateEncryptNames,
+		}
+		newKeys := keyOptions{
+			algo:          *migrateAlgo,
+			keyHex:        *migrateNewKey,
+			usePassphrase: *migrateNewPassphrase,
+			kdf:           *migrateKDF,
+			encryptNames:  *migrateEncryptNames,
+			signKey:       *migrateSignKey,
+		}
+		if newKeys.signKey == "" {
+			newKeys.signKey = os.Getenv("CRYPTOBACKUP_SIGN_KEY")
+		}
+		handleReencrypt(*migratePath, oldKeys, newKeys, *migrateJournal, *migrateStorage, true)
+
+	case "verify":
+		verifyCmd.Parse(os.Args[2:])
+		if (*verifyRemote == "") == (*verifyPath == "") || *verifyPubKey == "" {
+			fmt.Println("错误: verify 命令需要 -remote 或 -path 以及 -pubkey 参数")
+			verifyCmd.PrintDefaults()
+			os.Exit(1)
+		}
+		handleVerify(*verifyRemote, *verifyPath, *verifyPubKey, *verifyStorage)
 
 	case "serve":
 		serveCmd.Parse(os.Args[2:])
@@ -154,6 +359,10 @@ func printUsage() {
   delete      删除远程文件
   info        查看文件信息
   genkey      生成随机密钥
+  key         管理本地密钥环和拆分密钥 (add|list|remove|export|split|combine)
+  rekey       更换主密钥（只重写包装后的数据密钥）
+  migrate     将 XOR 加密的旧备份迁移到 AES-GCM 或 XChaCha20-Poly1305
+  verify      使用公钥验证文件签名，不需要解密密钥
   serve       启动 Web UI 服务器
   version     显示版本信息
   help        显示帮助信息
@@ -165,12 +374,66 @@ func printUsage() {
   # 上传文件
   cryptobackup upload -file ./test.txt -remote /backup/test.txt.enc -key <your-key> -algo aes
 
-  # 下载文件
-  cryptobackup download -remote /backup/test.txt.enc -file ./restored.txt -key <your-key> -algo aes
+  # 使用口令代替密钥（口令在终端中输入）
+  cryptobackup upload -file ./test.txt -remote /backup/test.txt.enc -passphrase
+
+  # 生成密钥，同时输出助记词和可打印的恢复单
+  cryptobackup genkey -mnemonic -sheet key-recovery.html
+
+  # 生成密钥并拆分为 5 个份额，任意 3 个可以恢复
+  cryptobackup genkey -shares 5 -threshold 3
+  cryptobackup key combine <share1> <share2> <share3>
+
+  # 生成 X25519 密钥对，备份主机只使用公钥加密
+  cryptobackup genkey -type x25519
+  cryptobackup upload -file ./test.txt -remote /backup/test.txt.enc -recipient <public-key>
+
+  # 生成 age 格式文件，可以用独立的 age 工具解密
+  cryptobackup genkey -type age
+  cryptobackup upload -file ./test.txt -remote /backup/test.txt.age -recipient <age1...>
+
+  # 加密前压缩（数据库导出等文本数据），下载时自动解压
+  cryptobackup upload -file ./dump.sql -remote /backup/dump.sql.enc -key <your-key> -compress zstd
+
+  # 隐藏文件长度：填充密文并且不公开原始大小
+  cryptobackup upload -file ./test.txt -remote /backup/test.txt.enc -key <your-key> -pad padme -hide-size
+
+  # 上传时签名，审计方只使用公钥验证文件来源和完整性
+  cryptobackup genkey -type ed25519
+  cryptobackup upload -file ./test.txt -remote /backup/test.txt.enc -key <your-key> -sign-key <signing-key>
+  cryptobackup verify -path /backup -pubkey <signing-public-key>
+
+  # 下载文件（根据文件头部自动识别算法）
+  cryptobackup download -remote /backup/test.txt.enc -file ./restored.txt -key <your-key>
+
+  # 更换主密钥，不需要重新加密文件数据
+  cryptobackup rekey -remote /backup/test.txt.enc -key <old-key> -new-key <new-key>
+
+  # 密钥泄露时完整重新加密整个目录（可中断后继续）
+  cryptobackup rekey -path /backup -key <old-key> -new-key <new-key> -algo chacha
+
+  # 将 XOR 加密的旧备份迁移到 AES-GCM（使用新密钥）
+  cryptobackup migrate -path / -key <xor-key> -new-key <new-key> -algo aes
 
   # 列出文件
   cryptobackup list -path / -storage ./backup
 
+  # 在存储中隐藏文件名，列出时提供密钥显示明文名称
+  cryptobackup upload -file ./test.txt -remote /backup/test.txt.enc -key <your-key> -encrypt-names
+  cryptobackup list -path /backup -key <your-key>
+
+  # 加密元数据（原始文件名、大小等），查看时提供密钥
+  cryptobackup upload -file ./test.txt -remote /backup/test.txt.enc -key <your-key> -seal-metadata
+  cryptobackup info -remote /backup/test.txt.enc -key <your-key>
+
+  # 把密钥保存到密钥环，上传时按名称使用，下载时自动选择
+  cryptobackup key add -name work
+  cryptobackup upload -file ./test.txt -remote /backup/test.txt.enc -key-name work
+  cryptobackup download -remote /backup/test.txt.enc -file ./restored.txt
+
+  # 使用 S3 兼容存储（凭证从 AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY 读取）
+  cryptobackup list -path / -storage 's3://bucket/prefix?endpoint=http://localhost:9000'
+
   # 启动 Web UI
   cryptobackup serve -username admin -password yourpassword -port 8080
 
@@ -179,38 +442,225 @@ func printUsage() {
 }
 
 func createEncryptor(algo string, keyHex string) (crypto.Encryptor, error) {
+	cfg := &crypto.Config{Algorithm: algo}
+
+	// age 密钥使用自己的文本编码
+	if algo == "age" || strings.HasPrefix(keyHex, "AGE-SECRET-KEY-1") {
+		cfg.Algorithm = "age"
+		cfg.Key = []byte(keyHex)
+		return crypto.NewEncryptor(cfg)
+	}
+
 	key, err := hex.DecodeString(keyHex)
 	if err != nil {
 		return nil, fmt.Errorf("无效的密钥格式，必须是16进制字符串: %w", err)
 	}
+	cfg.Key = key
+	return crypto.NewEncryptor(cfg)
+}
 
-	switch algo {
-	case "aes":
-		return crypto.NewAESEncryptor(key)
-	case "xor":
-		return crypto.NewXOREncryptor(key)
-	default:
-		return nil, fmt.Errorf("不支持的加密算法: %s", algo)
+// createPassphraseEncryptor 根据算法和口令创建加密器
+func createPassphraseEncryptor(algo string, passphrase string, kdfName string) (crypto.Encryptor, error) {
+	return crypto.NewEncryptor(&crypto.Config{
+		Algorithm: algo,
+		Options: map[string]interface{}{
+			crypto.OptionPassphrase: passphrase,
+			crypto.OptionKDF:        kdfName,
+		},
+	})
+}
+
+// createRecipientEncryptor 创建加密给公钥接收者的加密器
+// age 公钥（age1...）使用 age 格式，其他按 16 进制 X25519 公钥处理
+func createRecipientEncryptor(recipients string) (crypto.Encryptor, error) {
+	algo := "x25519"
+	if strings.HasPrefix(strings.TrimSpace(recipients), "age1") {
+		algo = "age"
 	}
+	return crypto.NewEncryptor(&crypto.Config{
+		Algorithm: algo,
+		Options:   map[string]interface{}{crypto.OptionRecipients: recipients},
+	})
 }
 
-func handleUpload(localFile, remotePath, algo, keyHex, storagePath string) {
-	// 创建加密器
-	encryptor, err := createEncryptor(algo, keyHex)
+// keyOptions 命令行中与密钥相关的参数
+type keyOptions struct {
+	algo          string // 加密算法
+	keyHex        string // 16进制密钥
+	usePassphrase bool   // 是否使用口令
+	kdf           string // 口令模式的密钥派生算法
+	recipients    string // X25519 接收者公钥（逗号分隔）
+	encryptNames  bool   // 是否加密存储中的文件名
+	sealMetadata  bool   // 是否加密元数据
+	keyName       string // 密钥环中的密钥名称
+	keyringPath   string // 密钥环文件路径
+	keyID         string // 写入元数据的密钥ID
+	insecure      bool   // 是否允许不安全的算法
+	signKey       string // Ed25519 签名私钥（16进制），为空时不签名
+	compression   string // 加密前的压缩算法，为空时不压缩
+	padding       string // 加密前的填充方案，为空时不填充
+	hideSize      bool   // 是否不公开原始文件大小
+}
+
+// resolveEncryptor 根据命令行参数创建加密器，口令模式下读取口令
+// 需要加密文件名或元数据时同时返回对应的上传器选项，口令模式的文件名盐从 store 读取
+func resolveEncryptor(store storage.Storage, keys keyOptions, confirm bool) (crypto.Encryptor, []uploader.Option, error) {
+	var opts []uploader.Option
+	if keys.sealMetadata {
+		opts = append(opts, uploader.WithSealedMetadata())
+	}
+	if keys.keyID != "" {
+		opts = append(opts, uploader.WithKeyID(keys.keyID))
+	}
+	if keys.insecure {
+		opts = append(opts, uploader.WithInsecure())
+	}
+	if keys.signKey != "" {
+		signer, err := crypto.ParseSigningKey(keys.signKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, uploader.WithSigner(signer))
+	}
+	if keys.compression != "" {
+		if _, err := uploader.ParseCompression(keys.compression); err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, uploader.WithCompression(keys.compression))
+	}
+	if keys.padding != "" {
+		if _, err := uploader.ParsePadding(keys.padding); err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, uploader.WithPadding(keys.padding))
+	}
+	if keys.hideSize {
+		opts = append(opts, uploader.WithoutOriginalSize())
+	}
+
+	if keys.recipients != "" {
+		if keys.encryptNames {
+			return nil, nil, fmt.Errorf("加密文件名需要 -key 或 -passphrase，不能只使用公钥")
+		}
+		encryptor, err := createRecipientEncryptor(keys.recipients)
+		return encryptor, opts, err
+	}
+
+	var passphrase string
+	var encryptor crypto.Encryptor
+	var err error
+	if keys.usePassphrase {
+		if passphrase, err = readPassphrase(confirm); err != nil {
+			return nil, nil, err
+		}
+		encryptor, err = createPassphraseEncryptor(keys.algo, passphrase, keys.kdf)
+	} else {
+		encryptor, err = createEncryptor(keys.algo, keys.keyHex)
+	}
+	if err != nil || !keys.encryptNames {
+		return encryptor, opts, err
+	}
+
+	names, err := createNameCipher(store, keys.keyHex, passphrase)
 	if err != nil {
-		fmt.Printf("创建加密器失败: %v\n", err)
-		os.Exit(1)
+		return nil, nil, err
+	}
+	return encryptor, append(opts, uploader.WithEncryptedNames(names)), nil
+}
+
+// createNameCipher 根据16进制密钥或口令创建文件名加密器
+// 口令模式使用仓库中保存的文件名盐，仓库中还没有时生成
+func createNameCipher(store storage.Storage, keyHex, passphrase string) (*crypto.NameCipher, error) {
+	if passphrase != "" {
+		salt, err := uploader.LoadNameSalt(context.Background(), store)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.NewNameCipherWithPassphrase(passphrase, salt)
+	}
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return nil, fmt.Errorf("加密文件名需要16进制密钥或口令")
+	}
+	return crypto.NewNameCipher(key)
+}
+
+// readPassphrase 读取口令
+// 优先使用环境变量 CRYPTOBACKUP_PASSPHRASE，否则在终端中提示输入（不回显）
+func readPassphrase(confirm bool) (string, error) {
+	return readPassphraseFrom("CRYPTOBACKUP_PASSPHRASE", "请输入口令", confirm)
+}
+
+// readPassphraseFrom 从指定的环境变量读取口令，未设置时在终端中使用prompt提示输入
+func readPassphraseFrom(envName, prompt string, confirm bool) (string, error) {
+	if passphrase := os.Getenv(envName); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("标准输入不是终端，请通过环境变量 %s 提供口令", envName)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("读取口令失败: %w", err)
+	}
+	if len(passphrase) == 0 {
+		return "", fmt.Errorf("口令不能为空")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "请再次输入口令: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("读取口令失败: %w", err)
+		}
+		if string(again) != string(passphrase) {
+			return "", fmt.Errorf("两次输入的口令不一致")
+		}
+	}
+
+	return string(passphrase), nil
+}
+
+func handleUpload(localFile, remotePath string, keys keyOptions, storagePath string) {
+	// 使用密钥环中的密钥
+	if keys.keyName != "" {
+		var err error
+		if keys, err = loadKeyringKey(keys, true); err != nil {
+			fmt.Printf("读取密钥环失败: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	// 创建存储
-	store, err := storage.NewLocalStorage(storagePath)
+	store, err := storage.Open(storagePath)
 	if err != nil {
 		fmt.Printf("创建存储失败: %v\n", err)
 		os.Exit(1)
 	}
 
+	// 创建加密器
+	encryptor, opts, err := resolveEncryptor(store, keys, true)
+	if err != nil {
+		fmt.Printf("创建加密器失败: %v\n", err)
+		os.Exit(1)
+	}
+	if crypto.IsInsecure(encryptor.GetMetadata()["algorithm"]) {
+		if !keys.insecure {
+			fmt.Println("错误: xor 算法没有完整性保护，并且会泄露使用同一密钥的文件内容，请使用 aes 或 chacha")
+			fmt.Println("仅用于测试时可以添加 -insecure 参数")
+			os.Exit(1)
+		}
+		fmt.Println("警告: 正在使用不安全的 xor 算法加密")
+	}
+
 	// 创建上传器
-	ul := uploader.NewUploader(encryptor, store)
+	ul := uploader.NewUploader(encryptor, store, opts...)
 
 	// 上传文件
 	ctx := context.Background()
@@ -223,23 +673,35 @@ func handleUpload(localFile, remotePath, algo, keyHex, storagePath string) {
 	fmt.Println("✓ 上传成功！")
 }
 
-func handleDownload(remotePath, localFile, algo, keyHex, storagePath string) {
-	// 创建加密器
-	encryptor, err := createEncryptor(algo, keyHex)
+func handleDownload(remotePath, localFile string, keys keyOptions, storagePath string) {
+	// 创建存储
+	store, err := storage.Open(storagePath)
 	if err != nil {
-		fmt.Printf("创建加密器失败: %v\n", err)
+		fmt.Printf("创建存储失败: %v\n", err)
 		os.Exit(1)
 	}
 
-	// 创建存储
-	store, err := storage.NewLocalStorage(storagePath)
+	// 使用密钥环中的密钥，没有提供任何密钥时根据元数据自动选择
+	switch {
+	case keys.keyName != "":
+		keys, err = loadKeyringKey(keys, false)
+	case keys.keyHex == "" && !keys.usePassphrase:
+		keys, err = pickKeyringKey(store, remotePath, keys)
+	}
 	if err != nil {
-		fmt.Printf("创建存储失败: %v\n", err)
+		fmt.Printf("读取密钥环失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 创建加密器
+	encryptor, opts, err := resolveEncryptor(store, keys, false)
+	if err != nil {
+		fmt.Printf("创建加密器失败: %v\n", err)
 		os.Exit(1)
 	}
 
 	// 创建上传器
-	ul := uploader.NewUploader(encryptor, store)
+	ul := uploader.NewUploader(encryptor, store, opts...)
 
 	// 下载文件
 	ctx := context.Background()
@@ -252,21 +714,195 @@ func handleDownload(remotePath, localFile, algo, keyHex, storagePath string) {
 	fmt.Println("✓ 下载成功！")
 }
 
-func handleList(path, storagePath string) {
+func handleRekey(remotePath string, oldKeys, newKeys keyOptions, storagePath string) {
 	// 创建存储
-	store, err := storage.NewLocalStorage(storagePath)
+	store, err := storage.Open(storagePath)
 	if err != nil {
 		fmt.Printf("创建存储失败: %v\n", err)
 		os.Exit(1)
 	}
 
-	// 列出文件
+	// 当前主密钥，算法从文件头部识别
+	oldEncryptor, opts, err := resolveEncryptor(store, oldKeys, false)
+	if err != nil {
+		fmt.Printf("创建加密器失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 新主密钥只用于包装数据密钥，文件的加密算法保持不变
+	newKeys.algo = "aes"
+	newEncryptor, newOpts, err := resolveNewEncryptor(store, newKeys)
+	if err != nil {
+		fmt.Printf("创建加密器失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	ul := uploader.NewUploader(oldEncryptor, store, opts...)
+
 	ctx := context.Background()
-	files, err := store.List(ctx, path)
+	fmt.Printf("正在更换主密钥: %s\n", remotePath)
+	if err := ul.Rekey(ctx, remotePath, newEncryptor, newOpts...); err != nil {
+		fmt.Printf("更换主密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("✓ 主密钥已更换！")
+}
+
+// resolveNewEncryptor 根据 -new-key 或 -new-passphrase 创建新的加密器
+// 文件名密钥由主密钥派生，使用加密文件名时同时返回新的文件名加密器选项
+func resolveNewEncryptor(store storage.Storage, newKeys keyOptions) (crypto.Encryptor, []uploader.Option, error) {
+	var newEncryptor crypto.Encryptor
+	var newPassphrase string
+	var err error
+	if newKeys.usePassphrase {
+		newPassphrase, err = readPassphraseFrom("CRYPTOBACKUP_NEW_PASSPHRASE", "请输入新口令", true)
+		if err != nil {
+			return nil, nil, err
+		}
+		newEncryptor, err = createPassphraseEncryptor(newKeys.algo, newPassphrase, newKeys.kdf)
+	} else {
+		newEncryptor, err = createEncryptor(newKeys.algo, newKeys.keyHex)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var opts []uploader.Option
+	if newKeys.signKey != "" {
+		signer, err := crypto.ParseSigningKey(newKeys.signKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, uploader.WithSigner(signer))
+	}
+	if !newKeys.encryptNames {
+		return newEncryptor, opts, nil
+	}
+	names, err := createNameCipher(store, newKeys.keyHex, newPassphrase)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建文件名加密器失败: %w", err)
+	}
+	return newEncryptor, append(opts, uploader.WithEncryptedNames(names)), nil
+}
+
+// handleReencrypt 重新加密目录下的文件，migrate 为 true 时只迁移 XOR 加密的文件
+func handleReencrypt(root string, oldKeys, newKeys keyOptions, journalPath, storagePath string, migrate bool) {
+	// 创建存储
+	store, err := storage.Open(storagePath)
+	if err != nil {
+		fmt.Printf("创建存储失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	oldEncryptor, opts, err := resolveEncryptor(store, oldKeys, false)
+	if err != nil {
+		fmt.Printf("创建加密器失败: %v\n", err)
+		os.Exit(1)
+	}
+	newEncryptor, newOpts, err := resolveNewEncryptor(store, newKeys)
+	if err != nil {
+		fmt.Printf("创建加密器失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	journal, err := uploader.OpenJournal(journalPath)
+	if err != nil {
+		fmt.Printf("打开进度日志失败: %v\n", err)
+		os.Exit(1)
+	}
+	if done := journal.Done(); done > 0 {
+		fmt.Printf("从进度日志继续，已完成 %d 个文件\n", done)
+	}
+
+	ul := uploader.NewUploader(oldEncryptor, store, opts...)
+
+	ctx := context.Background()
+	var report *uploader.ReencryptReport
+	if migrate {
+		fmt.Printf("正在迁移目录中 XOR 加密的文件: %s\n", root)
+		report, err = ul.Migrate(ctx, root, newEncryptor, journal, newOpts...)
+	} else {
+		fmt.Printf("正在重新加密目录: %s\n", root)
+		report, err = ul.Reencrypt(ctx, root, newEncryptor, journal, newOpts...)
+	}
+	// 下面的 os.Exit 不会执行 defer，日志在输出结果前显式关闭
+	closeErr := journal.Close()
+
+	if report != nil {
+		for _, p := range report.Reencrypted {
+			fmt.Printf("  ✓ %s\n", p)
+		}
+		for p, ferr := range report.Failed {
+			fmt.Printf("  ✗ %s: %v\n", p, ferr)
+		}
+		fmt.Printf("重新加密 %d 个，跳过 %d 个（日志中已完成），失败 %d 个\n",
+			len(report.Reencrypted), len(report.Skipped), len(report.Failed))
+	}
+	if err != nil {
+		fmt.Printf("重新加密中断: %v\n", err)
+		fmt.Printf("修复问题后使用同一个日志 (%s) 再次执行即可继续\n", journalPath)
+		os.Exit(1)
+	}
+	if closeErr != nil {
+		fmt.Printf("关闭进度日志失败: %v\n", closeErr)
+		os.Exit(1)
+	}
+	if len(report.Failed) > 0 {
+		fmt.Println("部分文件失败，原文件保持不变，修复后再次执行即可重试")
+		os.Exit(1)
+	}
+
+	if migrate && len(report.Reencrypted)+len(report.Skipped) == 0 {
+		fmt.Println("没有需要迁移的 XOR 加密文件")
+		return
+	}
+	fmt.Println("✓ 重新加密完成！")
+	fmt.Printf("确认无误后可以删除进度日志 %s\n", journalPath)
+}
+
+func handleList(path string, keys keyOptions, storagePath string) {
+	// 创建存储
+	store, err := storage.Open(storagePath)
+	if err != nil {
+		fmt.Printf("创建存储失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 提供密钥时解密文件名，-path 为明文路径
+	var names *crypto.NameCipher
+	listPath := path
+	if keys.keyHex != "" || keys.usePassphrase {
+		var passphrase string
+		if keys.usePassphrase {
+			if passphrase, err = readPassphrase(false); err != nil {
+				fmt.Printf("读取口令失败: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if names, err = createNameCipher(store, keys.keyHex, passphrase); err != nil {
+			fmt.Printf("创建文件名加密器失败: %v\n", err)
+			os.Exit(1)
+		}
+		if listPath, err = names.EncryptPath(path); err != nil {
+			fmt.Printf("加密路径失败: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// 列出文件，跳过仓库自身使用的文件
+	ctx := context.Background()
+	entries, err := store.List(ctx, listPath)
 	if err != nil {
 		fmt.Printf("列出文件失败: %v\n", err)
 		os.Exit(1)
 	}
+	var files []storage.FileInfo
+	for _, entry := range entries {
+		if !uploader.IsRepositoryFile(entry.Path) {
+			files = append(files, entry)
+		}
+	}
 
 	if len(files) == 0 {
 		fmt.Println("目录为空")
@@ -276,26 +912,54 @@ func handleList(path, storagePath string) {
 	fmt.Printf("路径: %s\n", path)
 	fmt.Println("----------------------------------------")
 	for _, file := range files {
+		name := filepath.Base(file.Path)
+		if names != nil {
+			// 无法解密的名称（未加密文件名上传的文件）原样显示
+			if plain, err := names.DecryptName(name); err == nil {
+				name = fmt.Sprintf("%s  [存储名: %s]", plain, name)
+			}
+		}
 		if file.IsDir {
-			fmt.Printf("[DIR]  %s\n", filepath.Base(file.Path))
+			fmt.Printf("[DIR]  %s\n", name)
 		} else {
-			fmt.Printf("[FILE] %s (%d bytes)\n", filepath.Base(file.Path), file.Size)
+			fmt.Printf("[FILE] %s (%d bytes)\n", name, file.Size)
 		}
 	}
 }
 
-func handleDelete(remotePath, storagePath string) {
+func handleDelete(remotePath string, keys keyOptions, storagePath string) {
 	// 创建存储
-	store, err := storage.NewLocalStorage(storagePath)
+	store, err := storage.Open(storagePath)
 	if err != nil {
 		fmt.Printf("创建存储失败: %v\n", err)
 		os.Exit(1)
 	}
 
+	// 使用加密文件名时 -remote 为明文路径，删除前映射为存储中的路径
+	deletePath := remotePath
+	if keys.encryptNames {
+		var passphrase string
+		if keys.usePassphrase {
+			if passphrase, err = readPassphrase(false); err != nil {
+				fmt.Printf("读取口令失败: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		names, err := createNameCipher(store, keys.keyHex, passphrase)
+		if err != nil {
+			fmt.Printf("创建文件名加密器失败: %v\n", err)
+			os.Exit(1)
+		}
+		if deletePath, err = names.EncryptPath(remotePath); err != nil {
+			fmt.Printf("加密路径失败: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// 删除文件
 	ctx := context.Background()
 	fmt.Printf("正在删除文件: %s\n", remotePath)
-	if err := store.Delete(ctx, remotePath); err != nil {
+	if err := store.Delete(ctx, deletePath); err != nil {
 		fmt.Printf("删除失败: %v\n", err)
 		os.Exit(1)
 	}
@@ -303,17 +967,27 @@ func handleDelete(remotePath, storagePath string) {
 	fmt.Println("✓ 删除成功！")
 }
 
-func handleInfo(remotePath, storagePath string) {
+func handleInfo(remotePath string, keys keyOptions, storagePath string) {
 	// 创建存储
-	store, err := storage.NewLocalStorage(storagePath)
+	store, err := storage.Open(storagePath)
 	if err != nil {
 		fmt.Printf("创建存储失败: %v\n", err)
 		os.Exit(1)
 	}
 
-	// 获取文件信息
+	// 获取文件信息，提供密钥时解密加密的元数据
 	ctx := context.Background()
-	metadata, err := store.GetMetadata(ctx, remotePath)
+	var metadata map[string]string
+	if keys.keyHex != "" || keys.usePassphrase {
+		encryptor, opts, keyErr := resolveEncryptor(store, keys, false)
+		if keyErr != nil {
+			fmt.Printf("创建加密器失败: %v\n", keyErr)
+			os.Exit(1)
+		}
+		metadata, err = uploader.NewUploader(encryptor, store, opts...).GetFileInfo(ctx, remotePath)
+	} else {
+		metadata, err = store.GetMetadata(ctx, remotePath)
+	}
 	if err != nil {
 		fmt.Printf("获取文件信息失败: %v\n", err)
 		os.Exit(1)
@@ -322,22 +996,174 @@ func handleInfo(remotePath, storagePath string) {
 	fmt.Printf("文件信息: %s\n", remotePath)
 	fmt.Println("----------------------------------------")
 	for k, v := range metadata {
+		if k == "sealed" {
+			fmt.Printf("%s: <已加密，使用 -key 或 -passphrase 查看>\n", k)
+			continue
+		}
 		fmt.Printf("%s: %s\n", k, v)
 	}
 }
 
-func handleGenKey(size int) {
+// genkeyOptions genkey 命令的输出选项
+type genkeyOptions struct {
+	shares    int    // 拆分的份额数量，0 表示不拆分
+	threshold int    // 恢复需要的份额数量
+	mnemonic  bool   // 是否输出助记词
+	sheetPath string // 恢复单文件路径
+}
+
+func handleGenKey(size int, keyType string, opts genkeyOptions) {
+	switch keyType {
+	case "symmetric":
+	case "x25519":
+		handleGenKeyPair(opts)
+		return
+	case "age":
+		if opts.shares > 0 {
+			fmt.Println("age 密钥不支持拆分，请使用 symmetric 或 x25519")
+			os.Exit(1)
+		}
+		handleGenAgeIdentity(opts)
+		return
+	case "ed25519":
+		handleGenSigningKey(opts)
+		return
+	default:
+		fmt.Printf("不支持的密钥类型: %s\n", keyType)
+		os.Exit(1)
+	}
+
 	key := make([]byte, size)
 	if _, err := rand.Read(key); err != nil {
 		fmt.Printf("生成密钥失败: %v\n", err)
 		os.Exit(1)
 	}
 
+	// 拆分时只输出份额，任何人都不会单独持有完整的密钥
+	if opts.shares > 0 {
+		if err := printShares(key, opts.shares, opts.threshold, opts.mnemonic); err != nil {
+			fmt.Printf("拆分密钥失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	keyHex := hex.EncodeToString(key)
 	fmt.Printf("生成的密钥 (%d 字节):\n%s\n", size, keyHex)
+	exportGeneratedKey(keyring.TypeSymmetric, keyHex, opts)
 	fmt.Println("\n请妥善保管此密钥，丢失后将无法解密文件！")
 }
 
+func handleGenKeyPair(opts genkeyOptions) {
+	priv, pub, err := crypto.GenerateX25519KeyPair()
+	if err != nil {
+		fmt.Printf("生成密钥对失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if opts.shares > 0 {
+		fmt.Printf("公钥（分发给备份主机，用于 -recipient）:\n%s\n", hex.EncodeToString(pub))
+		fmt.Printf("\n公钥指纹: %s\n", crypto.FingerprintString(pub))
+		fmt.Println("\n私钥份额:")
+		if err := printShares(priv, opts.shares, opts.threshold, opts.mnemonic); err != nil {
+			fmt.Printf("拆分私钥失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Printf("私钥（仅保存在负责恢复的机器上）:\n%s\n", hex.EncodeToString(priv))
+	fmt.Printf("\n公钥（分发给备份主机，用于 -recipient）:\n%s\n", hex.EncodeToString(pub))
+	fmt.Printf("\n公钥指纹: %s\n", crypto.FingerprintString(pub))
+	exportGeneratedKey(keyring.TypeX25519, hex.EncodeToString(priv), opts)
+	fmt.Println("\n持有公钥只能加密，解密需要私钥。请妥善保管私钥，丢失后将无法解密文件！")
+}
+
+func handleGenAgeIdentity(opts genkeyOptions) {
+	identity, recipient, err := crypto.GenerateAgeIdentity()
+	if err != nil {
+		fmt.Printf("生成 age 密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("age 私钥（可直接用于 age -d -i）:\n%s\n", identity)
+	fmt.Printf("\nage 公钥（用于 -recipient 或 age -r）:\n%s\n", recipient)
+	exportGeneratedKey(keyring.TypeAge, identity, opts)
+	fmt.Println("\n请妥善保管私钥，丢失后将无法解密文件！")
+}
+
+func handleGenSigningKey(opts genkeyOptions) {
+	seed, pub, err := crypto.GenerateSigningKeyPair()
+	if err != nil {
+		fmt.Printf("生成签名密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if opts.shares > 0 {
+		fmt.Printf("签名公钥（分发给审计方，用于 verify -pubkey）:\n%s\n", hex.EncodeToString(pub))
+		fmt.Printf("\n公钥指纹: %s\n", crypto.FingerprintString(pub))
+		fmt.Println("\n签名私钥份额:")
+		if err := printShares(seed, opts.shares, opts.threshold, opts.mnemonic); err != nil {
+			fmt.Printf("拆分私钥失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Printf("签名私钥（仅保存在备份主机上，用于 upload -sign-key）:\n%s\n", hex.EncodeToString(seed))
+	fmt.Printf("\n签名公钥（分发给审计方，用于 verify -pubkey）:\n%s\n", hex.EncodeToString(pub))
+	fmt.Printf("\n公钥指纹: %s\n", crypto.FingerprintString(pub))
+	exportGeneratedKey(keyring.TypeEd25519, hex.EncodeToString(seed), opts)
+	fmt.Println("\n签名私钥只用于证明备份的来源，不能解密文件。私钥泄露后任何人都可以伪造签名，请妥善保管！")
+}
+
+// handleVerify 使用公钥验证单个文件或整个目录的签名
+func handleVerify(remotePath, root, pubKeyHex, storagePath string) {
+	publicKey, err := crypto.ParseVerifyingKey(pubKeyHex)
+	if err != nil {
+		fmt.Printf("公钥无效: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 创建存储
+	store, err := storage.Open(storagePath)
+	if err != nil {
+		fmt.Printf("创建存储失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	if remotePath != "" {
+		info, err := uploader.Verify(ctx, store, remotePath, publicKey)
+		if err != nil {
+			fmt.Printf("✗ 签名验证失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ 签名有效: %s\n", remotePath)
+		fmt.Printf("签名者: %s\n", info.Signer)
+		fmt.Printf("密文 SHA-256: %s\n", info.ContentHash)
+		return
+	}
+
+	fmt.Printf("正在验证目录: %s\n", root)
+	report, err := uploader.VerifyTree(ctx, store, root, publicKey)
+	for _, info := range report.Verified {
+		fmt.Printf("  ✓ %s\n", info.Path)
+	}
+	for p, ferr := range report.Failed {
+		fmt.Printf("  ✗ %s: %v\n", p, ferr)
+	}
+	fmt.Printf("签名有效 %d 个，失败 %d 个\n", len(report.Verified), len(report.Failed))
+	if err != nil {
+		fmt.Printf("验证中断: %v\n", err)
+		os.Exit(1)
+	}
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("✓ 所有文件均由公钥指纹 %s 签名\n", crypto.FingerprintString(publicKey))
+}
+
 func handleServe(host string, port int, storagePath, username, password string) {
 	// Hash password with bcrypt
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -347,7 +1173,7 @@ func handleServe(host string, port int, storagePath, username, password string)
 	}
 
 	// Create storage instance
-	store, err := storage.NewLocalStorage(storagePath)
+	store, err := storage.Open(storagePath)
 	if err != nil {
 		fmt.Printf("创建存储失败: %v\n", err)
 		os.Exit(1)
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"bufio"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -10,68 +11,142 @@ import (
 
 // AESEncryptor 使用AES-GCM模式的加密器
 type AESEncryptor struct {
-	key []byte
+	keys keySource
 }
 
+// passphraseKeySize 口令模式下派生的密钥长度（AES-256）
+const passphraseKeySize = 32
+
 // NewAESEncryptor 创建AES加密器
 // key: 密钥，必须是16、24或32字节（对应AES-128、AES-192、AES-256）
 func NewAESEncryptor(key []byte) (*AESEncryptor, error) {
 	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
 		return nil, fmt.Errorf("invalid key size: %d, must be 16, 24 or 32 bytes", len(key))
 	}
-	return &AESEncryptor{key: key}, nil
+	return &AESEncryptor{keys: keySource{key: key}}, nil
+}
+
+// NewAESEncryptorWithPassphrase 创建使用口令的AES-256加密器
+// 每个文件使用随机盐通过kdf派生密钥，盐和开销参数记录在文件头部
+func NewAESEncryptorWithPassphrase(passphrase string, kdf KDFAlgorithm) (*AESEncryptor, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	if kdf == KDFNone {
+		kdf = KDFArgon2id
+	}
+	return &AESEncryptor{keys: keySource{passphrase: []byte(passphrase), kdf: kdf}}, nil
 }
 
-// Encrypt 使用AES-GCM加密数据
+// Encrypt 使用AES-GCM分块加密数据
+// 输出以自描述头部开头，数据按 DefaultChunkSize 分块处理，不会将整个文件读入内存。
+// 数据使用随机生成的数据密钥加密，数据密钥由主密钥包装后保存在头部
 func (e *AESEncryptor) Encrypt(src io.Reader, dst io.Writer) error {
-	block, err := aes.NewCipher(e.key)
+	return e.EncryptWithAAD(src, dst, nil)
+}
+
+// EncryptWithAAD 使用AES-GCM分块加密数据，并将aad绑定为每块的附加认证数据
+func (e *AESEncryptor) EncryptWithAAD(src io.Reader, dst io.Writer, aad []byte) error {
+	kek, kdf, err := e.keys.encryptionKey(passphraseKeySize)
 	if err != nil {
-		return fmt.Errorf("failed to create cipher: %w", err)
+		return err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	// 数据密钥与主密钥长度相同
+	dek, err := newDataKey(len(kek))
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(dek)
 	if err != nil {
-		return fmt.Errorf("failed to create GCM: %w", err)
+		return err
 	}
 
-	// 生成随机nonce
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+	// 生成随机nonce前缀
+	prefix := make([]byte, noncePrefixSize(gcm))
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
 		return fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	// 先写入nonce
-	if _, err := dst.Write(nonce); err != nil {
-		return fmt.Errorf("failed to write nonce: %w", err)
+	// 先写入头部，头部同时作为每块的附加认证数据
+	header := &Header{
+		Algorithm:   AlgorithmAES,
+		KDF:         kdf,
+		Fingerprint: KeyFingerprint(kek),
+		ChunkSize:   DefaultChunkSize,
+		NoncePrefix: prefix,
+		Bound:       aad != nil,
+	}
+	if err := header.wrapDataKey(kek, dek); err != nil {
+		return err
+	}
+	if err := WriteHeader(dst, header); err != nil {
+		return err
 	}
 
-	// 读取所有数据
-	plaintext, err := io.ReadAll(src)
+	chunkAAD, err := header.chunkAAD(aad)
 	if err != nil {
-		return fmt.Errorf("failed to read source data: %w", err)
+		return err
 	}
+	return sealStream(gcm, prefix, DefaultChunkSize, chunkAAD, src, dst)
+}
 
-	// 加密数据
-	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+// Decrypt 使用AES-GCM解密数据
+// 同时支持带头部的分块格式和旧版的单次加密格式（nonce || 密文）
+func (e *AESEncryptor) Decrypt(src io.Reader, dst io.Writer) error {
+	return e.DecryptWithAAD(src, dst, nil)
+}
 
-	// 写入加密后的数据
-	if _, err := dst.Write(ciphertext); err != nil {
-		return fmt.Errorf("failed to write encrypted data: %w", err)
+// DecryptWithAAD 使用AES-GCM解密数据，aad必须与加密时绑定的一致
+func (e *AESEncryptor) DecryptWithAAD(src io.Reader, dst io.Writer, aad []byte) error {
+	r := bufio.NewReader(src)
+	header, err := ReadHeader(r)
+	if err == ErrNoHeader {
+		if e.keys.isPassphrase() {
+			return fmt.Errorf("data was not encrypted with a passphrase")
+		}
+		return e.decryptLegacy(r, dst)
+	}
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
+	// 在解密任何数据之前检查算法和密钥
+	if err := header.expect(AlgorithmAES); err != nil {
+		return err
+	}
+	if header.ChunkSize == 0 {
+		return fmt.Errorf("missing stream parameters in header")
+	}
+	kek, err := e.keys.decryptionKey(header, passphraseKeySize)
+	if err != nil {
+		return err
+	}
+	dek, err := header.unwrapDataKey(kek)
+	if err != nil {
+		return err
+	}
 
-// Decrypt 使用AES-GCM解密数据
-func (e *AESEncryptor) Decrypt(src io.Reader, dst io.Writer) error {
-	block, err := aes.NewCipher(e.key)
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return err
+	}
+	if len(header.NoncePrefix) != noncePrefixSize(gcm) {
+		return fmt.Errorf("invalid nonce prefix size: %d", len(header.NoncePrefix))
+	}
+
+	chunkAAD, err := header.chunkAAD(aad)
 	if err != nil {
-		return fmt.Errorf("failed to create cipher: %w", err)
+		return err
 	}
+	return openStream(gcm, header.NoncePrefix, int(header.ChunkSize), chunkAAD, r, dst)
+}
 
-	gcm, err := cipher.NewGCM(block)
+// decryptLegacy 解密旧版单次加密格式（nonce || 密文）
+func (e *AESEncryptor) decryptLegacy(src io.Reader, dst io.Writer) error {
+	gcm, err := newGCM(e.keys.key)
 	if err != nil {
-		return fmt.Errorf("failed to create GCM: %w", err)
+		return err
 	}
 
 	// 读取nonce
@@ -100,10 +175,40 @@ func (e *AESEncryptor) Decrypt(src io.Reader, dst io.Writer) error {
 	return nil
 }
 
+// masterKeys 返回包装数据密钥使用的主密钥
+func (e *AESEncryptor) masterKeys() *keySource {
+	return &e.keys
+}
+
+// newGCM 创建AES-GCM实例
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return gcm, nil
+}
+
 // GetMetadata 获取加密元数据
 func (e *AESEncryptor) GetMetadata() map[string]string {
+	if e.keys.isPassphrase() {
+		return map[string]string{
+			"algorithm":      AlgorithmAES.String(),
+			"key_size":       fmt.Sprintf("%d", passphraseKeySize*8),
+			"kdf":            e.keys.kdf.String(),
+			"format_version": fmt.Sprintf("%d", FormatVersion),
+		}
+	}
 	return map[string]string{
-		"algorithm": "AES-GCM",
-		"key_size":  fmt.Sprintf("%d", len(e.key)*8),
+		"algorithm":       AlgorithmAES.String(),
+		"key_size":        fmt.Sprintf("%d", len(e.keys.key)*8),
+		"key_fingerprint": FingerprintString(e.keys.key),
+		"format_version":  fmt.Sprintf("%d", FormatVersion),
 	}
 }
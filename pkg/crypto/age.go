@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// AgeEncryptor 生成和读取 age（age-encryption.org/v1）格式的加密器
+// 输出与独立的 age 工具完全兼容，即使没有 cryptobackup 也可以使用 age 恢复备份。
+// 支持 X25519 接收者（age1...）和 scrypt 口令两种方式。
+type AgeEncryptor struct {
+	recipients []age.Recipient // 加密使用的接收者
+	identities []age.Identity  // 解密使用的身份
+	mode       string          // 接收者类型（x25519 或 scrypt），记录在元数据中
+	publicKeys []string        // 接收者公钥（仅X25519），记录在元数据中
+}
+
+// ageMagic age 文件的开头
+var ageMagic = []byte("age-encryption.org/v1\n")
+
+// NewAgeEncryptor 根据逗号分隔的 age 密钥创建加密器
+// keys 可以包含接收者公钥（age1...，仅用于加密）和身份私钥（AGE-SECRET-KEY-1...，
+// 可以解密，加密时以其公钥作为接收者）
+func NewAgeEncryptor(keys string) (*AgeEncryptor, error) {
+	e := &AgeEncryptor{mode: "x25519"}
+	for _, field := range strings.Split(keys, ",") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+			continue
+		case strings.HasPrefix(field, "AGE-SECRET-KEY-1"):
+			identity, err := age.ParseX25519Identity(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid age identity: %w", err)
+			}
+			e.identities = append(e.identities, identity)
+			e.recipients = append(e.recipients, identity.Recipient())
+			e.publicKeys = append(e.publicKeys, identity.Recipient().String())
+		case strings.HasPrefix(field, "age1"):
+			recipient, err := age.ParseX25519Recipient(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid age recipient: %w", err)
+			}
+			e.recipients = append(e.recipients, recipient)
+			e.publicKeys = append(e.publicKeys, recipient.String())
+		default:
+			return nil, fmt.Errorf("invalid age key: must start with age1 or AGE-SECRET-KEY-1")
+		}
+	}
+
+	if len(e.recipients) == 0 {
+		return nil, fmt.Errorf("at least one age recipient or identity is required")
+	}
+	return e, nil
+}
+
+// NewAgeEncryptorWithPassphrase 创建使用 scrypt 口令的 age 加密器
+func NewAgeEncryptorWithPassphrase(passphrase string) (*AgeEncryptor, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scrypt recipient: %w", err)
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scrypt identity: %w", err)
+	}
+	return &AgeEncryptor{
+		recipients: []age.Recipient{recipient},
+		identities: []age.Identity{identity},
+		mode:       "scrypt",
+	}, nil
+}
+
+// GenerateAgeIdentity 生成 age X25519 身份，返回私钥和公钥字符串
+func GenerateAgeIdentity() (string, string, error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate age identity: %w", err)
+	}
+	return identity.String(), identity.Recipient().String(), nil
+}
+
+// AgeRecipient 返回 age 身份私钥对应的公钥字符串
+func AgeRecipient(identity string) (string, error) {
+	parsed, err := age.ParseX25519Identity(strings.TrimSpace(identity))
+	if err != nil {
+		return "", fmt.Errorf("invalid age identity: %w", err)
+	}
+	return parsed.Recipient().String(), nil
+}
+
+// Encrypt 使用 age 格式加密数据
+func (e *AgeEncryptor) Encrypt(src io.Reader, dst io.Writer) error {
+	w, err := age.Encrypt(dst, e.recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to create age writer: %w", err)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("failed to encrypt data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to finish age stream: %w", err)
+	}
+	return nil
+}
+
+// Decrypt 解密 age 格式数据
+func (e *AgeEncryptor) Decrypt(src io.Reader, dst io.Writer) error {
+	if len(e.identities) == 0 {
+		return fmt.Errorf("age identity or passphrase is required to decrypt")
+	}
+
+	r, err := age.Decrypt(src, e.identities...)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+	if _, err := io.Copy(dst, r); err != nil {
+		return fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	return nil
+}
+
+// GetMetadata 获取加密元数据
+func (e *AgeEncryptor) GetMetadata() map[string]string {
+	metadata := map[string]string{
+		"algorithm":      "age",
+		"age_recipients": e.mode,
+		"format_version": "age-encryption.org/v1",
+	}
+	if len(e.publicKeys) > 0 {
+		metadata["recipients"] = strings.Join(e.publicKeys, ",")
+	}
+	return metadata
+}
+
+// isAgeFormat 检查数据开头是否为 age 格式（不消耗数据）
+func isAgeFormat(r *bufio.Reader) bool {
+	magic, err := r.Peek(len(ageMagic))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(magic, ageMagic)
+}
@@ -0,0 +1,134 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestAgeDecryptsFilesFromAge(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := bytes.Repeat([]byte("written by the age library"), 4000)
+
+	var ciphertext bytes.Buffer
+	w, err := age.Encrypt(&ciphertext, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plaintext)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := NewAgeEncryptor(identity.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decryptForTest(dec, ciphertext.Bytes())
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Error("round trip mismatch")
+	}
+
+	// 其他身份不能解密
+	other, _, err := GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong, err := NewAgeEncryptor(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptForTest(wrong, ciphertext.Bytes()); err == nil {
+		t.Error("wrong identity decrypted the file")
+	}
+}
+
+func TestAgeOutputReadableByAge(t *testing.T) {
+	identity, recipient, err := GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只有公钥的加密器
+	enc, err := NewAgeEncryptor(recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := bytes.Repeat([]byte("read back by the age library"), 4000)
+	ciphertext := encryptForTest(t, enc, plaintext)
+
+	parsed, err := age.ParseX25519Identity(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), parsed)
+	if err != nil {
+		t.Fatalf("age.Decrypt: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Error("round trip mismatch")
+	}
+}
+
+func TestAgePassphraseInterop(t *testing.T) {
+	const passphrase = "correct horse battery staple"
+	plaintext := []byte("passphrase-protected age file")
+
+	enc, err := NewAgeEncryptorWithPassphrase(passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := encryptForTest(t, enc, plaintext)
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), identity)
+	if err != nil {
+		t.Fatalf("age.Decrypt: %v", err)
+	}
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, plaintext) {
+		t.Error("age could not read the passphrase file")
+	}
+
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient.SetWorkFactor(10)
+	var fromAge bytes.Buffer
+	w, err := age.Encrypt(&fromAge, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plaintext)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := decryptForTest(enc, fromAge.Bytes())
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Error("round trip mismatch")
+	}
+
+	wrong, err := NewAgeEncryptorWithPassphrase("wrong " + passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptForTest(wrong, fromAge.Bytes()); err == nil {
+		t.Error("wrong passphrase decrypted the file")
+	}
+}
@@ -0,0 +1,158 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// AutoDecryptor 根据数据头部自动选择算法的解密器
+// 在解密前会检查头部记录的密钥指纹，密钥错误时不会做任何解密工作。
+// 没有头部的旧版本数据使用 WithLegacyAlgorithm 指定的算法（通常来自元数据中的 algorithm 字段），
+// 未指定时按 AES-GCM 处理；使用口令加密的 age 格式数据也可以识别。
+type AutoDecryptor struct {
+	keys   keySource
+	legacy AlgorithmID // 没有头部的数据使用的算法，0 表示未知
+}
+
+// ErrLegacyFormat 数据没有头部，并且不知道加密时使用的算法
+var ErrLegacyFormat = errors.New("legacy file without header, please specify the algorithm with -algo")
+
+// NewAutoDecryptor 创建自动识别算法的解密器
+func NewAutoDecryptor(key []byte) (*AutoDecryptor, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("key cannot be empty")
+	}
+	return &AutoDecryptor{keys: keySource{key: key}}, nil
+}
+
+// NewAutoDecryptorWithPassphrase 创建使用口令、自动识别算法的解密器
+// 派生参数从文件头部读取
+func NewAutoDecryptorWithPassphrase(passphrase string) (*AutoDecryptor, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	return &AutoDecryptor{keys: keySource{passphrase: []byte(passphrase)}}, nil
+}
+
+// WithLegacyAlgorithm 返回对没有头部的旧版本数据使用指定算法的解密器
+// name 为元数据中 algorithm 字段的值（如 "XOR"、"AES-GCM"），无法识别的名称被忽略
+func (d *AutoDecryptor) WithLegacyAlgorithm(name string) *AutoDecryptor {
+	legacy := &AutoDecryptor{keys: d.keys}
+	for _, algo := range []AlgorithmID{AlgorithmAES, AlgorithmXOR, AlgorithmChaCha20, AlgorithmX25519} {
+		if algo.String() == name {
+			legacy.legacy = algo
+		}
+	}
+	return legacy
+}
+
+// Encrypt 自动识别模式无法加密，需要明确指定算法
+func (d *AutoDecryptor) Encrypt(src io.Reader, dst io.Writer) error {
+	return fmt.Errorf("cannot encrypt with automatic algorithm detection, please choose an algorithm")
+}
+
+// EncryptWithAAD 自动识别模式无法加密，需要明确指定算法
+func (d *AutoDecryptor) EncryptWithAAD(src io.Reader, dst io.Writer, aad []byte) error {
+	return d.Encrypt(src, dst)
+}
+
+// Decrypt 读取头部，选择对应的算法解密数据
+func (d *AutoDecryptor) Decrypt(src io.Reader, dst io.Writer) error {
+	return d.DecryptWithAAD(src, dst, nil)
+}
+
+// DecryptWithAAD 读取头部，选择对应的算法解密数据
+// 只有头部标记为绑定了附加数据的文件才会使用aad
+func (d *AutoDecryptor) DecryptWithAAD(src io.Reader, dst io.Writer, aad []byte) error {
+	r := bufio.NewReaderSize(src, maxHeaderSize)
+
+	// age 格式的文件由 age 自己的头部描述
+	if isAgeFormat(r) {
+		if !d.keys.isPassphrase() {
+			return fmt.Errorf("data is in age format, please provide an age identity")
+		}
+		decryptor, err := NewAgeEncryptorWithPassphrase(string(d.keys.passphrase))
+		if err != nil {
+			return err
+		}
+		return decryptor.Decrypt(r, dst)
+	}
+
+	header, err := PeekHeader(r)
+	if err != nil && err != ErrNoHeader {
+		return err
+	}
+
+	algo := AlgorithmAES
+	if header != nil {
+		algo = header.Algorithm
+	} else if d.keys.isPassphrase() {
+		return fmt.Errorf("data was not encrypted with a passphrase")
+	} else if d.legacy != 0 {
+		algo = d.legacy
+	}
+
+	key, err := d.keys.decryptionKey(header, passphraseKeySize)
+	if err != nil {
+		return err
+	}
+
+	decryptor, err := newDecryptor(algo, key)
+	if err != nil {
+		return err
+	}
+	if aadDecryptor, ok := decryptor.(AADEncryptor); ok {
+		err = aadDecryptor.DecryptWithAAD(r, dst, aad)
+	} else {
+		err = decryptor.Decrypt(r, dst)
+	}
+	// 没有头部也不知道算法时只是猜测为 AES-GCM，失败时提示指定算法（例如旧版本的 XOR 文件）
+	if err != nil && header == nil && d.legacy == 0 {
+		return fmt.Errorf("%w (tried %s: %v)", ErrLegacyFormat, algo, err)
+	}
+	return err
+}
+
+// GetMetadata 获取加密元数据
+func (d *AutoDecryptor) GetMetadata() map[string]string {
+	return map[string]string{
+		"algorithm": "auto",
+	}
+}
+
+// masterKeys 返回主密钥，用于 Rekey 解开数据密钥
+func (d *AutoDecryptor) masterKeys() *keySource {
+	return &d.keys
+}
+
+// PeekHeader 读取头部但不消耗数据，之后仍可从r读取完整密文
+// r 的缓冲区需要能容纳整个头部（bufio.NewReaderSize(src, 64*1024) 足够）
+func PeekHeader(r *bufio.Reader) (*Header, error) {
+	if !hasHeader(r) {
+		return nil, ErrNoHeader
+	}
+	data, err := r.Peek(r.Size())
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	return ReadHeader(bytes.NewReader(data))
+}
+
+// newDecryptor 根据头部中的算法编号创建加密器
+func newDecryptor(algo AlgorithmID, key []byte) (Encryptor, error) {
+	switch algo {
+	case AlgorithmAES:
+		return NewAESEncryptor(key)
+	case AlgorithmXOR:
+		return NewXOREncryptor(key)
+	case AlgorithmChaCha20:
+		return NewChaCha20Encryptor(key)
+	case AlgorithmX25519:
+		return NewX25519Decryptor(key)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm in header: %s", algo)
+	}
+}
@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// legacyXOR 生成没有头部的旧版本 XOR 密文
+func legacyXOR(key, plaintext []byte) []byte {
+	out := make([]byte, len(plaintext))
+	for i := range plaintext {
+		out[i] = plaintext[i] ^ key[i%len(key)]
+	}
+	return out
+}
+
+func TestAutoDecryptorLegacyXOR(t *testing.T) {
+	key := bytes.Repeat([]byte{0x5a}, 32)
+	plaintext := []byte("backup written before headers existed")
+	ciphertext := legacyXOR(key, plaintext)
+
+	auto, err := NewAutoDecryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不知道算法时按 AES-GCM 尝试，失败后提示指定算法
+	var out bytes.Buffer
+	err = auto.Decrypt(bytes.NewReader(ciphertext), &out)
+	if !errors.Is(err, ErrLegacyFormat) {
+		t.Fatalf("headerless XOR without algorithm: got %v, want ErrLegacyFormat", err)
+	}
+
+	out.Reset()
+	if err := auto.WithLegacyAlgorithm(AlgorithmXOR.String()).Decrypt(bytes.NewReader(ciphertext), &out); err != nil {
+		t.Fatalf("Decrypt with legacy algorithm: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), plaintext) {
+		t.Errorf("got %q, want %q", out.Bytes(), plaintext)
+	}
+}
+
+func TestAutoDecryptorHeaderOverridesLegacyAlgorithm(t *testing.T) {
+	key := bytes.Repeat([]byte{3}, 32)
+	enc, err := NewChaCha20Encryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ciphertext bytes.Buffer
+	if err := enc.Encrypt(bytes.NewReader([]byte("hello")), &ciphertext); err != nil {
+		t.Fatal(err)
+	}
+
+	auto, err := NewAutoDecryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := auto.WithLegacyAlgorithm(AlgorithmXOR.String()).Decrypt(&ciphertext, &out); err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if out.String() != "hello" {
+		t.Errorf("got %q, want hello", out.String())
+	}
+}
@@ -0,0 +1,150 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ChaCha20Encryptor 使用XChaCha20-Poly1305的加密器
+// 192位的随机nonce使得大量文件共用同一密钥时也不必担心nonce重复，
+// 并且在没有AES硬件指令的平台（如部分ARM设备）上比AES-GCM更快
+type ChaCha20Encryptor struct {
+	keys keySource
+}
+
+// NewChaCha20Encryptor 创建XChaCha20-Poly1305加密器
+// key: 密钥，必须是32字节
+func NewChaCha20Encryptor(key []byte) (*ChaCha20Encryptor, error) {
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("invalid key size: %d, must be %d bytes", len(key), chacha20poly1305.KeySize)
+	}
+	return &ChaCha20Encryptor{keys: keySource{key: key}}, nil
+}
+
+// NewChaCha20EncryptorWithPassphrase 创建使用口令的XChaCha20-Poly1305加密器
+func NewChaCha20EncryptorWithPassphrase(passphrase string, kdf KDFAlgorithm) (*ChaCha20Encryptor, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	if kdf == KDFNone {
+		kdf = KDFArgon2id
+	}
+	return &ChaCha20Encryptor{keys: keySource{passphrase: []byte(passphrase), kdf: kdf}}, nil
+}
+
+// Encrypt 使用XChaCha20-Poly1305分块加密数据
+// 数据使用随机生成的数据密钥加密，数据密钥由主密钥包装后保存在头部
+func (e *ChaCha20Encryptor) Encrypt(src io.Reader, dst io.Writer) error {
+	return e.EncryptWithAAD(src, dst, nil)
+}
+
+// EncryptWithAAD 使用XChaCha20-Poly1305分块加密数据，并将aad绑定为每块的附加认证数据
+func (e *ChaCha20Encryptor) EncryptWithAAD(src io.Reader, dst io.Writer, aad []byte) error {
+	kek, kdf, err := e.keys.encryptionKey(chacha20poly1305.KeySize)
+	if err != nil {
+		return err
+	}
+
+	dek, err := newDataKey(chacha20poly1305.KeySize)
+	if err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.NewX(dek)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	// 生成随机nonce前缀
+	prefix := make([]byte, noncePrefixSize(aead))
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header := &Header{
+		Algorithm:   AlgorithmChaCha20,
+		KDF:         kdf,
+		Fingerprint: KeyFingerprint(kek),
+		ChunkSize:   DefaultChunkSize,
+		NoncePrefix: prefix,
+		Bound:       aad != nil,
+	}
+	if err := header.wrapDataKey(kek, dek); err != nil {
+		return err
+	}
+	if err := WriteHeader(dst, header); err != nil {
+		return err
+	}
+
+	chunkAAD, err := header.chunkAAD(aad)
+	if err != nil {
+		return err
+	}
+	return sealStream(aead, prefix, DefaultChunkSize, chunkAAD, src, dst)
+}
+
+// Decrypt 使用XChaCha20-Poly1305解密数据
+func (e *ChaCha20Encryptor) Decrypt(src io.Reader, dst io.Writer) error {
+	return e.DecryptWithAAD(src, dst, nil)
+}
+
+// DecryptWithAAD 使用XChaCha20-Poly1305解密数据，aad必须与加密时绑定的一致
+func (e *ChaCha20Encryptor) DecryptWithAAD(src io.Reader, dst io.Writer, aad []byte) error {
+	r := bufio.NewReader(src)
+	header, err := ReadHeader(r)
+	if err != nil {
+		return err
+	}
+	if err := header.expect(AlgorithmChaCha20); err != nil {
+		return err
+	}
+	if header.ChunkSize == 0 {
+		return fmt.Errorf("missing stream parameters in header")
+	}
+
+	kek, err := e.keys.decryptionKey(header, chacha20poly1305.KeySize)
+	if err != nil {
+		return err
+	}
+	dek, err := header.unwrapDataKey(kek)
+	if err != nil {
+		return err
+	}
+
+	aead, err := chacha20poly1305.NewX(dek)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	if len(header.NoncePrefix) != noncePrefixSize(aead) {
+		return fmt.Errorf("invalid nonce prefix size: %d", len(header.NoncePrefix))
+	}
+
+	chunkAAD, err := header.chunkAAD(aad)
+	if err != nil {
+		return err
+	}
+	return openStream(aead, header.NoncePrefix, int(header.ChunkSize), chunkAAD, r, dst)
+}
+
+// masterKeys 返回包装数据密钥使用的主密钥
+func (e *ChaCha20Encryptor) masterKeys() *keySource {
+	return &e.keys
+}
+
+// GetMetadata 获取加密元数据
+func (e *ChaCha20Encryptor) GetMetadata() map[string]string {
+	metadata := map[string]string{
+		"algorithm":      AlgorithmChaCha20.String(),
+		"key_size":       fmt.Sprintf("%d", chacha20poly1305.KeySize*8),
+		"format_version": fmt.Sprintf("%d", FormatVersion),
+	}
+	if e.keys.isPassphrase() {
+		metadata["kdf"] = e.keys.kdf.String()
+	} else {
+		metadata["key_fingerprint"] = FingerprintString(e.keys.key)
+	}
+	return metadata
+}
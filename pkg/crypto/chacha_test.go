@@ -0,0 +1,86 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func newTestChaCha20(t *testing.T) *ChaCha20Encryptor {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	enc, err := NewChaCha20Encryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+func TestChaCha20RoundTrip(t *testing.T) {
+	enc := newTestChaCha20(t)
+	for _, size := range []int{0, 1, DefaultChunkSize, DefaultChunkSize + 1} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		ciphertext := encryptForTest(t, enc, plaintext)
+		h, err := ReadHeader(bytes.NewReader(ciphertext))
+		if err != nil {
+			t.Fatalf("size %d: ReadHeader: %v", size, err)
+		}
+		if h.Algorithm != AlgorithmChaCha20 {
+			t.Errorf("size %d: header algorithm %s", size, h.Algorithm)
+		}
+
+		got, err := decryptForTest(enc, ciphertext)
+		if err != nil {
+			t.Fatalf("size %d: Decrypt: %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: round trip mismatch", size)
+		}
+	}
+}
+
+func TestChaCha20WrongKey(t *testing.T) {
+	ciphertext := encryptForTest(t, newTestChaCha20(t), []byte("secret"))
+
+	got, err := decryptForTest(newTestChaCha20(t), ciphertext)
+	if !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("wrong key: got %v, want ErrKeyMismatch", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("wrong key: wrote %d bytes of output", len(got))
+	}
+
+	if _, err := NewChaCha20Encryptor(make([]byte, 16)); err == nil {
+		t.Error("16-byte key was accepted")
+	}
+}
+
+func TestChaCha20RejectsTampering(t *testing.T) {
+	enc := newTestChaCha20(t)
+	plaintext := bytes.Repeat([]byte("cryptobackup"), 100)
+	ciphertext := encryptForTest(t, enc, plaintext)
+	h, err := ReadHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerSize := len(h.Bytes())
+
+	for name, modify := range map[string]func([]byte) []byte{
+		"payload byte": func(b []byte) []byte { b[headerSize+10] ^= 1; return b },
+		"tag byte":     func(b []byte) []byte { b[len(b)-1] ^= 1; return b },
+		"truncated":    func(b []byte) []byte { return b[:len(b)-1] },
+		"appended":     func(b []byte) []byte { return append(b, 0) },
+		"header byte":  func(b []byte) []byte { b[headerSize-2] ^= 1; return b },
+	} {
+		tampered := modify(append([]byte{}, ciphertext...))
+		if got, err := decryptForTest(enc, tampered); err == nil {
+			t.Errorf("%s: tampered ciphertext was accepted (%d bytes)", name, len(got))
+		}
+	}
+}
@@ -18,9 +18,24 @@ type Encryptor interface {
 	GetMetadata() map[string]string
 }
 
+// AADEncryptor 支持外部附加认证数据的加密器（可选接口）
+// 附加数据不会写入输出，解密时必须提供与加密时相同的数据，否则解密失败。
+// 上传器使用它将密文与远程路径和关键元数据绑定，防止文件被调换或元数据被篡改
+type AADEncryptor interface {
+	Encryptor
+
+	// EncryptWithAAD 加密数据流，并将aad作为附加认证数据
+	EncryptWithAAD(src io.Reader, dst io.Writer, aad []byte) error
+
+	// DecryptWithAAD 解密数据流，aad必须与加密时一致
+	// 加密时没有绑定附加数据的文件会忽略aad
+	DecryptWithAAD(src io.Reader, dst io.Writer, aad []byte) error
+}
+
 // Config 加密配置
+// NewEncryptor 根据 Algorithm 查找通过 Register 注册的算法并创建加密器
 type Config struct {
 	Algorithm string                 // 加密算法名称
 	Key       []byte                 // 加密密钥
-	Options   map[string]interface{} // 额外选项
+	Options   map[string]interface{} // 额外选项，内置算法使用的选项见 OptionPassphrase 等常量
 }
@@ -1,12 +1,14 @@
 package crypto
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 )
 
 // XOREncryptor 简单的XOR加密器（仅作为自定义加密的示例）
-// 注意：XOR加密安全性较低，实际生产环境请使用更强的加密算法
+// 注意：XOR加密没有完整性保护，并且重复使用密钥作为密钥流，多个文件使用同一密钥时会泄露明文。
+// 上传器默认拒绝使用它加密新文件，已有的备份应使用 Uploader.Migrate 迁移到认证加密算法
 type XOREncryptor struct {
 	key []byte
 }
@@ -21,12 +23,33 @@ func NewXOREncryptor(key []byte) (*XOREncryptor, error) {
 
 // Encrypt 使用XOR加密数据
 func (e *XOREncryptor) Encrypt(src io.Reader, dst io.Writer) error {
+	header := &Header{
+		Algorithm:   AlgorithmXOR,
+		Fingerprint: KeyFingerprint(e.key),
+	}
+	if err := WriteHeader(dst, header); err != nil {
+		return err
+	}
 	return e.xorData(src, dst)
 }
 
 // Decrypt 使用XOR解密数据（XOR加密和解密操作相同）
+// 没有头部的旧版本数据直接解密
 func (e *XOREncryptor) Decrypt(src io.Reader, dst io.Writer) error {
-	return e.xorData(src, dst)
+	r := bufio.NewReader(src)
+	header, err := ReadHeader(r)
+	if err != nil && err != ErrNoHeader {
+		return err
+	}
+	if header != nil {
+		if err := header.expect(AlgorithmXOR); err != nil {
+			return err
+		}
+		if err := header.CheckKey(e.key); err != nil {
+			return err
+		}
+	}
+	return e.xorData(r, dst)
 }
 
 // xorData XOR数据处理
@@ -63,11 +86,18 @@ func (e *XOREncryptor) xorData(src io.Reader, dst io.Writer) error {
 // GetMetadata 获取加密元数据
 func (e *XOREncryptor) GetMetadata() map[string]string {
 	return map[string]string{
-		"algorithm": "XOR",
-		"key_size":  fmt.Sprintf("%d", len(e.key)),
+		"algorithm":       AlgorithmXOR.String(),
+		"key_size":        fmt.Sprintf("%d", len(e.key)),
+		"key_fingerprint": FingerprintString(e.key),
+		"format_version":  fmt.Sprintf("%d", FormatVersion),
 	}
 }
 
+// IsInsecure 检查元数据中的算法（algorithm 字段）是否不安全，不应再用于加密新文件
+func IsInsecure(algorithm string) bool {
+	return algorithm == AlgorithmXOR.String()
+}
+
 // CustomEncryptor 自定义加密器的基础结构
 // 用户可以继承这个结构并实现自己的加密逻辑
 type CustomEncryptor struct {
@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// 信封加密
+//
+// 每个文件使用随机生成的数据密钥（DEK）加密，数据密钥再由用户的主密钥（KEK，
+// 原始密钥或口令派生的密钥）包装后保存在头部的 WrappedKey 字段中：
+//
+//	WrappedKey = nonce(24) || XChaCha20-Poly1305(HKDF(KEK), DEK)
+//
+// 数据块的附加认证数据不包含密钥相关字段（见 Header.AAD），
+// 因此更换主密钥时只需重写头部（Rekey），无需重新加密数据。
+
+// envelopeWrapInfo 从主密钥派生包装密钥使用的HKDF info
+const envelopeWrapInfo = "cryptobackup envelope key wrap"
+
+// ErrNotEnvelope 数据没有使用信封加密（信封加密之前的文件），无法只更换主密钥
+var ErrNotEnvelope = errors.New("data does not use envelope encryption, re-upload it to change the key")
+
+// masterKeyHolder 持有主密钥、可以包装和解开数据密钥的加密器
+type masterKeyHolder interface {
+	masterKeys() *keySource
+}
+
+// newDataKey 生成随机数据密钥
+func newDataKey(size int) ([]byte, error) {
+	key := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
+
+// wrapDataKey 使用主密钥包装数据密钥并记录在头部
+// 除密钥字段以外的头部字段需要在调用前设置好，它们会作为包装的附加认证数据
+func (h *Header) wrapDataKey(kek, dek []byte) error {
+	aead, err := envelopeWrapCipher(kek)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	h.WrappedKey = aead.Seal(nonce, nonce, dek, h.envelopeAAD())
+	return nil
+}
+
+// unwrapDataKey 使用主密钥解开头部中的数据密钥
+// 没有包装数据密钥的文件直接使用主密钥加密数据
+func (h *Header) unwrapDataKey(kek []byte) ([]byte, error) {
+	if len(h.WrappedKey) == 0 {
+		return kek, nil
+	}
+
+	aead, err := envelopeWrapCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(h.WrappedKey) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("invalid wrapped key field")
+	}
+	nonce, sealed := h.WrappedKey[:aead.NonceSize()], h.WrappedKey[aead.NonceSize():]
+	dek, err := aead.Open(nil, nonce, sealed, h.envelopeAAD())
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dek, nil
+}
+
+// envelopeWrapCipher 从主密钥派生包装数据密钥使用的AEAD
+func envelopeWrapCipher(kek []byte) (cipher.AEAD, error) {
+	wrapKey, err := hkdf.Key(sha256.New, kek, nil, envelopeWrapInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive wrap key: %w", err)
+	}
+	aead, err := chacha20poly1305.NewX(wrapKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// Rekey 使用新的主密钥重新包装数据密钥
+// 只替换头部中的密钥字段（派生参数、指纹和包装后的数据密钥），之后的密文原样复制。
+// from 和 to 可以是 AES、XChaCha20 或自动识别的加密器，文件的加密算法保持不变。
+func Rekey(src io.Reader, dst io.Writer, from, to Encryptor) error {
+	oldHolder, ok := from.(masterKeyHolder)
+	if !ok {
+		return fmt.Errorf("encryptor %T does not support rekeying", from)
+	}
+	newHolder, ok := to.(masterKeyHolder)
+	if !ok {
+		return fmt.Errorf("encryptor %T does not support rekeying", to)
+	}
+
+	r := bufio.NewReader(src)
+	header, err := ReadHeader(r)
+	if err == ErrNoHeader {
+		return ErrNotEnvelope
+	}
+	if err != nil {
+		return err
+	}
+	if len(header.WrappedKey) == 0 {
+		return ErrNotEnvelope
+	}
+
+	kek, err := oldHolder.masterKeys().decryptionKey(header, passphraseKeySize)
+	if err != nil {
+		return err
+	}
+	dek, err := header.unwrapDataKey(kek)
+	if err != nil {
+		return err
+	}
+
+	newKEK, kdf, err := newHolder.masterKeys().encryptionKey(passphraseKeySize)
+	if err != nil {
+		return err
+	}
+	// 解密时会按文件的算法检查主密钥长度，不合适的新密钥会导致文件无法解密
+	if _, err := newDecryptor(header.Algorithm, newKEK); err != nil {
+		return fmt.Errorf("new key cannot be used with %s: %w", header.Algorithm, err)
+	}
+	header.KDF = kdf
+	header.Fingerprint = KeyFingerprint(newKEK)
+	if err := header.wrapDataKey(newKEK, dek); err != nil {
+		return err
+	}
+	if err := WriteHeader(dst, header); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, r); err != nil {
+		return fmt.Errorf("failed to copy encrypted data: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// splitHeader 返回密文的头部长度，用于比较头部之后的数据
+func splitHeader(t *testing.T, ciphertext []byte) int {
+	t.Helper()
+	h, err := ReadHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(h.Bytes())
+}
+
+func TestRekeyRewrapsDataKeyOnly(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	plaintext := bytes.Repeat([]byte("envelope"), DefaultChunkSize/4)
+
+	constructors := map[string]func([]byte) (Encryptor, error){
+		"aes":      func(k []byte) (Encryptor, error) { return NewAESEncryptor(k) },
+		"chacha20": func(k []byte) (Encryptor, error) { return NewChaCha20Encryptor(k) },
+	}
+	for name, newEncryptor := range constructors {
+		from, err := newEncryptor(oldKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		to, err := newEncryptor(newKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ciphertext := encryptForTest(t, from, plaintext)
+		var rekeyed bytes.Buffer
+		if err := Rekey(bytes.NewReader(ciphertext), &rekeyed, from, to); err != nil {
+			t.Fatalf("%s: Rekey: %v", name, err)
+		}
+
+		// 数据块原样复制，只有头部改变
+		oldPayload := ciphertext[splitHeader(t, ciphertext):]
+		newPayload := rekeyed.Bytes()[splitHeader(t, rekeyed.Bytes()):]
+		if !bytes.Equal(oldPayload, newPayload) {
+			t.Errorf("%s: Rekey rewrote the encrypted payload", name)
+		}
+
+		got, err := decryptForTest(to, rekeyed.Bytes())
+		if err != nil {
+			t.Fatalf("%s: decrypt with new key: %v", name, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+		if _, err := decryptForTest(from, rekeyed.Bytes()); !errors.Is(err, ErrKeyMismatch) {
+			t.Errorf("%s: old key after rekey: got %v, want ErrKeyMismatch", name, err)
+		}
+	}
+}
+
+func TestRekeyPassphraseToKey(t *testing.T) {
+	from, err := NewAESEncryptorWithPassphrase("old passphrase", KDFScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := NewAESEncryptor(bytes.Repeat([]byte{3}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("moved from a passphrase to a key file")
+	ciphertext := encryptForTest(t, from, plaintext)
+
+	var rekeyed bytes.Buffer
+	if err := Rekey(bytes.NewReader(ciphertext), &rekeyed, from, to); err != nil {
+		t.Fatalf("Rekey: %v", err)
+	}
+	h, err := ReadHeader(bytes.NewReader(rekeyed.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.KDF != nil && h.KDF.Algorithm != KDFNone {
+		t.Errorf("rekeyed header still records KDF %s", h.KDF.Algorithm)
+	}
+	if got, err := decryptForTest(to, rekeyed.Bytes()); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("decrypt with new key: %q, %v", got, err)
+	}
+	if _, err := decryptForTest(from, rekeyed.Bytes()); err == nil {
+		t.Error("old passphrase still decrypts after rekey")
+	}
+}
+
+func TestRekeyRejectsWrongKeyAndHeaderless(t *testing.T) {
+	right, _ := NewAESEncryptor(bytes.Repeat([]byte{1}, 32))
+	wrong, _ := NewAESEncryptor(bytes.Repeat([]byte{9}, 32))
+	to, _ := NewAESEncryptor(bytes.Repeat([]byte{2}, 32))
+	ciphertext := encryptForTest(t, right, []byte("data"))
+
+	var out bytes.Buffer
+	if err := Rekey(bytes.NewReader(ciphertext), &out, wrong, to); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("rekey with the wrong current key: got %v, want ErrKeyMismatch", err)
+	}
+	if err := Rekey(bytes.NewReader([]byte("no header here")), &out, right, to); !errors.Is(err, ErrNotEnvelope) {
+		t.Errorf("headerless data: got %v, want ErrNotEnvelope", err)
+	}
+}
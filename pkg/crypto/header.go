@@ -0,0 +1,427 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 加密文件头部格式（第2版）
+//
+//	magic(8) || version(1) || algorithm(1) || 字段... || 结束标记(1)
+//
+// 每个字段为 tag(1) || length(uint16) || value，结束标记为 tag 0。
+// 头部会作为AEAD算法的附加认证数据，任何修改都会导致解密失败；
+// 信封加密的文件中，密钥相关字段由包装后的数据密钥自身认证（见 envelope.go）。
+
+const (
+	// FormatVersion 当前写入的头部格式版本
+	FormatVersion = 2
+
+	// streamVersion1 第一版格式，仅用于AES-GCM分块加密：
+	// magic(8) || version(1) || chunkSize(uint32) || noncePrefix(7)
+	streamVersion1 = 1
+
+	// maxHeaderSize 头部允许的最大长度
+	maxHeaderSize = 64 * 1024
+
+	// fingerprintSize 密钥指纹长度
+	fingerprintSize = 8
+)
+
+// 头部字段标记
+const (
+	tagEnd         = 0 // 字段结束
+	tagKDF         = 1 // 密钥派生参数
+	tagFingerprint = 2 // 密钥指纹
+	tagStream      = 3 // 分块参数（分块大小 || nonce前缀）
+	tagRecipients  = 4 // 公钥接收者（数量 || (临时公钥 || 包装后的数据密钥)...）
+	tagWrappedKey  = 5 // 主密钥包装的数据密钥（信封加密）
+	tagBound       = 6 // 数据块绑定了外部附加数据（空值）
+)
+
+var (
+	// formatMagic 加密文件魔数
+	formatMagic = []byte("CRYPTBAK")
+
+	// ErrNoHeader 数据不包含头部（旧版本生成的文件）
+	ErrNoHeader = errors.New("data has no cryptobackup header")
+
+	// ErrKeyMismatch 密钥指纹与文件头部记录的不一致
+	ErrKeyMismatch = errors.New("key fingerprint mismatch: wrong key")
+
+	// ErrAADRequired 数据绑定了外部附加数据（如远程路径），解密时必须提供
+	ErrAADRequired = errors.New("data is bound to its remote path and metadata, associated data is required")
+)
+
+// AlgorithmID 头部中记录的算法编号
+type AlgorithmID uint8
+
+// 已知的算法编号
+const (
+	AlgorithmAES      AlgorithmID = 1 // AES-GCM
+	AlgorithmXOR      AlgorithmID = 2 // XOR
+	AlgorithmChaCha20 AlgorithmID = 3 // XChaCha20-Poly1305
+	AlgorithmX25519   AlgorithmID = 4 // X25519 + XChaCha20-Poly1305
+)
+
+// String 返回算法名称（与 GetMetadata 中的 algorithm 字段一致）
+func (a AlgorithmID) String() string {
+	switch a {
+	case AlgorithmAES:
+		return "AES-GCM"
+	case AlgorithmXOR:
+		return "XOR"
+	case AlgorithmChaCha20:
+		return "XChaCha20-Poly1305"
+	case AlgorithmX25519:
+		return "X25519"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(a))
+	}
+}
+
+// KDFAlgorithm 密钥派生算法编号
+type KDFAlgorithm uint8
+
+// KDFNone 表示直接使用原始密钥
+const KDFNone KDFAlgorithm = 0
+
+// KDFParams 密钥派生参数
+type KDFParams struct {
+	Algorithm KDFAlgorithm // 派生算法
+	Salt      []byte       // 盐
+	Time      uint32       // 时间开销（迭代次数）
+	Memory    uint32       // 内存开销
+	Threads   uint8        // 并行度
+}
+
+// Header 加密文件头部
+type Header struct {
+	Version     uint8             // 格式版本
+	Algorithm   AlgorithmID       // 加密算法
+	KDF         *KDFParams        // 密钥派生参数，nil 表示直接使用原始密钥
+	Fingerprint []byte            // 密钥指纹，用于在解密前识别错误的密钥
+	ChunkSize   uint32            // 分块大小（仅分块AEAD算法）
+	NoncePrefix []byte            // nonce前缀（仅分块AEAD算法）
+	Recipients  []RecipientStanza // 公钥接收者（仅X25519）
+	WrappedKey  []byte            // 主密钥包装的数据密钥（信封加密）
+	Bound       bool              // 数据块是否绑定了外部附加数据
+
+	raw []byte // 读取或写入时的原始字节
+}
+
+// Bytes 返回头部的原始字节
+func (h *Header) Bytes() []byte {
+	return h.raw
+}
+
+// AAD 返回数据块使用的附加认证数据
+// 信封加密的文件不包含密钥相关字段，更换主密钥后数据块仍然可以解密；
+// 其他文件使用头部的原始字节
+func (h *Header) AAD() []byte {
+	if len(h.WrappedKey) == 0 {
+		return h.raw
+	}
+	return h.envelopeAAD()
+}
+
+// chunkAAD 返回数据块的附加认证数据
+// 绑定了外部附加数据的文件为 AAD() || external，external 为 nil 时返回 ErrAADRequired
+func (h *Header) chunkAAD(external []byte) ([]byte, error) {
+	if !h.Bound {
+		return h.AAD(), nil
+	}
+	if external == nil {
+		return nil, ErrAADRequired
+	}
+	return append(append([]byte{}, h.AAD()...), external...), nil
+}
+
+// envelopeAAD 序列化去掉密钥相关字段（派生参数、指纹、包装后的数据密钥）的头部
+func (h *Header) envelopeAAD() []byte {
+	stripped := *h
+	stripped.KDF = nil
+	stripped.Fingerprint = nil
+	stripped.WrappedKey = nil
+	// 去掉字段后不会超过长度限制，marshal 不会失败
+	raw, _ := stripped.marshal()
+	return raw
+}
+
+// CheckKey 检查密钥是否与头部记录的指纹一致
+// 头部没有记录指纹时（如旧版本文件）直接通过
+func (h *Header) CheckKey(key []byte) error {
+	if len(h.Fingerprint) == 0 {
+		return nil
+	}
+	if !hmac.Equal(h.Fingerprint, KeyFingerprint(key)) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// marshal 序列化头部
+func (h *Header) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(formatMagic)
+	buf.WriteByte(FormatVersion)
+	buf.WriteByte(byte(h.Algorithm))
+
+	if h.KDF != nil && h.KDF.Algorithm != KDFNone {
+		if len(h.KDF.Salt) > 255 {
+			return nil, fmt.Errorf("kdf salt too long: %d", len(h.KDF.Salt))
+		}
+		value := []byte{byte(h.KDF.Algorithm), byte(len(h.KDF.Salt))}
+		value = append(value, h.KDF.Salt...)
+		value = binary.BigEndian.AppendUint32(value, h.KDF.Time)
+		value = binary.BigEndian.AppendUint32(value, h.KDF.Memory)
+		value = append(value, h.KDF.Threads)
+		writeField(&buf, tagKDF, value)
+	}
+	if len(h.Fingerprint) > 0 {
+		writeField(&buf, tagFingerprint, h.Fingerprint)
+	}
+	if h.ChunkSize > 0 {
+		value := binary.BigEndian.AppendUint32(nil, h.ChunkSize)
+		value = append(value, h.NoncePrefix...)
+		writeField(&buf, tagStream, value)
+	}
+	if len(h.Recipients) > 0 {
+		if len(h.Recipients) > 255 {
+			return nil, fmt.Errorf("too many recipients: %d", len(h.Recipients))
+		}
+		value := []byte{byte(len(h.Recipients))}
+		for _, r := range h.Recipients {
+			value = append(value, r.Ephemeral...)
+			value = append(value, r.WrappedKey...)
+		}
+		writeField(&buf, tagRecipients, value)
+	}
+	if len(h.WrappedKey) > 0 {
+		writeField(&buf, tagWrappedKey, h.WrappedKey)
+	}
+	if h.Bound {
+		writeField(&buf, tagBound, nil)
+	}
+
+	buf.WriteByte(tagEnd)
+	if buf.Len() > maxHeaderSize {
+		return nil, fmt.Errorf("header too large: %d bytes", buf.Len())
+	}
+	return buf.Bytes(), nil
+}
+
+// writeField 写入一个头部字段
+func writeField(buf *bytes.Buffer, tag byte, value []byte) {
+	buf.WriteByte(tag)
+	binary.Write(buf, binary.BigEndian, uint16(len(value)))
+	buf.Write(value)
+}
+
+// WriteHeader 将头部写入dst，写入后 h.Bytes() 返回序列化结果
+func WriteHeader(dst io.Writer, h *Header) error {
+	raw, err := h.marshal()
+	if err != nil {
+		return err
+	}
+	if _, err := dst.Write(raw); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	h.Version = FormatVersion
+	h.raw = raw
+	return nil
+}
+
+// ReadHeader 从src读取头部
+// 数据不以魔数开头时返回 ErrNoHeader；如需在此情况下继续读取原始数据，
+// 请传入 *bufio.Reader，魔数不匹配时不会消耗任何数据
+func ReadHeader(src io.Reader) (*Header, error) {
+	r, ok := src.(*bufio.Reader)
+	if !ok {
+		r = bufio.NewReader(src)
+	}
+	if !hasHeader(r) {
+		return nil, ErrNoHeader
+	}
+
+	raw := make([]byte, len(formatMagic)+1)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	switch version := raw[len(formatMagic)]; version {
+	case streamVersion1:
+		return readHeaderV1(r, raw)
+	case FormatVersion:
+		return readHeaderV2(r, raw)
+	default:
+		return nil, fmt.Errorf("unsupported format version: %d", version)
+	}
+}
+
+// readHeaderV1 读取第一版头部（仅AES-GCM分块格式，无算法和指纹字段）
+func readHeaderV1(r io.Reader, raw []byte) (*Header, error) {
+	rest := make([]byte, 4+aesNoncePrefixSize)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	h := &Header{
+		Version:     streamVersion1,
+		Algorithm:   AlgorithmAES,
+		ChunkSize:   binary.BigEndian.Uint32(rest[:4]),
+		NoncePrefix: rest[4:],
+		raw:         append(raw, rest...),
+	}
+	if err := h.validateStream(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// readHeaderV2 读取第二版头部
+func readHeaderV2(r io.Reader, raw []byte) (*Header, error) {
+	h := &Header{Version: FormatVersion}
+
+	algo := make([]byte, 1)
+	if _, err := io.ReadFull(r, algo); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	h.Algorithm = AlgorithmID(algo[0])
+	raw = append(raw, algo...)
+
+	// 同一字段出现多次时拒绝整个头部，避免不同解析器对头部内容产生分歧
+	seen := make(map[byte]bool)
+	for {
+		tag := make([]byte, 1)
+		if _, err := io.ReadFull(r, tag); err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		raw = append(raw, tag...)
+		if tag[0] == tagEnd {
+			break
+		}
+		if seen[tag[0]] {
+			return nil, fmt.Errorf("duplicate header field: %d", tag[0])
+		}
+		seen[tag[0]] = true
+
+		length := make([]byte, 2)
+		if _, err := io.ReadFull(r, length); err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		value := make([]byte, binary.BigEndian.Uint16(length))
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		raw = append(append(raw, length...), value...)
+		if len(raw) > maxHeaderSize {
+			return nil, fmt.Errorf("header too large")
+		}
+
+		if err := h.parseField(tag[0], value); err != nil {
+			return nil, err
+		}
+	}
+
+	h.raw = raw
+	if h.ChunkSize > 0 {
+		if err := h.validateStream(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// parseField 解析单个头部字段
+func (h *Header) parseField(tag byte, value []byte) error {
+	switch tag {
+	case tagKDF:
+		if len(value) < 2 || len(value) != 2+int(value[1])+9 {
+			return fmt.Errorf("invalid kdf field")
+		}
+		saltEnd := 2 + int(value[1])
+		h.KDF = &KDFParams{
+			Algorithm: KDFAlgorithm(value[0]),
+			Salt:      value[2:saltEnd],
+			Time:      binary.BigEndian.Uint32(value[saltEnd:]),
+			Memory:    binary.BigEndian.Uint32(value[saltEnd+4:]),
+			Threads:   value[saltEnd+8],
+		}
+	case tagFingerprint:
+		h.Fingerprint = value
+	case tagStream:
+		if len(value) < 4 {
+			return fmt.Errorf("invalid stream field")
+		}
+		h.ChunkSize = binary.BigEndian.Uint32(value[:4])
+		h.NoncePrefix = value[4:]
+	case tagRecipients:
+		const stanzaSize = x25519KeySize + wrappedKeySize
+		if len(value) < 1 || len(value) != 1+int(value[0])*stanzaSize {
+			return fmt.Errorf("invalid recipients field")
+		}
+		for i := 0; i < int(value[0]); i++ {
+			stanza := value[1+i*stanzaSize : 1+(i+1)*stanzaSize]
+			h.Recipients = append(h.Recipients, RecipientStanza{
+				Ephemeral:  stanza[:x25519KeySize],
+				WrappedKey: stanza[x25519KeySize:],
+			})
+		}
+	case tagWrappedKey:
+		h.WrappedKey = value
+	case tagBound:
+		if len(value) != 0 {
+			return fmt.Errorf("invalid bound field")
+		}
+		h.Bound = true
+	default:
+		return fmt.Errorf("unknown header field: %d", tag)
+	}
+	return nil
+}
+
+// validateStream 检查分块参数是否合法
+func (h *Header) validateStream() error {
+	if h.ChunkSize == 0 || h.ChunkSize > maxChunkSize {
+		return fmt.Errorf("invalid chunk size: %d", h.ChunkSize)
+	}
+	return nil
+}
+
+// expect 检查头部记录的算法是否与当前加密器一致
+func (h *Header) expect(algo AlgorithmID) error {
+	if h.Algorithm != algo {
+		return fmt.Errorf("data was encrypted with %s, not %s", h.Algorithm, algo)
+	}
+	return nil
+}
+
+// hasHeader 检查数据开头是否为头部魔数（不消耗数据）
+func hasHeader(r *bufio.Reader) bool {
+	magic, err := r.Peek(len(formatMagic))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(magic, formatMagic)
+}
+
+// KeyFingerprint 计算密钥指纹
+// 指纹是密钥的HMAC摘要截断，可以公开保存而不泄露密钥
+func KeyFingerprint(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("cryptobackup key fingerprint"))
+	return mac.Sum(nil)[:fingerprintSize]
+}
+
+// FingerprintString 返回密钥指纹的十六进制表示
+func FingerprintString(key []byte) string {
+	return hex.EncodeToString(KeyFingerprint(key))
+}
@@ -0,0 +1,29 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadHeaderRejectsDuplicateField(t *testing.T) {
+	h := &Header{Algorithm: AlgorithmAES, Fingerprint: bytes.Repeat([]byte{1}, fingerprintSize)}
+	raw, err := h.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadHeader(bytes.NewReader(raw)); err != nil {
+		t.Fatalf("ReadHeader: %v", err)
+	}
+
+	// 在结束标记前再追加一个指纹字段
+	var dup bytes.Buffer
+	dup.Write(raw[:len(raw)-1])
+	writeField(&dup, tagFingerprint, bytes.Repeat([]byte{2}, fingerprintSize))
+	dup.WriteByte(tagEnd)
+
+	_, err = ReadHeader(bytes.NewReader(dup.Bytes()))
+	if err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Fatalf("duplicate field: got %v, want duplicate header field error", err)
+	}
+}
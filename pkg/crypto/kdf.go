@@ -0,0 +1,162 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// 支持的密钥派生算法
+const (
+	KDFArgon2id KDFAlgorithm = 1 // Argon2id：Time为迭代次数，Memory单位为KiB，Threads为并行度
+	KDFScrypt   KDFAlgorithm = 2 // scrypt：Time为log2(N)，Memory为r，Threads为p
+)
+
+const (
+	// kdfSaltSize 派生密钥使用的盐长度
+	kdfSaltSize = 16
+
+	// 解密时允许的最大开销，防止恶意头部耗尽资源
+	// 派生参数来自不可信的文件头部，上限只略高于 NewKDFParams 写入的默认值
+	maxArgon2Time    = 10
+	maxArgon2Memory  = 1024 * 1024 // 1 GiB（单位KiB）
+	maxScryptLogN    = 20
+	maxScryptMemory  = 1 << 30 // 1 GiB，scrypt占用内存为 128*r*N 字节
+	maxScryptRTimesP = 1 << 10
+)
+
+// String 返回派生算法名称
+func (k KDFAlgorithm) String() string {
+	switch k {
+	case KDFNone:
+		return "none"
+	case KDFArgon2id:
+		return "argon2id"
+	case KDFScrypt:
+		return "scrypt"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(k))
+	}
+}
+
+// ParseKDFAlgorithm 根据名称解析派生算法
+func ParseKDFAlgorithm(name string) (KDFAlgorithm, error) {
+	switch name {
+	case "argon2id", "":
+		return KDFArgon2id, nil
+	case "scrypt":
+		return KDFScrypt, nil
+	default:
+		return KDFNone, fmt.Errorf("unsupported kdf: %s", name)
+	}
+}
+
+// NewKDFParams 使用默认开销和随机盐创建派生参数
+func NewKDFParams(algo KDFAlgorithm) (*KDFParams, error) {
+	salt := make([]byte, kdfSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	switch algo {
+	case KDFArgon2id:
+		// RFC 9106 推荐参数：t=3, m=64MiB, p=4
+		return &KDFParams{Algorithm: algo, Salt: salt, Time: 3, Memory: 64 * 1024, Threads: 4}, nil
+	case KDFScrypt:
+		return &KDFParams{Algorithm: algo, Salt: salt, Time: 17, Memory: 8, Threads: 1}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kdf: %s", algo)
+	}
+}
+
+// DeriveKey 使用口令和派生参数计算密钥
+func DeriveKey(passphrase []byte, params *KDFParams, keyLen int) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	if params == nil {
+		return nil, fmt.Errorf("missing kdf parameters")
+	}
+	if len(params.Salt) < 8 {
+		return nil, fmt.Errorf("kdf salt too short: %d", len(params.Salt))
+	}
+
+	switch params.Algorithm {
+	case KDFArgon2id:
+		if params.Time == 0 || params.Time > maxArgon2Time ||
+			params.Memory == 0 || params.Memory > maxArgon2Memory || params.Threads == 0 {
+			return nil, fmt.Errorf("invalid argon2id parameters: t=%d m=%d p=%d", params.Time, params.Memory, params.Threads)
+		}
+		return argon2.IDKey(passphrase, params.Salt, params.Time, params.Memory, params.Threads, uint32(keyLen)), nil
+
+	case KDFScrypt:
+		if params.Time < 1 || params.Time > maxScryptLogN ||
+			params.Memory == 0 || params.Threads == 0 || params.Memory*uint32(params.Threads) > maxScryptRTimesP ||
+			uint64(128)*uint64(params.Memory)<<params.Time > maxScryptMemory {
+			return nil, fmt.Errorf("invalid scrypt parameters: logN=%d r=%d p=%d", params.Time, params.Memory, params.Threads)
+		}
+		key, err := scrypt.Key(passphrase, params.Salt, 1<<params.Time, int(params.Memory), int(params.Threads), keyLen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive key: %w", err)
+		}
+		return key, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported kdf: %s", params.Algorithm)
+	}
+}
+
+// keySource 加密器的密钥来源：原始密钥或口令
+type keySource struct {
+	key        []byte       // 原始密钥
+	passphrase []byte       // 口令（口令模式）
+	kdf        KDFAlgorithm // 口令模式下加密时使用的派生算法
+}
+
+// isPassphrase 是否为口令模式
+func (k *keySource) isPassphrase() bool {
+	return len(k.passphrase) > 0
+}
+
+// encryptionKey 返回加密使用的密钥，以及需要写入头部的派生参数
+// 口令模式下每次加密都会生成新的随机盐
+func (k *keySource) encryptionKey(keyLen int) ([]byte, *KDFParams, error) {
+	if !k.isPassphrase() {
+		return k.key, nil, nil
+	}
+
+	params, err := NewKDFParams(k.kdf)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := DeriveKey(k.passphrase, params, keyLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, params, nil
+}
+
+// decryptionKey 根据头部记录的派生参数返回解密使用的密钥，并检查密钥指纹
+func (k *keySource) decryptionKey(h *Header, keyLen int) ([]byte, error) {
+	key := k.key
+	if k.isPassphrase() {
+		if h == nil || h.KDF == nil || h.KDF.Algorithm == KDFNone {
+			return nil, fmt.Errorf("data was not encrypted with a passphrase")
+		}
+		derived, err := DeriveKey(k.passphrase, h.KDF, keyLen)
+		if err != nil {
+			return nil, err
+		}
+		key = derived
+	}
+
+	if h != nil {
+		if err := h.CheckKey(key); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
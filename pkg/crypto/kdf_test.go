@@ -0,0 +1,135 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDeriveKeyRejectsExcessiveCost(t *testing.T) {
+	salt := make([]byte, kdfSaltSize)
+	for _, params := range []*KDFParams{
+		{Algorithm: KDFArgon2id, Salt: salt, Time: maxArgon2Time + 1, Memory: 64 * 1024, Threads: 4},
+		{Algorithm: KDFArgon2id, Salt: salt, Time: 3, Memory: maxArgon2Memory + 1, Threads: 4},
+		{Algorithm: KDFScrypt, Salt: salt, Time: maxScryptLogN + 1, Memory: 8, Threads: 1},
+		{Algorithm: KDFScrypt, Salt: salt, Time: 20, Memory: 16, Threads: 1},
+	} {
+		if _, err := DeriveKey([]byte("passphrase"), params, 32); err == nil {
+			t.Errorf("%s t=%d m=%d p=%d was accepted", params.Algorithm, params.Time, params.Memory, params.Threads)
+		}
+	}
+
+	for _, algo := range []KDFAlgorithm{KDFArgon2id, KDFScrypt} {
+		params, err := NewKDFParams(algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DeriveKey([]byte("passphrase"), params, 32); err != nil {
+			t.Errorf("default %s parameters rejected: %v", algo, err)
+		}
+	}
+}
+
+// encryptForTest 使用加密器加密数据
+func encryptForTest(t *testing.T, enc Encryptor, plaintext []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := enc.Encrypt(bytes.NewReader(plaintext), &out); err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	return out.Bytes()
+}
+
+// decryptForTest 使用加密器解密数据
+func decryptForTest(enc Encryptor, ciphertext []byte) ([]byte, error) {
+	var out bytes.Buffer
+	err := enc.Decrypt(bytes.NewReader(ciphertext), &out)
+	return out.Bytes(), err
+}
+
+func TestDeriveKeyDeterministic(t *testing.T) {
+	for _, algo := range []KDFAlgorithm{KDFArgon2id, KDFScrypt} {
+		params, err := NewKDFParams(algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := DeriveKey([]byte("passphrase"), params, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := DeriveKey([]byte("passphrase"), params, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) || len(a) != 32 {
+			t.Errorf("%s: same passphrase and parameters derived different keys", algo)
+		}
+
+		other, err := DeriveKey([]byte("passphrasf"), params, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(a, other) {
+			t.Errorf("%s: different passphrases derived the same key", algo)
+		}
+
+		salted := *params
+		salted.Salt = append([]byte{}, params.Salt...)
+		salted.Salt[0] ^= 1
+		if c, _ := DeriveKey([]byte("passphrase"), &salted, 32); bytes.Equal(a, c) {
+			t.Errorf("%s: different salts derived the same key", algo)
+		}
+
+		if _, err := DeriveKey(nil, params, 32); err == nil {
+			t.Errorf("%s: empty passphrase was accepted", algo)
+		}
+	}
+}
+
+func TestPassphraseRoundTrip(t *testing.T) {
+	plaintext := []byte("backup encrypted with a passphrase")
+	constructors := map[string]func(string, KDFAlgorithm) (Encryptor, error){
+		"aes": func(p string, kdf KDFAlgorithm) (Encryptor, error) { return NewAESEncryptorWithPassphrase(p, kdf) },
+		"chacha20": func(p string, kdf KDFAlgorithm) (Encryptor, error) {
+			return NewChaCha20EncryptorWithPassphrase(p, kdf)
+		},
+	}
+
+	for name, newEncryptor := range constructors {
+		for _, algo := range []KDFAlgorithm{KDFArgon2id, KDFScrypt} {
+			enc, err := newEncryptor("correct horse battery staple", algo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ciphertext := encryptForTest(t, enc, plaintext)
+
+			// 派生参数和随机盐记录在头部，相同口令的两次加密使用不同的盐
+			h, err := ReadHeader(bytes.NewReader(ciphertext))
+			if err != nil {
+				t.Fatalf("%s/%s: ReadHeader: %v", name, algo, err)
+			}
+			if h.KDF == nil || h.KDF.Algorithm != algo {
+				t.Errorf("%s/%s: header KDF = %+v", name, algo, h.KDF)
+			}
+			if again := encryptForTest(t, enc, plaintext); bytes.Equal(ciphertext, again) {
+				t.Errorf("%s/%s: two encryptions produced the same ciphertext", name, algo)
+			}
+
+			got, err := decryptForTest(enc, ciphertext)
+			if err != nil {
+				t.Fatalf("%s/%s: Decrypt: %v", name, algo, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("%s/%s: round trip mismatch", name, algo)
+			}
+
+			wrong, err := newEncryptor("correct horse battery stapler", algo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := decryptForTest(wrong, ciphertext); !errors.Is(err, ErrKeyMismatch) || len(got) != 0 {
+				t.Errorf("%s/%s: wrong passphrase: got %d bytes, error %v; want ErrKeyMismatch", name, algo, len(got), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// 元数据加密格式
+//
+//	magic(8) || salt(16) || nonce(24) || XChaCha20-Poly1305(metaKey, 元数据)
+//
+// 元数据很小但数量多（每个文件一个 .meta），逐个使用完整的文件格式加密时，
+// 口令模式下每个文件都要运行一次Argon2id。元数据加密器创建时生成随机盐，
+// 元数据密钥由主密钥和该盐派生（原始密钥通过HKDF；口令先使用Argon2id，再通过HKDF），
+// 同一加密器加密的所有元数据共用一个盐。盐像文件头部中的KDF盐一样公开保存在密文前面，
+// 解密时按密文中的盐派生密钥并缓存，每个盐只派生一次。
+
+const (
+	// metadataKeyInfo 派生元数据密钥使用的HKDF info
+	metadataKeyInfo = "cryptobackup metadata encryption"
+
+	// metadataSaltSize 元数据密钥盐的长度
+	metadataSaltSize = 16
+)
+
+// metadataMagic 元数据密文的魔数，与文件头部魔数不同
+var metadataMagic = []byte("CBMETA01")
+
+// ErrNoMetadataKey 加密器没有对称主密钥（如只有接收者公钥），无法派生元数据密钥
+var ErrNoMetadataKey = errors.New("encryptor has no symmetric master key to derive a metadata key from")
+
+// MetadataCipher 使用从主密钥派生的密钥加密元数据
+type MetadataCipher struct {
+	keys *keySource
+	salt []byte // 加密使用的盐
+
+	mu    sync.Mutex
+	cache map[string]cipher.AEAD // 按盐缓存的元数据密钥
+}
+
+// NewMetadataCipher 根据加密器的主密钥创建元数据加密器，并生成加密使用的随机盐
+// 密钥在第一次加密或解密时派生。相同主密钥的AES、XChaCha20和自动识别加密器
+// 可以解密彼此的元数据；不持有对称主密钥的加密器返回 ErrNoMetadataKey
+func NewMetadataCipher(enc Encryptor) (*MetadataCipher, error) {
+	holder, ok := enc.(masterKeyHolder)
+	if !ok {
+		return nil, ErrNoMetadataKey
+	}
+	keys := holder.masterKeys()
+	if !keys.isPassphrase() && len(keys.key) == 0 {
+		return nil, ErrNoMetadataKey
+	}
+
+	salt := make([]byte, metadataSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return &MetadataCipher{keys: keys, salt: salt, cache: make(map[string]cipher.AEAD)}, nil
+}
+
+// Seal 加密元数据，aad 作为附加认证数据
+func (c *MetadataCipher) Seal(plaintext, aad []byte) ([]byte, error) {
+	aead, err := c.cipherFor(c.salt)
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := len(metadataMagic) + metadataSaltSize + aead.NonceSize()
+	out := make([]byte, headerLen, headerLen+len(plaintext)+aead.Overhead())
+	copy(out, metadataMagic)
+	copy(out[len(metadataMagic):], c.salt)
+	nonce := out[len(metadataMagic)+metadataSaltSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(out, nonce, plaintext, aad), nil
+}
+
+// Open 解密 Seal 生成的元数据，aad 必须与加密时一致
+func (c *MetadataCipher) Open(sealed, aad []byte) ([]byte, error) {
+	if !IsSealedMetadata(sealed) || len(sealed) < len(metadataMagic)+metadataSaltSize+chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead {
+		return nil, fmt.Errorf("invalid sealed metadata")
+	}
+	sealed = sealed[len(metadataMagic):]
+	salt, sealed := sealed[:metadataSaltSize], sealed[metadataSaltSize:]
+	aead, err := c.cipherFor(salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt metadata: %w", err)
+	}
+	return plaintext, nil
+}
+
+// cipherFor 返回由主密钥和盐派生的元数据密钥，派生结果按盐缓存
+func (c *MetadataCipher) cipherFor(salt []byte) (cipher.AEAD, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if aead, ok := c.cache[string(salt)]; ok {
+		return aead, nil
+	}
+
+	root, hkdfSalt := c.keys.key, salt
+	if c.keys.isPassphrase() {
+		params, err := NewKDFParams(KDFArgon2id)
+		if err != nil {
+			return nil, err
+		}
+		root, hkdfSalt = argon2.IDKey(c.keys.passphrase, salt, params.Time, params.Memory, params.Threads, 32), nil
+	}
+
+	key, err := hkdf.Key(sha256.New, root, hkdfSalt, metadataKeyInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive metadata key: %w", err)
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	c.cache[string(salt)] = aead
+	return aead, nil
+}
+
+// IsSealedMetadata 检查数据是否为 MetadataCipher 加密的元数据
+func IsSealedMetadata(data []byte) bool {
+	return bytes.HasPrefix(data, metadataMagic)
+}
@@ -0,0 +1,111 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidMnemonic 助记词无效（包含未知单词或校验和错误）
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+const (
+	// mnemonicBitsPerWord 每个单词表示的位数
+	mnemonicBitsPerWord = 11
+
+	// maxMnemonicSize 助记词可以编码的最大数据长度（96个单词）
+	maxMnemonicSize = 128
+)
+
+var (
+	wordIndexOnce sync.Once
+	wordIndex     map[string]int // 单词及其前4个字母到序号的映射
+)
+
+// EncodeMnemonic 将数据编码为 BIP39 助记词
+//
+// 数据长度必须是4字节的倍数。数据后附加 SHA-256 的前 长度/4 位作为校验和，每11位对应一个单词，
+// 即每4字节对应3个单词。16到32字节的数据与标准 BIP39 助记词完全一致
+func EncodeMnemonic(data []byte) (string, error) {
+	if len(data) == 0 || len(data)%4 != 0 || len(data) > maxMnemonicSize {
+		return "", fmt.Errorf("mnemonic data must be a multiple of 4 bytes and at most %d bytes, got %d", maxMnemonicSize, len(data))
+	}
+	checksumBits := len(data) / 4
+	hash := sha256.Sum256(data)
+	bits := append(append([]byte{}, data...), hash[:]...)
+
+	words := make([]string, (len(data)*8+checksumBits)/mnemonicBitsPerWord)
+	for i := range words {
+		words[i] = bip39Words[readBits(bits, i*mnemonicBitsPerWord, mnemonicBitsPerWord)]
+	}
+	return strings.Join(words, " "), nil
+}
+
+// DecodeMnemonic 解码 EncodeMnemonic 生成的助记词并检查校验和
+// 单词之间可以使用任意空白分隔，不区分大小写，每个单词也可以只写前4个字母
+func DecodeMnemonic(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	if len(words) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidMnemonic)
+	}
+
+	// 每3个单词对应4字节数据
+	if len(words)%3 != 0 || len(words)/3*4 > maxMnemonicSize {
+		return nil, fmt.Errorf("%w: unexpected number of words (%d)", ErrInvalidMnemonic, len(words))
+	}
+	totalBits := len(words) * mnemonicBitsPerWord
+	size := len(words) / 3 * 4
+
+	bits := make([]byte, (totalBits+7)/8)
+	for i, word := range words {
+		index, ok := lookupWord(word)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		writeBits(bits, i*mnemonicBitsPerWord, mnemonicBitsPerWord, index)
+	}
+
+	data := bits[:size]
+	hash := sha256.Sum256(data)
+	checksumBits := totalBits - size*8
+	if readBits(bits, size*8, checksumBits) != readBits(hash[:], 0, checksumBits) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidMnemonic)
+	}
+	return append([]byte{}, data...), nil
+}
+
+// lookupWord 查找单词的序号，也接受单词的前4个字母
+func lookupWord(word string) (int, bool) {
+	wordIndexOnce.Do(func() {
+		wordIndex = make(map[string]int, 2*len(bip39Words))
+		for i, w := range bip39Words {
+			wordIndex[w] = i
+			if len(w) > 4 {
+				wordIndex[w[:4]] = i
+			}
+		}
+	})
+	index, ok := wordIndex[word]
+	return index, ok
+}
+
+// readBits 从 buf 的第 offset 位开始读取 n 位（高位在前）
+func readBits(buf []byte, offset, n int) int {
+	v := 0
+	for i := offset; i < offset+n; i++ {
+		v = v<<1 | int(buf[i/8]>>(7-i%8)&1)
+	}
+	return v
+}
+
+// writeBits 将 v 的低 n 位写入 buf 的第 offset 位开始的位置（高位在前）
+func writeBits(buf []byte, offset, n, v int) {
+	for i := 0; i < n; i++ {
+		if v>>(n-1-i)&1 == 1 {
+			pos := offset + i
+			buf[pos/8] |= 1 << (7 - pos%8)
+		}
+	}
+}
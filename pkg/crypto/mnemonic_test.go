@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// bip39Vectors 官方 BIP39 英文测试向量（trezor/python-mnemonic vectors.json）
+var bip39Vectors = []struct {
+	entropy  string
+	mnemonic string
+}{
+	{"00000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank yellow"},
+	{"80808080808080808080808080808080", "letter advice cage absurd amount doctor acoustic avoid letter advice cage above"},
+	{"ffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong"},
+	{"9e885d952ad362caeb4efe34a8e91bd2", "ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic"},
+	{"f30f8c1da665478f49b001d94c5fc452", "vessel ladder alter error federal sibling chat ability sun glass valve picture"},
+	{"c0ba5a8e914111210f2bd131f3d5e08d", "scheme spot photo card baby mountain device kick cradle pact join borrow"},
+	{"0000000000000000000000000000000000000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth title"},
+	{"8080808080808080808080808080808080808080808080808080808080808080", "letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic bless"},
+	{"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote"},
+	{"68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c", "hamster diagram private dutch cause delay private meat slide toddler razor book happy fancy gospel tennis maple dilemma loan word shrug inflict delay length"},
+}
+
+func TestMnemonicBIP39Vectors(t *testing.T) {
+	if len(bip39Words) != 2048 {
+		t.Fatalf("word list has %d words, want 2048", len(bip39Words))
+	}
+	for _, v := range bip39Vectors {
+		entropy, _ := hex.DecodeString(v.entropy)
+		got, err := EncodeMnemonic(entropy)
+		if err != nil {
+			t.Fatalf("EncodeMnemonic(%s): %v", v.entropy, err)
+		}
+		if got != v.mnemonic {
+			t.Errorf("EncodeMnemonic(%s)\n got  %s\n want %s", v.entropy, got, v.mnemonic)
+		}
+
+		decoded, err := DecodeMnemonic(v.mnemonic)
+		if err != nil {
+			t.Fatalf("DecodeMnemonic(%q): %v", v.mnemonic, err)
+		}
+		if hex.EncodeToString(decoded) != v.entropy {
+			t.Errorf("DecodeMnemonic(%q) = %x, want %s", v.mnemonic, decoded, v.entropy)
+		}
+	}
+}
+
+func TestMnemonicPrefixDecoding(t *testing.T) {
+	v := bip39Vectors[11]
+	var prefixes []string
+	for _, word := range strings.Fields(v.mnemonic) {
+		if len(word) > 4 {
+			word = word[:4]
+		}
+		prefixes = append(prefixes, strings.ToUpper(word))
+	}
+
+	decoded, err := DecodeMnemonic(strings.Join(prefixes, "\n  "))
+	if err != nil {
+		t.Fatalf("DecodeMnemonic: %v", err)
+	}
+	if hex.EncodeToString(decoded) != v.entropy {
+		t.Errorf("got %x, want %s", decoded, v.entropy)
+	}
+}
+
+func TestMnemonicChecksumMismatch(t *testing.T) {
+	// 最后一个单词包含校验和，替换后数据相同但校验和错误
+	words := strings.Fields(bip39Vectors[0].mnemonic)
+	words[len(words)-1] = "abandon"
+
+	_, err := DecodeMnemonic(strings.Join(words, " "))
+	if !errors.Is(err, ErrInvalidMnemonic) || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("got %v, want checksum mismatch", err)
+	}
+
+	if _, err := DecodeMnemonic("abandon abandon notaword"); !errors.Is(err, ErrInvalidMnemonic) {
+		t.Errorf("unknown word: got %v, want ErrInvalidMnemonic", err)
+	}
+}
@@ -0,0 +1,169 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// NameCipher 确定性加密文件名和目录名
+//
+// 使用SIV构造：iv = HMAC-SHA256(macKey, 名称)[:16]，密文 = AES-256-CTR(encKey, iv, 名称)，
+// 结果为 base32(iv || 密文)（小写、无填充）。相同的名称总是得到相同的加密名，
+// 因此可以按路径查找文件；iv 同时作为认证标签，解密时检查名称是否被篡改。
+// 路径的每一段单独加密，存储中保留目录结构但不暴露名称。
+type NameCipher struct {
+	macKey []byte // HMAC密钥
+	encKey []byte // AES-CTR密钥
+}
+
+const (
+	// nameIVSize 加密名中iv（认证标签）的长度
+	nameIVSize = 16
+
+	// maxEncryptedNameLen 加密后单段名称的最大长度（常见文件系统的限制）
+	maxEncryptedNameLen = 255
+
+	// nameKeyInfo 派生文件名密钥使用的HKDF info
+	nameKeyInfo = "cryptobackup filename encryption"
+
+	// NameSaltSize 口令派生文件名密钥使用的盐的长度
+	NameSaltSize = 16
+)
+
+// nameEncoding 加密名使用的base32编码（小写，不区分大小写的文件系统上也安全）
+var nameEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// ErrInvalidName 加密名无法解密（不是加密名或使用了其他密钥）
+var ErrInvalidName = errors.New("invalid encrypted name")
+
+// NewNameCipher 根据主密钥创建文件名加密器
+// 文件名密钥由主密钥通过HKDF派生，与文件内容使用的密钥相互独立
+func NewNameCipher(key []byte) (*NameCipher, error) {
+	if len(key) < 16 {
+		return nil, fmt.Errorf("invalid key size: %d, must be at least 16 bytes", len(key))
+	}
+	keys, err := hkdf.Key(sha256.New, key, nil, nameKeyInfo, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive name keys: %w", err)
+	}
+	return &NameCipher{macKey: keys[:32], encKey: keys[32:]}, nil
+}
+
+// NewNameCipherWithPassphrase 根据口令和仓库的盐创建文件名加密器
+// 加密名必须是确定性的，不能像文件内容那样每个文件使用随机盐；
+// 盐在仓库创建时随机生成并保存在仓库中，同一仓库中同一口令总是得到相同的加密名，
+// 不同仓库之间无法使用同一张预计算表
+func NewNameCipherWithPassphrase(passphrase string, salt []byte) (*NameCipher, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	if len(salt) != NameSaltSize {
+		return nil, fmt.Errorf("invalid name salt size: %d, must be %d bytes", len(salt), NameSaltSize)
+	}
+	params, err := NewKDFParams(KDFArgon2id)
+	if err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory, params.Threads, 32)
+	return NewNameCipher(key)
+}
+
+// EncryptName 加密单个名称（不能包含 /）
+func (c *NameCipher) EncryptName(name string) (string, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid name: %q", name)
+	}
+
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write([]byte(name))
+	iv := mac.Sum(nil)[:nameIVSize]
+
+	out := make([]byte, nameIVSize+len(name))
+	copy(out, iv)
+	if err := c.xorKeyStream(out[nameIVSize:], []byte(name), iv); err != nil {
+		return "", err
+	}
+
+	encoded := nameEncoding.EncodeToString(out)
+	if len(encoded) > maxEncryptedNameLen {
+		return "", fmt.Errorf("name too long to encrypt: %q", name)
+	}
+	return encoded, nil
+}
+
+// DecryptName 解密单个加密名
+// 不是本密钥生成的加密名时返回 ErrInvalidName
+func (c *NameCipher) DecryptName(encrypted string) (string, error) {
+	data, err := nameEncoding.DecodeString(encrypted)
+	if err != nil || len(data) <= nameIVSize {
+		return "", ErrInvalidName
+	}
+
+	iv := data[:nameIVSize]
+	name := make([]byte, len(data)-nameIVSize)
+	if err := c.xorKeyStream(name, data[nameIVSize:], iv); err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write(name)
+	if !hmac.Equal(mac.Sum(nil)[:nameIVSize], iv) {
+		return "", ErrInvalidName
+	}
+	return string(name), nil
+}
+
+// EncryptPath 逐段加密路径，返回以 / 开头的规范路径
+func (c *NameCipher) EncryptPath(p string) (string, error) {
+	segments := splitPath(p)
+	for i, segment := range segments {
+		encrypted, err := c.EncryptName(segment)
+		if err != nil {
+			return "", err
+		}
+		segments[i] = encrypted
+	}
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// DecryptPath 逐段解密路径，任何一段无法解密时返回 ErrInvalidName
+func (c *NameCipher) DecryptPath(p string) (string, error) {
+	segments := splitPath(p)
+	for i, segment := range segments {
+		name, err := c.DecryptName(segment)
+		if err != nil {
+			return "", err
+		}
+		segments[i] = name
+	}
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// xorKeyStream 使用AES-CTR加密或解密
+func (c *NameCipher) xorKeyStream(dst, src, iv []byte) error {
+	block, err := aes.NewCipher(c.encKey)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	cipher.NewCTR(block, iv).XORKeyStream(dst, src)
+	return nil
+}
+
+// splitPath 将路径规范化后拆分为非空的段
+func splitPath(p string) []string {
+	cleaned := strings.Trim(path.Clean("/"+p), "/")
+	if cleaned == "" {
+		return nil
+	}
+	return strings.Split(cleaned, "/")
+}
@@ -0,0 +1,167 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newNameCipherForTest 使用由seed填充的密钥创建文件名加密器
+func newNameCipherForTest(t *testing.T, seed byte) *NameCipher {
+	t.Helper()
+	c, err := NewNameCipher(bytes.Repeat([]byte{seed}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNameCipherRoundTrip(t *testing.T) {
+	c := newNameCipherForTest(t, 1)
+	for _, name := range []string{"a", "salaries.xlsx", "2025 年度报告.pdf", ".hidden", strings.Repeat("x", 100)} {
+		encrypted, err := c.EncryptName(name)
+		if err != nil {
+			t.Fatalf("EncryptName(%q): %v", name, err)
+		}
+		if encrypted == name || strings.ToLower(encrypted) != encrypted {
+			t.Errorf("EncryptName(%q) = %q", name, encrypted)
+		}
+		got, err := c.DecryptName(encrypted)
+		if err != nil {
+			t.Fatalf("DecryptName(%q): %v", encrypted, err)
+		}
+		if got != name {
+			t.Errorf("round trip: got %q, want %q", got, name)
+		}
+	}
+
+	encrypted, err := c.EncryptPath("payroll//2025/../2025/q3.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(encrypted, "/") != 3 || !strings.HasPrefix(encrypted, "/") {
+		t.Errorf("EncryptPath kept %q instead of three segments", encrypted)
+	}
+	if got, err := c.DecryptPath(encrypted); err != nil || got != "/payroll/2025/q3.xlsx" {
+		t.Errorf("DecryptPath = %q, %v", got, err)
+	}
+
+	for _, name := range []string{"", "a/b", strings.Repeat("x", 200)} {
+		if _, err := c.EncryptName(name); err == nil {
+			t.Errorf("EncryptName(%q) succeeded", name)
+		}
+	}
+}
+
+func TestNameCipherDeterministic(t *testing.T) {
+	a, b := newNameCipherForTest(t, 1), newNameCipherForTest(t, 1)
+	first, err := a.EncryptPath("/payroll/q3.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := b.EncryptPath("/payroll/q3.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("same key encrypted the same path to %q and %q", first, second)
+	}
+
+	// 同一目录下的文件共享加密后的目录名
+	sibling, err := a.EncryptPath("/payroll/q4.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if splitPath(first)[0] != splitPath(sibling)[0] {
+		t.Error("same directory encrypted to different names")
+	}
+	if splitPath(first)[1] == splitPath(sibling)[1] {
+		t.Error("different names encrypted to the same name")
+	}
+
+	other, err := newNameCipherForTest(t, 2).EncryptPath("/payroll/q3.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Error("different keys encrypted the path to the same name")
+	}
+}
+
+func TestNameCipherRejectsTampering(t *testing.T) {
+	c := newNameCipherForTest(t, 1)
+	encrypted, err := c.EncryptName("salaries.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改第一个字符（最后一个字符可能只包含被忽略的填充位）
+	flipped := []byte(encrypted)
+	if flipped[0] == 'a' {
+		flipped[0] = 'b'
+	} else {
+		flipped[0] = 'a'
+	}
+
+	for name, input := range map[string]string{
+		"modified":   string(flipped),
+		"truncated":  encrypted[:len(encrypted)-2],
+		"plaintext":  "salaries.xlsx",
+		"uppercase":  strings.ToUpper(encrypted),
+		"iv only":    nameEncoding.EncodeToString(make([]byte, nameIVSize)),
+		"not base32": "!!!!",
+		"empty":      "",
+	} {
+		if got, err := c.DecryptName(input); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("%s: DecryptName = %q, %v, want ErrInvalidName", name, got, err)
+		}
+	}
+
+	if _, err := newNameCipherForTest(t, 2).DecryptName(encrypted); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("other key: got %v, want ErrInvalidName", err)
+	}
+
+	// 路径中任何一段被替换都无法解密
+	p, err := c.EncryptPath("/payroll/q3.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DecryptPath(p + "/" + string(flipped)); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("tampered path segment: got %v, want ErrInvalidName", err)
+	}
+}
+
+func TestNameCipherWithPassphraseSalt(t *testing.T) {
+	salt := bytes.Repeat([]byte{7}, NameSaltSize)
+	a, err := NewNameCipherWithPassphrase("correct horse battery staple", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSalt := append([]byte{}, salt...)
+	otherSalt[0] ^= 1
+	b, err := NewNameCipherWithPassphrase("correct horse battery staple", otherSalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := a.EncryptName("salaries.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := b.EncryptName("salaries.xlsx"); other == name {
+		t.Error("different repository salts encrypted the name to the same value")
+	}
+	if _, err := b.DecryptName(name); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("other salt: got %v, want ErrInvalidName", err)
+	}
+
+	for _, bad := range [][]byte{nil, salt[:NameSaltSize-1]} {
+		if _, err := NewNameCipherWithPassphrase("correct horse battery staple", bad); err == nil {
+			t.Errorf("salt of %d bytes was accepted", len(bad))
+		}
+	}
+	if _, err := NewNameCipherWithPassphrase("", salt); err == nil {
+		t.Error("empty passphrase was accepted")
+	}
+}
@@ -0,0 +1,210 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 外部加密插件
+//
+// 插件是名为 cryptobackup-plugin-<name> 的可执行文件，通过 -algo plugin:<name> 使用。
+// 优先在环境变量 CRYPTOBACKUP_PLUGIN_DIR 指定的目录中查找，否则在 PATH 中查找。
+//
+// 协议（版本 1）：
+//   - <插件> handshake：向标准输出写入一个JSON对象
+//     {"protocol": 1, "metadata": {"algorithm": "..."}}，metadata 会写入文件元数据；
+//     文件的 algorithm 字段总是 plugin:<name>，插件返回的 algorithm 保存在 plugin_algorithm 中
+//   - <插件> encrypt：从标准输入读取明文，向标准输出写入密文
+//   - <插件> decrypt：从标准输入读取密文，向标准输出写入明文
+//
+// 密钥通过环境变量传递，不会出现在命令行参数中：CRYPTOBACKUP_PLUGIN_KEY 为16进制密钥，
+// 口令模式下为 CRYPTOBACKUP_PLUGIN_PASSPHRASE。退出码非0表示失败，标准错误输出作为错误信息。
+const (
+	// PluginPrefix 插件算法名称的前缀
+	PluginPrefix = "plugin:"
+
+	// PluginDirEnv 指定插件目录的环境变量
+	PluginDirEnv = "CRYPTOBACKUP_PLUGIN_DIR"
+
+	// pluginProtocolVersion 支持的插件协议版本
+	pluginProtocolVersion = 1
+
+	// pluginExecutablePrefix 插件可执行文件名的前缀
+	pluginExecutablePrefix = "cryptobackup-plugin-"
+
+	// pluginHandshakeTimeout 握手的超时时间
+	pluginHandshakeTimeout = 10 * time.Second
+
+	// maxPluginStderr 错误信息中保留的标准错误输出长度
+	maxPluginStderr = 4096
+
+	// pluginAlgorithmKey 元数据中记录插件自己报告的算法名称的字段
+	pluginAlgorithmKey = "plugin_algorithm"
+)
+
+// pluginNamePattern 插件名称只允许这些字符，防止通过名称访问其他路径
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// pluginHandshake 插件握手的响应
+type pluginHandshake struct {
+	Protocol int               `json:"protocol"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// plugin 一个外部加密插件
+type plugin struct {
+	name string   // 插件名称
+	path string   // 可执行文件路径
+	env  []string // 传递密钥的环境变量
+}
+
+// NewPluginEncryptor 创建使用外部插件的加密器
+// 创建时执行握手检查插件是否可用，返回的加密器基于 CustomEncryptor
+func NewPluginEncryptor(name string, key []byte, passphrase string) (*CustomEncryptor, error) {
+	if !pluginNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid plugin name: %q", name)
+	}
+	if len(key) == 0 && passphrase == "" {
+		return nil, fmt.Errorf("plugin %s requires a key or passphrase", name)
+	}
+
+	path, err := findPlugin(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &plugin{name: name, path: path}
+	if len(key) > 0 {
+		p.env = append(p.env, "CRYPTOBACKUP_PLUGIN_KEY="+hex.EncodeToString(key))
+	}
+	if passphrase != "" {
+		p.env = append(p.env, "CRYPTOBACKUP_PLUGIN_PASSPHRASE="+passphrase)
+	}
+
+	metadata, err := p.handshake()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCustomEncryptor(
+		PluginPrefix+name,
+		func(src io.Reader, dst io.Writer) error {
+			return p.run(context.Background(), "encrypt", src, dst)
+		},
+		func(src io.Reader, dst io.Writer) error {
+			return p.run(context.Background(), "decrypt", src, dst)
+		},
+		func() map[string]string {
+			md := make(map[string]string, len(metadata)+1)
+			for k, v := range metadata {
+				md[k] = v
+			}
+			// 记录使用的插件，下载时需要通过 plugin:<name> 指定同一插件
+			md["plugin"] = name
+			return md
+		},
+	), nil
+}
+
+// findPlugin 查找插件的可执行文件
+func findPlugin(name string) (string, error) {
+	executable := pluginExecutablePrefix + name
+	if dir := os.Getenv(PluginDirEnv); dir != "" {
+		path := filepath.Join(dir, executable)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	path, err := exec.LookPath(executable)
+	if err != nil {
+		return "", fmt.Errorf("plugin %s not found: %w", name, err)
+	}
+	return path, nil
+}
+
+// handshake 检查插件的协议版本并获取元数据
+func (p *plugin) handshake() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginHandshakeTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	if err := p.run(ctx, "handshake", nil, &out); err != nil {
+		return nil, err
+	}
+
+	var resp pluginHandshake
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("plugin %s: invalid handshake response: %w", p.name, err)
+	}
+	if resp.Protocol != pluginProtocolVersion {
+		return nil, fmt.Errorf("plugin %s: unsupported protocol version %d", p.name, resp.Protocol)
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = make(map[string]string)
+	}
+	// algorithm 总是记录为 plugin:<name>，插件不能冒充内置算法（如 AES-GCM 或 XOR），
+	// 否则自动识别、不安全算法检查和下载时的算法选择都会被误导。插件自己的算法名称另外保存
+	if vendor := resp.Metadata["algorithm"]; vendor != "" && vendor != PluginPrefix+p.name {
+		resp.Metadata[pluginAlgorithmKey] = vendor
+	}
+	resp.Metadata["algorithm"] = PluginPrefix + p.name
+	return resp.Metadata, nil
+}
+
+// run 执行插件命令，src 作为标准输入，标准输出写入 dst
+func (p *plugin) run(ctx context.Context, command string, src io.Reader, dst io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.path, command)
+	cmd.Env = append(os.Environ(), p.env...)
+	cmd.Stdin = src
+	cmd.Stdout = dst
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: maxPluginStderr}
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("plugin %s %s failed: %w: %s", p.name, command, err, msg)
+		}
+		return fmt.Errorf("plugin %s %s failed: %w", p.name, command, err)
+	}
+	return nil
+}
+
+// limitedBuffer 只保留前limit字节的写入器，多余的内容被丢弃
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.buf.Write(p[:remaining])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// newPluginFromConfig 算法名称为 plugin:<name>
+func newPluginFromConfig(cfg *Config) (Encryptor, error) {
+	passphrase, err := cfg.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	name, ok := strings.CutPrefix(cfg.Algorithm, PluginPrefix)
+	if !ok {
+		return nil, fmt.Errorf("plugin algorithm must be %s<name>", PluginPrefix)
+	}
+	return NewPluginEncryptor(name, cfg.Key, passphrase)
+}
@@ -0,0 +1,39 @@
+package crypto
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPluginCannotClaimBuiltinAlgorithm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test plugin is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"case \"$1\" in\n" +
+		"handshake) echo '{\"protocol\": 1, \"metadata\": {\"algorithm\": \"AES-GCM\"}}' ;;\n" +
+		"*) cat ;;\n" +
+		"esac\n"
+	if err := os.WriteFile(filepath.Join(dir, pluginExecutablePrefix+"fake"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(PluginDirEnv, dir)
+
+	enc, err := NewPluginEncryptor("fake", []byte{1, 2, 3}, "")
+	if err != nil {
+		t.Fatalf("NewPluginEncryptor: %v", err)
+	}
+	metadata := enc.GetMetadata()
+	if got := metadata["algorithm"]; got != PluginPrefix+"fake" {
+		t.Errorf("algorithm = %q, want %q", got, PluginPrefix+"fake")
+	}
+	if got := metadata[pluginAlgorithmKey]; got != "AES-GCM" {
+		t.Errorf("%s = %q, want AES-GCM", pluginAlgorithmKey, got)
+	}
+	if got := metadata["plugin"]; got != "fake" {
+		t.Errorf("plugin = %q, want fake", got)
+	}
+}
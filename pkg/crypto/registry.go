@@ -0,0 +1,206 @@
+package crypto
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory 根据配置创建加密器
+type Factory func(cfg *Config) (Encryptor, error)
+
+// Config.Options 中内置算法识别的选项
+const (
+	// OptionPassphrase 口令（string），设置后忽略 Config.Key，从口令派生密钥
+	OptionPassphrase = "passphrase"
+
+	// OptionKDF 口令模式的密钥派生算法（string 名称或 KDFAlgorithm），默认 argon2id
+	OptionKDF = "kdf"
+
+	// OptionRecipients 逗号分隔的接收者公钥（string），用于公钥加密算法
+	OptionRecipients = "recipients"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register("aes", newAESFromConfig)
+	Register("chacha", newChaCha20FromConfig)
+	Register("xor", newXORFromConfig)
+	Register("x25519", newX25519FromConfig)
+	Register("age", newAgeFromConfig)
+	Register("auto", newAutoFromConfig)
+	Register("plugin", newPluginFromConfig)
+}
+
+// Register 注册加密算法
+// 名称重复或factory为nil时panic，通常在包的init函数中调用
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" || factory == nil {
+		panic("crypto: Register called with empty name or nil factory")
+	}
+	if _, exists := registry[name]; exists {
+		panic("crypto: Register called twice for algorithm " + name)
+	}
+	registry[name] = factory
+}
+
+// NewEncryptor 根据配置中的算法名称创建加密器
+// 名称为 family:variant 形式（如 plugin:gost）且没有完全匹配的注册项时，使用 family 的工厂函数，
+// 工厂函数从 Config.Algorithm 中读取完整名称
+func NewEncryptor(cfg *Config) (Encryptor, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[cfg.Algorithm]
+	if !ok {
+		if family, _, found := strings.Cut(cfg.Algorithm, ":"); found {
+			factory, ok = registry[family]
+		}
+	}
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm: %s", cfg.Algorithm)
+	}
+	return factory(cfg)
+}
+
+// Algorithms 返回已注册的算法名称（按名称排序）
+func Algorithms() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StringOption 读取字符串类型的选项，不存在时返回空字符串
+func (c *Config) StringOption(name string) (string, error) {
+	v, ok := c.Options[name]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("option %s must be a string, got %T", name, v)
+	}
+	return s, nil
+}
+
+// passphrase 返回口令选项
+func (c *Config) passphrase() (string, error) {
+	return c.StringOption(OptionPassphrase)
+}
+
+// kdf 返回口令模式的密钥派生算法
+func (c *Config) kdf() (KDFAlgorithm, error) {
+	switch v := c.Options[OptionKDF].(type) {
+	case nil:
+		return KDFArgon2id, nil
+	case KDFAlgorithm:
+		return v, nil
+	case string:
+		return ParseKDFAlgorithm(v)
+	default:
+		return KDFNone, fmt.Errorf("option %s must be a string or KDFAlgorithm, got %T", OptionKDF, v)
+	}
+}
+
+func newAESFromConfig(cfg *Config) (Encryptor, error) {
+	passphrase, err := cfg.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return NewAESEncryptor(cfg.Key)
+	}
+	kdf, err := cfg.kdf()
+	if err != nil {
+		return nil, err
+	}
+	return NewAESEncryptorWithPassphrase(passphrase, kdf)
+}
+
+func newChaCha20FromConfig(cfg *Config) (Encryptor, error) {
+	passphrase, err := cfg.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return NewChaCha20Encryptor(cfg.Key)
+	}
+	kdf, err := cfg.kdf()
+	if err != nil {
+		return nil, err
+	}
+	return NewChaCha20EncryptorWithPassphrase(passphrase, kdf)
+}
+
+func newXORFromConfig(cfg *Config) (Encryptor, error) {
+	if passphrase, _ := cfg.passphrase(); passphrase != "" {
+		return nil, fmt.Errorf("algorithm xor does not support passphrases")
+	}
+	return NewXOREncryptor(cfg.Key)
+}
+
+// newX25519FromConfig 提供接收者时创建加密器，否则 Config.Key 为私钥，创建解密器
+func newX25519FromConfig(cfg *Config) (Encryptor, error) {
+	if passphrase, _ := cfg.passphrase(); passphrase != "" {
+		return nil, fmt.Errorf("algorithm x25519 does not support passphrases")
+	}
+	recipients, err := cfg.StringOption(OptionRecipients)
+	if err != nil {
+		return nil, err
+	}
+	if recipients == "" {
+		return NewX25519Decryptor(cfg.Key)
+	}
+	keys, err := ParseRecipients(recipients)
+	if err != nil {
+		return nil, err
+	}
+	return NewX25519Encryptor(keys)
+}
+
+// newAgeFromConfig Config.Key 为 AGE-SECRET-KEY-1... 文本形式的身份
+func newAgeFromConfig(cfg *Config) (Encryptor, error) {
+	recipients, err := cfg.StringOption(OptionRecipients)
+	if err != nil {
+		return nil, err
+	}
+	if recipients != "" {
+		return NewAgeEncryptor(recipients)
+	}
+	passphrase, err := cfg.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		return NewAgeEncryptorWithPassphrase(passphrase)
+	}
+	return NewAgeEncryptor(string(cfg.Key))
+}
+
+func newAutoFromConfig(cfg *Config) (Encryptor, error) {
+	passphrase, err := cfg.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		return NewAutoDecryptorWithPassphrase(passphrase)
+	}
+	return NewAutoDecryptor(cfg.Key)
+}
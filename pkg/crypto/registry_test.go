@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// registerForTest 注册测试使用的算法，测试结束后移除
+func registerForTest(t *testing.T, name string, factory Factory) {
+	t.Helper()
+	Register(name, factory)
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, name)
+		registryMu.Unlock()
+	})
+}
+
+// registerPanics 检查 Register 是否panic
+func registerPanics(name string, factory Factory) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	Register(name, factory)
+	return false
+}
+
+func TestRegisterCustomAlgorithm(t *testing.T) {
+	var algorithms []string
+	registerForTest(t, "test-custom", func(cfg *Config) (Encryptor, error) {
+		algorithms = append(algorithms, cfg.Algorithm)
+		return NewChaCha20Encryptor(cfg.Key)
+	})
+	if !slices.Contains(Algorithms(), "test-custom") {
+		t.Errorf("Algorithms() = %v, missing test-custom", Algorithms())
+	}
+
+	key := bytes.Repeat([]byte{3}, 32)
+	enc, err := NewEncryptor(&Config{Algorithm: "test-custom", Key: key})
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	plaintext := []byte("registered algorithm")
+	got, err := decryptForTest(enc, encryptForTest(t, enc, plaintext))
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Error("round trip mismatch")
+	}
+
+	// family:variant 没有完全匹配时使用 family 的工厂函数，并传入完整名称
+	if _, err := NewEncryptor(&Config{Algorithm: "test-custom:v2", Key: key}); err != nil {
+		t.Fatalf("NewEncryptor(test-custom:v2): %v", err)
+	}
+	if want := []string{"test-custom", "test-custom:v2"}; !slices.Equal(algorithms, want) {
+		t.Errorf("factory saw %v, want %v", algorithms, want)
+	}
+}
+
+func TestBuiltinAlgorithmsRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{4}, 32)
+	plaintext := []byte("built-in algorithm")
+	for _, cfg := range []*Config{
+		{Algorithm: "aes", Key: key},
+		{Algorithm: "chacha", Key: key},
+		{Algorithm: "xor", Key: key},
+		{Algorithm: "aes", Options: map[string]interface{}{OptionPassphrase: "passphrase", OptionKDF: "scrypt"}},
+	} {
+		enc, err := NewEncryptor(cfg)
+		if err != nil {
+			t.Fatalf("%s: NewEncryptor: %v", cfg.Algorithm, err)
+		}
+		got, err := decryptForTest(enc, encryptForTest(t, enc, plaintext))
+		if err != nil {
+			t.Fatalf("%s: Decrypt: %v", cfg.Algorithm, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("%s: round trip mismatch", cfg.Algorithm)
+		}
+	}
+
+	// 自动识别加密器解密任何使用相同密钥的内置算法
+	aes, err := NewEncryptor(&Config{Algorithm: "aes", Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auto, err := NewEncryptor(&Config{Algorithm: "auto", Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := decryptForTest(auto, encryptForTest(t, aes, plaintext)); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("auto: got %q, %v", got, err)
+	}
+}
+
+func TestRegisterRejectsInvalid(t *testing.T) {
+	factory := func(cfg *Config) (Encryptor, error) { return NewAESEncryptor(cfg.Key) }
+	registerForTest(t, "test-duplicate", factory)
+
+	for _, tt := range []struct {
+		name    string
+		algo    string
+		factory Factory
+	}{
+		{"duplicate", "test-duplicate", factory},
+		{"duplicate built-in", "aes", factory},
+		{"empty name", "", factory},
+		{"nil factory", "test-nil", nil},
+	} {
+		if !registerPanics(tt.algo, tt.factory) {
+			t.Errorf("%s: Register did not panic", tt.name)
+		}
+	}
+	if slices.Contains(Algorithms(), "test-nil") || slices.Contains(Algorithms(), "") {
+		t.Errorf("invalid registration was kept: %v", Algorithms())
+	}
+}
+
+func TestNewEncryptorUnknownAlgorithm(t *testing.T) {
+	for _, cfg := range []*Config{
+		nil,
+		{Algorithm: "des", Key: make([]byte, 8)},
+		{Algorithm: "", Key: make([]byte, 32)},
+		{Algorithm: "unknown:variant", Key: make([]byte, 32)},
+	} {
+		if enc, err := NewEncryptor(cfg); err == nil {
+			t.Errorf("NewEncryptor(%+v) = %T, want an error", cfg, enc)
+		}
+	}
+
+	if _, err := NewEncryptor(&Config{Algorithm: "xor", Options: map[string]interface{}{OptionPassphrase: "passphrase"}}); err == nil {
+		t.Error("xor accepted a passphrase")
+	}
+}
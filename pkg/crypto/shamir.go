@@ -0,0 +1,207 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Share Shamir 秘密分享的一个份额
+//
+// 秘密的每个字节作为常数项构造 Threshold-1 次的随机多项式（GF(256)，与 AES 相同的约化多项式），
+// 份额是多项式在 x=Index 处的值。任意 Threshold 个份额可以恢复秘密，更少的份额不泄露秘密的任何信息
+type Share struct {
+	Threshold int    // 恢复秘密需要的份额数量
+	Index     int    // 份额编号（1-255）
+	Value     []byte // 份额数据，长度与秘密相同
+}
+
+// ShareTextPrefix 文本形式份额的前缀
+const ShareTextPrefix = "cbshare1-"
+
+// shareChecksumSize 文本形式份额的校验和长度
+const shareChecksumSize = 4
+
+// ErrInvalidShare 份额格式错误或校验和不匹配
+var ErrInvalidShare = errors.New("invalid share")
+
+// SplitSecret 将秘密拆分为 n 个份额，任意 threshold 个份额可以恢复秘密
+func SplitSecret(secret []byte, n, threshold int) ([]Share, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret cannot be empty")
+	}
+	if threshold < 2 || threshold > n || n > 255 {
+		return nil, fmt.Errorf("invalid share parameters: need 2 <= threshold (%d) <= shares (%d) <= 255", threshold, n)
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{Threshold: threshold, Index: i + 1, Value: make([]byte, len(secret))}
+	}
+
+	coefficients := make([]byte, threshold)
+	defer clear(coefficients)
+	for pos, b := range secret {
+		coefficients[0] = b
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate random coefficients: %w", err)
+		}
+		for i := range shares {
+			shares[i].Value[pos] = gfEval(coefficients, byte(shares[i].Index))
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares 使用至少 Threshold 个份额恢复秘密
+// 份额必须来自同一次拆分；来自不同拆分的份额无法检测，只会得到错误的秘密，
+// 调用方应使用密钥指纹确认结果
+func CombineShares(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no shares provided")
+	}
+	threshold := shares[0].Threshold
+	size := len(shares[0].Value)
+	if len(shares) < threshold {
+		return nil, fmt.Errorf("not enough shares: have %d, need %d", len(shares), threshold)
+	}
+
+	seen := make(map[int]bool)
+	for _, s := range shares {
+		if s.Threshold != threshold || len(s.Value) != size {
+			return nil, fmt.Errorf("%w: shares come from different splits", ErrInvalidShare)
+		}
+		if s.Index < 1 || s.Index > 255 {
+			return nil, fmt.Errorf("%w: index %d out of range", ErrInvalidShare, s.Index)
+		}
+		if seen[s.Index] {
+			return nil, fmt.Errorf("%w: duplicate share %d", ErrInvalidShare, s.Index)
+		}
+		seen[s.Index] = true
+	}
+
+	// 拉格朗日插值求 x=0 处的值，只需要 threshold 个份额
+	shares = shares[:threshold]
+	secret := make([]byte, size)
+	for i, si := range shares {
+		// basis = Π x_j / (x_j - x_i)，GF(256) 中减法即异或
+		basis := byte(1)
+		for j, sj := range shares {
+			if i == j {
+				continue
+			}
+			xi, xj := byte(si.Index), byte(sj.Index)
+			basis = gfMul(basis, gfMul(xj, gfInv(xj^xi)))
+		}
+		for pos := range secret {
+			secret[pos] ^= gfMul(si.Value[pos], basis)
+		}
+	}
+	return secret, nil
+}
+
+// String 返回份额的文本形式：前缀 + 16进制（二进制形式和校验和）
+func (s Share) String() string {
+	payload := s.payload()
+	sum := sha256.Sum256(payload)
+	return ShareTextPrefix + hex.EncodeToString(append(payload, sum[:shareChecksumSize]...))
+}
+
+// Mnemonic 返回份额的助记词形式（二进制形式使用 EncodeMnemonic 编码）
+func (s Share) Mnemonic() (string, error) {
+	return EncodeMnemonic(s.payload())
+}
+
+// payload 份额的二进制形式：门限(1字节) | 编号(1字节) | 填充长度(1字节) | 份额数据 | 填充
+// 填充的零字节使总长度为4的倍数，以便编码为助记词
+func (s Share) payload() []byte {
+	padding := (4 - (3+len(s.Value))%4) % 4
+	payload := append([]byte{byte(s.Threshold), byte(s.Index), byte(padding)}, s.Value...)
+	return append(payload, make([]byte, padding)...)
+}
+
+// parseSharePayload 解析份额的二进制形式
+func parseSharePayload(payload []byte) (Share, error) {
+	if len(payload) < 4 {
+		return Share{}, fmt.Errorf("%w: too short", ErrInvalidShare)
+	}
+	padding := int(payload[2])
+	if padding > 3 || len(payload)-3-padding < 1 {
+		return Share{}, fmt.Errorf("%w: invalid padding", ErrInvalidShare)
+	}
+	for _, b := range payload[len(payload)-padding:] {
+		if b != 0 {
+			return Share{}, fmt.Errorf("%w: invalid padding", ErrInvalidShare)
+		}
+	}
+
+	share := Share{
+		Threshold: int(payload[0]),
+		Index:     int(payload[1]),
+		Value:     append([]byte{}, payload[3:len(payload)-padding]...),
+	}
+	if share.Threshold < 2 || share.Index < 1 {
+		return Share{}, fmt.Errorf("%w: invalid threshold or index", ErrInvalidShare)
+	}
+	return share, nil
+}
+
+// ParseShare 解析文本形式或助记词形式的份额
+func ParseShare(text string) (Share, error) {
+	text = strings.TrimSpace(text)
+
+	rest, ok := strings.CutPrefix(text, ShareTextPrefix)
+	if !ok {
+		payload, err := DecodeMnemonic(text)
+		if err != nil {
+			return Share{}, fmt.Errorf("%w: %v", ErrInvalidShare, err)
+		}
+		return parseSharePayload(payload)
+	}
+
+	data, err := hex.DecodeString(rest)
+	if err != nil || len(data) <= shareChecksumSize {
+		return Share{}, fmt.Errorf("%w: malformed text share", ErrInvalidShare)
+	}
+	payload := data[:len(data)-shareChecksumSize]
+	sum := sha256.Sum256(payload)
+	if subtle.ConstantTimeCompare(sum[:shareChecksumSize], data[len(payload):]) != 1 {
+		return Share{}, fmt.Errorf("%w: checksum mismatch", ErrInvalidShare)
+	}
+	return parseSharePayload(payload)
+}
+
+// gfEval 使用霍纳法则计算多项式在 x 处的值
+func gfEval(coefficients []byte, x byte) byte {
+	var y byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coefficients[i]
+	}
+	return y
+}
+
+// gfMul GF(256) 乘法（约化多项式 x^8+x^4+x^3+x+1），不使用查找表，耗时与输入无关
+func gfMul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		a = a<<1 ^ (-(a >> 7) & 0x1b)
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv GF(256) 乘法逆元，a^254 = a^-1（a 不能为0）
+func gfInv(a byte) byte {
+	result := byte(1)
+	for i := 0; i < 7; i++ {
+		a = gfMul(a, a)
+		result = gfMul(result, a)
+	}
+	return result
+}
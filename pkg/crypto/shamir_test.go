@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// subsets 返回 shares 中所有大小为 k 的子集
+func subsets(shares []Share, k int) [][]Share {
+	if k == 0 {
+		return [][]Share{nil}
+	}
+	if len(shares) < k {
+		return nil
+	}
+	var out [][]Share
+	for _, rest := range subsets(shares[1:], k-1) {
+		out = append(out, append([]Share{shares[0]}, rest...))
+	}
+	return append(out, subsets(shares[1:], k)...)
+}
+
+func TestShamirEverySubset(t *testing.T) {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+
+	for _, params := range []struct{ n, k int }{{2, 2}, {3, 2}, {5, 3}, {6, 6}} {
+		shares, err := SplitSecret(secret, params.n, params.k)
+		if err != nil {
+			t.Fatalf("SplitSecret(%d, %d): %v", params.n, params.k, err)
+		}
+
+		for size := params.k; size <= params.n; size++ {
+			for _, subset := range subsets(shares, size) {
+				got, err := CombineShares(subset)
+				if err != nil {
+					t.Fatalf("%d-of-%d: CombineShares: %v", params.k, params.n, err)
+				}
+				if !bytes.Equal(got, secret) {
+					t.Errorf("%d-of-%d: subset of %d shares recovered the wrong secret", params.k, params.n, size)
+				}
+			}
+		}
+	}
+}
+
+func TestShamirTooFewShares(t *testing.T) {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, subset := range subsets(shares, 2) {
+		if _, err := CombineShares(subset); err == nil {
+			t.Error("CombineShares accepted fewer shares than the threshold")
+		}
+
+		// 即使伪造门限强行插值，也得不到原来的秘密
+		forged := make([]Share, len(subset))
+		for i, s := range subset {
+			forged[i] = Share{Threshold: 2, Index: s.Index, Value: s.Value}
+		}
+		got, err := CombineShares(forged)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(got, secret) {
+			t.Error("two shares of a 3-of-5 split recovered the secret")
+		}
+	}
+}
+
+func TestShareTextChecksum(t *testing.T) {
+	shares, err := SplitSecret([]byte("0123456789abcdef"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := shares[0].String()
+	parsed, err := ParseShare(text)
+	if err != nil {
+		t.Fatalf("ParseShare: %v", err)
+	}
+	if parsed.Index != shares[0].Index || parsed.Threshold != 2 || !bytes.Equal(parsed.Value, shares[0].Value) {
+		t.Errorf("ParseShare round trip mismatch: %+v", parsed)
+	}
+
+	// 修改最后一个16进制字符（校验和的一部分）
+	replacement := "0"
+	if strings.HasSuffix(text, "0") {
+		replacement = "1"
+	}
+	corrupted := text[:len(text)-1] + replacement
+	if _, err := ParseShare(corrupted); !errors.Is(err, ErrInvalidShare) || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("corrupted checksum: got %v, want checksum mismatch", err)
+	}
+
+	mnemonic, err := shares[1].Mnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err = ParseShare(mnemonic)
+	if err != nil {
+		t.Fatalf("ParseShare(mnemonic): %v", err)
+	}
+	if parsed.Index != shares[1].Index || !bytes.Equal(parsed.Value, shares[1].Value) {
+		t.Errorf("mnemonic share round trip mismatch: %+v", parsed)
+	}
+}
@@ -0,0 +1,55 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSignature 签名与数据或公钥不匹配
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// GenerateSigningKeyPair 生成Ed25519签名密钥对，返回私钥种子（32字节）和公钥
+func GenerateSigningKeyPair() ([]byte, []byte, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return priv.Seed(), pub, nil
+}
+
+// ParseSigningKey 解析十六进制的Ed25519私钥，接受32字节种子或64字节完整私钥
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	raw, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: must be a hex string")
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		key := ed25519.PrivateKey(raw)
+		// 完整私钥的后半部分是公钥，检查是否与种子一致
+		if !ed25519.NewKeyFromSeed(key.Seed()).Equal(key) {
+			return nil, fmt.Errorf("invalid signing key: public part does not match seed")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("invalid signing key: must be %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+}
+
+// ParseVerifyingKey 解析十六进制的Ed25519公钥
+func ParseVerifyingKey(s string) (ed25519.PublicKey, error) {
+	raw, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: must be a hex string")
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: must be %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// 分块流式加密格式
+//
+// 明文被切分为固定大小的块，每块单独使用AEAD加密。
+// 每块的nonce = 随机前缀 || 块序号（uint32大端） || 结束标记（1字节），
+// 最后一块的结束标记为1，其余为0，因此截断、重排和拼接都会导致认证失败。
+// 密文中每块长度为 chunkSize + Overhead，最后一块可以更短（但至少包含认证标签）。
+// 分块大小和nonce前缀记录在文件头部中（见 header.go）。
+
+const (
+	// DefaultChunkSize 默认的分块大小（明文字节数）
+	DefaultChunkSize = 64 * 1024
+
+	// maxChunkSize 允许的最大分块大小，防止恶意头部导致超大内存分配
+	maxChunkSize = 16 * 1024 * 1024
+
+	// streamNonceSuffix nonce中序号和结束标记占用的字节数
+	streamNonceSuffix = 5
+
+	// aesNoncePrefixSize AES-GCM（12字节nonce）使用的nonce前缀长度
+	aesNoncePrefixSize = 12 - streamNonceSuffix
+)
+
+// errStreamTruncated 密文在最后一块之前结束
+var errStreamTruncated = errors.New("encrypted stream is truncated")
+
+// noncePrefixSize 返回指定AEAD使用的随机nonce前缀长度
+func noncePrefixSize(aead cipher.AEAD) int {
+	return aead.NonceSize() - streamNonceSuffix
+}
+
+// streamNonce 根据前缀、块序号和结束标记构造nonce
+func streamNonce(nonce, prefix []byte, counter uint32, final bool) {
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(prefix):], counter)
+	if final {
+		nonce[len(nonce)-1] = 1
+	} else {
+		nonce[len(nonce)-1] = 0
+	}
+}
+
+// sealStream 将src分块加密后写入dst
+// aad 会作为每一块的附加认证数据
+func sealStream(aead cipher.AEAD, prefix []byte, chunkSize int, aad []byte, src io.Reader, dst io.Writer) error {
+	r := bufio.NewReader(src)
+	plaintext := make([]byte, chunkSize)
+	ciphertext := make([]byte, 0, chunkSize+aead.Overhead())
+	nonce := make([]byte, aead.NonceSize())
+
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(r, plaintext)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read source data: %w", err)
+		}
+
+		// 读满一块时，再探测一个字节判断是否已经到达末尾
+		final := n < chunkSize
+		if !final {
+			if _, peekErr := r.Peek(1); peekErr == io.EOF {
+				final = true
+			} else if peekErr != nil {
+				return fmt.Errorf("failed to read source data: %w", peekErr)
+			}
+		}
+
+		if !final && counter == math.MaxUint32 {
+			return fmt.Errorf("stream too large: chunk counter overflow")
+		}
+
+		streamNonce(nonce, prefix, counter, final)
+		ciphertext = aead.Seal(ciphertext[:0], nonce, plaintext[:n], aad)
+		if _, err := dst.Write(ciphertext); err != nil {
+			return fmt.Errorf("failed to write encrypted data: %w", err)
+		}
+
+		if final {
+			return nil
+		}
+	}
+}
+
+// openStream 逐块解密src并写入dst
+// 每块都在认证通过后才写出，最后一块缺失时返回错误
+func openStream(aead cipher.AEAD, prefix []byte, chunkSize int, aad []byte, src io.Reader, dst io.Writer) error {
+	r := bufio.NewReader(src)
+	ciphertext := make([]byte, chunkSize+aead.Overhead())
+	plaintext := make([]byte, 0, chunkSize)
+	nonce := make([]byte, aead.NonceSize())
+
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(r, ciphertext)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read encrypted data: %w", err)
+		}
+		if n == 0 {
+			return errStreamTruncated
+		}
+
+		final := n < len(ciphertext)
+		if !final {
+			if _, peekErr := r.Peek(1); peekErr == io.EOF {
+				final = true
+			} else if peekErr != nil {
+				return fmt.Errorf("failed to read encrypted data: %w", peekErr)
+			}
+		}
+
+		streamNonce(nonce, prefix, counter, final)
+		plaintext, err = aead.Open(plaintext[:0], nonce, ciphertext[:n], aad)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt chunk %d: %w", counter, err)
+		}
+		if _, err := dst.Write(plaintext); err != nil {
+			return fmt.Errorf("failed to write decrypted data: %w", err)
+		}
+
+		if final {
+			return nil
+		}
+		if counter == math.MaxUint32 {
+			return fmt.Errorf("stream too large: chunk counter overflow")
+		}
+	}
+}
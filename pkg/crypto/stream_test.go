@@ -0,0 +1,170 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// testChunkSize 测试使用的小分块，便于构造块边界情况
+const testChunkSize = 16
+
+func newTestStream(t *testing.T) (aeadKey, prefix []byte) {
+	t.Helper()
+	aeadKey = make([]byte, 32)
+	if _, err := rand.Read(aeadKey); err != nil {
+		t.Fatal(err)
+	}
+	prefix = make([]byte, aesNoncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		t.Fatal(err)
+	}
+	return aeadKey, prefix
+}
+
+func sealTestStream(t *testing.T, key, prefix, plaintext []byte) []byte {
+	t.Helper()
+	gcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := sealStream(gcm, prefix, testChunkSize, nil, bytes.NewReader(plaintext), &out); err != nil {
+		t.Fatalf("sealStream: %v", err)
+	}
+	return out.Bytes()
+}
+
+func openTestStream(key, prefix, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	err = openStream(gcm, prefix, testChunkSize, nil, bytes.NewReader(ciphertext), &out)
+	return out.Bytes(), err
+}
+
+func TestStreamRoundTripChunkBoundaries(t *testing.T) {
+	key, prefix := newTestStream(t)
+	overhead := 16
+
+	for _, size := range []int{0, 1, testChunkSize - 1, testChunkSize, testChunkSize + 1, 3 * testChunkSize} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		ciphertext := sealTestStream(t, key, prefix, plaintext)
+
+		// 每块都附带认证标签，空输入也会产生一个只含标签的最后一块
+		chunks := size/testChunkSize + 1
+		if size > 0 && size%testChunkSize == 0 {
+			chunks--
+		}
+		if want := size + chunks*overhead; len(ciphertext) != want {
+			t.Errorf("size %d: ciphertext length %d, want %d", size, len(ciphertext), want)
+		}
+
+		got, err := openTestStream(key, prefix, ciphertext)
+		if err != nil {
+			t.Fatalf("size %d: openStream: %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: round trip mismatch", size)
+		}
+	}
+}
+
+func TestStreamRejectsTruncationAtChunkBoundary(t *testing.T) {
+	key, prefix := newTestStream(t)
+	plaintext := make([]byte, 2*testChunkSize+1)
+	ciphertext := sealTestStream(t, key, prefix, plaintext)
+
+	fullChunk := testChunkSize + 16
+	for _, cut := range []int{fullChunk, 2 * fullChunk} {
+		if _, err := openTestStream(key, prefix, ciphertext[:cut]); err == nil {
+			t.Errorf("truncation after %d bytes was accepted", cut)
+		}
+	}
+	if _, err := openTestStream(key, prefix, nil); err != errStreamTruncated {
+		t.Errorf("empty stream: got %v, want errStreamTruncated", err)
+	}
+}
+
+func TestStreamRejectsSwappedChunks(t *testing.T) {
+	key, prefix := newTestStream(t)
+	plaintext := make([]byte, 3*testChunkSize)
+	rand.Read(plaintext)
+	ciphertext := sealTestStream(t, key, prefix, plaintext)
+
+	fullChunk := testChunkSize + 16
+	swapped := make([]byte, 0, len(ciphertext))
+	swapped = append(swapped, ciphertext[fullChunk:2*fullChunk]...)
+	swapped = append(swapped, ciphertext[:fullChunk]...)
+	swapped = append(swapped, ciphertext[2*fullChunk:]...)
+
+	if _, err := openTestStream(key, prefix, swapped); err == nil {
+		t.Error("swapped chunks were accepted")
+	}
+}
+
+func TestStreamRejectsFlippedFinalFlag(t *testing.T) {
+	key, prefix := newTestStream(t)
+	gcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	chunk := make([]byte, testChunkSize)
+
+	// 最后一块使用了非结束标记：看起来像被截断的流
+	streamNonce(nonce, prefix, 0, false)
+	notFinal := gcm.Seal(nil, nonce, chunk[:4], nil)
+	if _, err := openTestStream(key, prefix, notFinal); err == nil {
+		t.Error("last chunk without final flag was accepted")
+	}
+
+	// 中间块使用了结束标记：后面追加的数据必须被拒绝
+	streamNonce(nonce, prefix, 0, true)
+	first := gcm.Seal(nil, nonce, chunk, nil)
+	streamNonce(nonce, prefix, 1, true)
+	second := gcm.Seal(nil, nonce, chunk[:4], nil)
+	if _, err := openTestStream(key, prefix, append(first, second...)); err == nil {
+		t.Error("chunk with final flag followed by more data was accepted")
+	}
+}
+
+func TestAESEncryptorWrongKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	other := bytes.Repeat([]byte{2}, 32)
+
+	enc, err := NewAESEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ciphertext bytes.Buffer
+	plaintext := bytes.Repeat([]byte("cryptobackup"), DefaultChunkSize/8)
+	if err := enc.Encrypt(bytes.NewReader(plaintext), &ciphertext); err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := enc.Decrypt(bytes.NewReader(ciphertext.Bytes()), &out); err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), plaintext) {
+		t.Fatal("round trip mismatch")
+	}
+
+	wrong, err := NewAESEncryptor(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	err = wrong.Decrypt(bytes.NewReader(ciphertext.Bytes()), &out)
+	if err == nil {
+		t.Fatal("decryption with the wrong key succeeded")
+	}
+	if out.Len() != 0 {
+		t.Errorf("wrote %d bytes of output before rejecting the key", out.Len())
+	}
+}
@@ -0,0 +1,289 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// X25519Encryptor 使用X25519公钥加密的加密器
+//
+// 每个文件生成随机的数据密钥，数据使用XChaCha20-Poly1305分块加密，
+// 数据密钥分别包装给每个接收者的公钥，包装结果记录在头部中。
+// 只持有公钥的备份主机可以加密但无法解密，恢复时需要对应的私钥。
+type X25519Encryptor struct {
+	recipients []*ecdh.PublicKey // 接收者公钥
+	identity   *ecdh.PrivateKey  // 解密使用的私钥（可选）
+}
+
+const (
+	// x25519KeySize X25519公钥和私钥的长度
+	x25519KeySize = 32
+
+	// wrappedKeySize 包装后的数据密钥长度（密钥 + 认证标签）
+	wrappedKeySize = chacha20poly1305.KeySize + chacha20poly1305.Overhead
+
+	// x25519WrapInfo 派生包装密钥使用的HKDF info
+	x25519WrapInfo = "cryptobackup x25519 key wrap"
+)
+
+// ErrNoMatchingRecipient 私钥不是该文件的接收者
+var ErrNoMatchingRecipient = errors.New("no matching recipient: private key cannot decrypt this file")
+
+// RecipientStanza 包装给单个接收者的数据密钥
+type RecipientStanza struct {
+	Ephemeral  []byte // 临时公钥
+	WrappedKey []byte // 包装后的数据密钥
+}
+
+// GenerateX25519KeyPair 生成X25519密钥对，返回私钥和公钥
+func GenerateX25519KeyPair() ([]byte, []byte, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+	return priv.Bytes(), priv.PublicKey().Bytes(), nil
+}
+
+// NewX25519Encryptor 创建只能加密的X25519加密器
+// recipients: 接收者公钥列表（每个32字节）
+func NewX25519Encryptor(recipients [][]byte) (*X25519Encryptor, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+	if len(recipients) > 255 {
+		return nil, fmt.Errorf("too many recipients: %d", len(recipients))
+	}
+
+	e := &X25519Encryptor{}
+	for _, r := range recipients {
+		pub, err := ecdh.X25519().NewPublicKey(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient public key: %w", err)
+		}
+		e.recipients = append(e.recipients, pub)
+	}
+	return e, nil
+}
+
+// NewX25519Decryptor 创建持有私钥的X25519加密器
+// 加密时以私钥对应的公钥作为唯一接收者
+func NewX25519Decryptor(privateKey []byte) (*X25519Encryptor, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return &X25519Encryptor{
+		recipients: []*ecdh.PublicKey{priv.PublicKey()},
+		identity:   priv,
+	}, nil
+}
+
+// X25519PublicKey 返回私钥对应的公钥
+func X25519PublicKey(privateKey []byte) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return priv.PublicKey().Bytes(), nil
+}
+
+// ParseRecipients 解析逗号分隔的十六进制公钥列表
+func ParseRecipients(s string) ([][]byte, error) {
+	var recipients [][]byte
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		pub, err := hex.DecodeString(field)
+		if err != nil || len(pub) != x25519KeySize {
+			return nil, fmt.Errorf("invalid recipient public key: %s", field)
+		}
+		recipients = append(recipients, pub)
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+	return recipients, nil
+}
+
+// Encrypt 生成数据密钥，包装给所有接收者后分块加密数据
+func (e *X25519Encryptor) Encrypt(src io.Reader, dst io.Writer) error {
+	return e.EncryptWithAAD(src, dst, nil)
+}
+
+// EncryptWithAAD 加密数据，并将aad绑定为每块的附加认证数据
+func (e *X25519Encryptor) EncryptWithAAD(src io.Reader, dst io.Writer, aad []byte) error {
+	dataKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	var stanzas []RecipientStanza
+	for _, recipient := range e.recipients {
+		stanza, err := wrapToRecipient(dataKey, recipient)
+		if err != nil {
+			return err
+		}
+		stanzas = append(stanzas, stanza)
+	}
+
+	aead, err := chacha20poly1305.NewX(dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	prefix := make([]byte, noncePrefixSize(aead))
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header := &Header{
+		Algorithm:   AlgorithmX25519,
+		Recipients:  stanzas,
+		ChunkSize:   DefaultChunkSize,
+		NoncePrefix: prefix,
+		Bound:       aad != nil,
+	}
+	if err := WriteHeader(dst, header); err != nil {
+		return err
+	}
+
+	chunkAAD, err := header.chunkAAD(aad)
+	if err != nil {
+		return err
+	}
+	return sealStream(aead, prefix, DefaultChunkSize, chunkAAD, src, dst)
+}
+
+// Decrypt 使用私钥解开数据密钥后解密数据
+func (e *X25519Encryptor) Decrypt(src io.Reader, dst io.Writer) error {
+	return e.DecryptWithAAD(src, dst, nil)
+}
+
+// DecryptWithAAD 使用私钥解密数据，aad必须与加密时绑定的一致
+func (e *X25519Encryptor) DecryptWithAAD(src io.Reader, dst io.Writer, aad []byte) error {
+	if e.identity == nil {
+		return fmt.Errorf("private key is required to decrypt")
+	}
+
+	r := bufio.NewReader(src)
+	header, err := ReadHeader(r)
+	if err != nil {
+		return err
+	}
+	if err := header.expect(AlgorithmX25519); err != nil {
+		return err
+	}
+	if header.ChunkSize == 0 {
+		return fmt.Errorf("missing stream parameters in header")
+	}
+
+	// 依次尝试每个接收者记录，直到解开数据密钥
+	var dataKey []byte
+	for _, stanza := range header.Recipients {
+		if key, err := unwrapFromRecipient(stanza, e.identity); err == nil {
+			dataKey = key
+			break
+		}
+	}
+	if dataKey == nil {
+		return ErrNoMatchingRecipient
+	}
+
+	aead, err := chacha20poly1305.NewX(dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	if len(header.NoncePrefix) != noncePrefixSize(aead) {
+		return fmt.Errorf("invalid nonce prefix size: %d", len(header.NoncePrefix))
+	}
+
+	chunkAAD, err := header.chunkAAD(aad)
+	if err != nil {
+		return err
+	}
+	return openStream(aead, header.NoncePrefix, int(header.ChunkSize), chunkAAD, r, dst)
+}
+
+// GetMetadata 获取加密元数据
+func (e *X25519Encryptor) GetMetadata() map[string]string {
+	var fingerprints []string
+	for _, r := range e.recipients {
+		fingerprints = append(fingerprints, FingerprintString(r.Bytes()))
+	}
+	return map[string]string{
+		"algorithm":      AlgorithmX25519.String(),
+		"recipients":     strings.Join(fingerprints, ","),
+		"format_version": fmt.Sprintf("%d", FormatVersion),
+	}
+}
+
+// wrapToRecipient 使用临时密钥对将数据密钥包装给接收者
+func wrapToRecipient(dataKey []byte, recipient *ecdh.PublicKey) (RecipientStanza, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return RecipientStanza{}, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return RecipientStanza{}, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	ephemeralPub := ephemeral.PublicKey().Bytes()
+	aead, err := x25519WrapCipher(shared, ephemeralPub, recipient.Bytes())
+	if err != nil {
+		return RecipientStanza{}, err
+	}
+
+	// 包装密钥每次都不同，可以使用全零nonce
+	nonce := make([]byte, aead.NonceSize())
+	return RecipientStanza{
+		Ephemeral:  ephemeralPub,
+		WrappedKey: aead.Seal(nil, nonce, dataKey, nil),
+	}, nil
+}
+
+// unwrapFromRecipient 使用私钥解开接收者记录中的数据密钥
+func unwrapFromRecipient(stanza RecipientStanza, identity *ecdh.PrivateKey) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().NewPublicKey(stanza.Ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := identity.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := x25519WrapCipher(shared, stanza.Ephemeral, identity.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Open(nil, nonce, stanza.WrappedKey, nil)
+}
+
+// x25519WrapCipher 从共享密钥派生包装密钥
+func x25519WrapCipher(shared, ephemeralPub, recipientPub []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeralPub...), recipientPub...)
+	wrapKey, err := hkdf.Key(sha256.New, shared, salt, x25519WrapInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive wrap key: %w", err)
+	}
+	aead, err := chacha20poly1305.New(wrapKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
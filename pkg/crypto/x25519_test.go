@@ -0,0 +1,127 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestIdentity(t *testing.T) (*X25519Encryptor, []byte) {
+	t.Helper()
+	priv, pub, err := GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := NewX25519Decryptor(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dec, pub
+}
+
+func TestX25519RecipientRoundTrip(t *testing.T) {
+	alice, alicePub := newTestIdentity(t)
+	bob, bobPub := newTestIdentity(t)
+
+	// 只有公钥的加密器可以加密，但不能解密
+	enc, err := NewX25519Encryptor([][]byte{alicePub, bobPub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := bytes.Repeat([]byte("backup for two recipients"), 1000)
+	ciphertext := encryptForTest(t, enc, plaintext)
+
+	if _, err := decryptForTest(enc, ciphertext); err == nil {
+		t.Error("encryptor without a private key decrypted the data")
+	}
+	for name, dec := range map[string]*X25519Encryptor{"alice": alice, "bob": bob} {
+		got, err := decryptForTest(dec, ciphertext)
+		if err != nil {
+			t.Fatalf("%s: Decrypt: %v", name, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+	}
+
+	h, err := ReadHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Recipients) != 2 {
+		t.Errorf("header has %d recipient stanzas, want 2", len(h.Recipients))
+	}
+}
+
+func TestX25519WrongPrivateKey(t *testing.T) {
+	_, pub := newTestIdentity(t)
+	stranger, _ := newTestIdentity(t)
+
+	enc, err := NewX25519Encryptor([][]byte{pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := encryptForTest(t, enc, []byte("secret"))
+
+	got, err := decryptForTest(stranger, ciphertext)
+	if !errors.Is(err, ErrNoMatchingRecipient) {
+		t.Errorf("wrong private key: got %v, want ErrNoMatchingRecipient", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("wrong private key: wrote %d bytes of output", len(got))
+	}
+}
+
+func TestX25519PublicKeyMatchesPair(t *testing.T) {
+	priv, pub, err := GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	derived, err := X25519PublicKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(derived, pub) {
+		t.Error("X25519PublicKey does not match the generated public key")
+	}
+}
+
+func TestParseRecipients(t *testing.T) {
+	_, a := newTestIdentity(t)
+	_, b := newTestIdentity(t)
+
+	got, err := ParseRecipients(" " + hex.EncodeToString(a) + ", " + hex.EncodeToString(b) + ",")
+	if err != nil {
+		t.Fatalf("ParseRecipients: %v", err)
+	}
+	if len(got) != 2 || !bytes.Equal(got[0], a) || !bytes.Equal(got[1], b) {
+		t.Errorf("ParseRecipients returned %x", got)
+	}
+
+	for _, s := range []string{
+		"",
+		" , ",
+		"not-hex",
+		hex.EncodeToString(a[:31]),
+		hex.EncodeToString(append(a, 0)),
+		hex.EncodeToString(a) + ",zz",
+	} {
+		if _, err := ParseRecipients(s); err == nil {
+			t.Errorf("ParseRecipients(%q) succeeded", s)
+		}
+	}
+
+	for _, key := range [][]byte{nil, make([]byte, 31), make([]byte, 33)} {
+		if _, err := NewX25519Decryptor(key); err == nil {
+			t.Errorf("NewX25519Decryptor accepted a %d-byte key", len(key))
+		}
+		if _, err := NewX25519Encryptor([][]byte{key}); err == nil {
+			t.Errorf("NewX25519Encryptor accepted a %d-byte recipient", len(key))
+		}
+	}
+	if _, err := NewX25519Encryptor(nil); err == nil || !strings.Contains(err.Error(), "recipient") {
+		t.Errorf("NewX25519Encryptor(nil) = %v, want missing recipient error", err)
+	}
+}
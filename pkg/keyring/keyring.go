@@ -0,0 +1,281 @@
+package keyring
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cryptobackup/pkg/crypto"
+)
+
+// 支持的密钥类型
+const (
+	TypeSymmetric = "symmetric" // 对称密钥（16进制）
+	TypeX25519    = "x25519"    // X25519私钥（16进制）
+	TypeAge       = "age"       // age身份（AGE-SECRET-KEY-1...）
+	TypeEd25519   = "ed25519"   // Ed25519签名私钥（16进制）
+)
+
+// keyringVersion 密钥环文件格式版本
+const keyringVersion = 1
+
+// ErrNotFound 密钥环中没有匹配的密钥
+var ErrNotFound = errors.New("key not found in keyring")
+
+// Key 密钥环中的一个密钥
+type Key struct {
+	Name    string    `json:"name"`             // 名称
+	ID      string    `json:"id"`               // 密钥ID（指纹）
+	Type    string    `json:"type"`             // 密钥类型
+	Secret  string    `json:"secret"`           // 密钥（16进制或age身份）
+	Public  string    `json:"public,omitempty"` // 公钥（仅X25519、age和Ed25519）
+	Created time.Time `json:"created"`          // 添加时间
+}
+
+// Keyring 使用口令保护的本地密钥环
+//
+// 文件内容是JSON格式的密钥列表，整体使用口令派生的AES-256-GCM密钥加密。
+// 密钥ID与写入文件元数据的指纹一致：对称密钥为密钥指纹，X25519和Ed25519为公钥指纹，
+// age为公钥字符串的指纹
+type Keyring struct {
+	path       string
+	passphrase string
+	keys       []*Key
+}
+
+// keyringFile 密钥环文件解密后的内容
+type keyringFile struct {
+	Version int    `json:"version"`
+	Keys    []*Key `json:"keys"`
+}
+
+// DefaultPath 返回默认的密钥环路径
+// 优先使用环境变量 CRYPTOBACKUP_KEYRING，否则为 ~/.cryptobackup/keyring
+func DefaultPath() (string, error) {
+	if path := os.Getenv("CRYPTOBACKUP_KEYRING"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".cryptobackup", "keyring"), nil
+}
+
+// Exists 检查密钥环文件是否存在
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Open 使用口令打开密钥环，文件不存在时返回空的密钥环（Save 时创建）
+func Open(path, passphrase string) (*Keyring, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("keyring passphrase cannot be empty")
+	}
+	r := &Keyring{path: path, passphrase: passphrase}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	decryptor, err := crypto.NewAutoDecryptorWithPassphrase(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	var plain bytes.Buffer
+	if err := decryptor.Decrypt(bytes.NewReader(data), &plain); err != nil {
+		return nil, fmt.Errorf("failed to decrypt keyring (wrong passphrase?): %w", err)
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(plain.Bytes(), &file); err != nil {
+		return nil, fmt.Errorf("invalid keyring: %w", err)
+	}
+	if file.Version != keyringVersion {
+		return nil, fmt.Errorf("unsupported keyring version: %d", file.Version)
+	}
+	r.keys = file.Keys
+	return r, nil
+}
+
+// Save 加密并保存密钥环
+// 先写入同目录下的临时文件再重命名，保存失败时不会破坏原文件
+func (r *Keyring) Save() error {
+	data, err := json.Marshal(keyringFile{Version: keyringVersion, Keys: r.keys})
+	if err != nil {
+		return fmt.Errorf("failed to encode keyring: %w", err)
+	}
+
+	encryptor, err := crypto.NewAESEncryptorWithPassphrase(r.passphrase, crypto.KDFArgon2id)
+	if err != nil {
+		return err
+	}
+	var sealed bytes.Buffer
+	if err := encryptor.Encrypt(bytes.NewReader(data), &sealed); err != nil {
+		return fmt.Errorf("failed to encrypt keyring: %w", err)
+	}
+
+	dir := filepath.Dir(r.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create keyring directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".keyring-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(sealed.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	return nil
+}
+
+// Keys 返回所有密钥（按名称排序）
+func (r *Keyring) Keys() []*Key {
+	keys := append([]*Key(nil), r.keys...)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+// Add 添加密钥，名称和密钥ID都不能与已有的密钥重复
+func (r *Keyring) Add(name, keyType, secret string) (*Key, error) {
+	if name == "" {
+		return nil, fmt.Errorf("key name cannot be empty")
+	}
+	if _, err := r.Get(name); err == nil {
+		return nil, fmt.Errorf("key %q already exists", name)
+	}
+
+	key, err := NewKey(name, keyType, strings.TrimSpace(secret))
+	if err != nil {
+		return nil, err
+	}
+	if existing, err := r.Get(key.ID); err == nil {
+		return nil, fmt.Errorf("key %s is already in the keyring as %q", key.ID, existing.Name)
+	}
+
+	r.keys = append(r.keys, key)
+	return key, nil
+}
+
+// Get 根据名称或密钥ID查找密钥
+func (r *Keyring) Get(ref string) (*Key, error) {
+	for _, key := range r.keys {
+		if key.Name == ref {
+			return key, nil
+		}
+	}
+	for _, key := range r.keys {
+		if key.ID == ref {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, ref)
+}
+
+// Remove 根据名称或密钥ID删除密钥
+func (r *Keyring) Remove(ref string) (*Key, error) {
+	key, err := r.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range r.keys {
+		if k == key {
+			r.keys = append(r.keys[:i], r.keys[i+1:]...)
+			break
+		}
+	}
+	return key, nil
+}
+
+// Match 根据文件元数据查找加密时使用的密钥
+// 依次使用 key_id、key_fingerprint 和接收者列表匹配
+func (r *Keyring) Match(metadata map[string]string) (*Key, error) {
+	if id := metadata["key_id"]; id != "" {
+		return r.Get(id)
+	}
+	if fp := metadata["key_fingerprint"]; fp != "" {
+		for _, key := range r.keys {
+			if key.Type == TypeSymmetric && key.ID == fp {
+				return key, nil
+			}
+		}
+	}
+	for _, recipient := range strings.Split(metadata["recipients"], ",") {
+		recipient = strings.TrimSpace(recipient)
+		if recipient == "" {
+			continue
+		}
+		for _, key := range r.keys {
+			if key.Type != TypeSymmetric && (key.ID == recipient || key.Public == recipient) {
+				return key, nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// NewKey 校验密钥并计算密钥ID和公钥，不会添加到密钥环
+func NewKey(name, keyType, secret string) (*Key, error) {
+	key := &Key{Name: name, Type: keyType, Secret: secret, Created: time.Now().UTC()}
+
+	switch keyType {
+	case TypeSymmetric:
+		raw, err := hex.DecodeString(secret)
+		if err != nil || len(raw) == 0 {
+			return nil, fmt.Errorf("invalid symmetric key: must be a hex string")
+		}
+		key.ID = crypto.FingerprintString(raw)
+	case TypeX25519:
+		raw, err := hex.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x25519 private key: must be a hex string")
+		}
+		pub, err := crypto.X25519PublicKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = hex.EncodeToString(pub)
+		key.ID = crypto.FingerprintString(pub)
+	case TypeAge:
+		recipient, err := crypto.AgeRecipient(secret)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = recipient
+		key.ID = crypto.FingerprintString([]byte(recipient))
+	case TypeEd25519:
+		priv, err := crypto.ParseSigningKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		pub := priv.Public().(ed25519.PublicKey)
+		key.Secret = hex.EncodeToString(priv.Seed())
+		key.Public = hex.EncodeToString(pub)
+		key.ID = crypto.FingerprintString(pub)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+	return key, nil
+}
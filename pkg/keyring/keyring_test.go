@@ -0,0 +1,263 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cryptobackup/pkg/crypto"
+)
+
+// testSecret 返回由seed填充的32字节16进制密钥
+func testSecret(seed byte) string {
+	return hex.EncodeToString(bytes.Repeat([]byte{seed}, 32))
+}
+
+func TestSaveOpenRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "keyring")
+	r, err := Open(path, "keyring passphrase")
+	if err != nil {
+		t.Fatalf("Open missing keyring: %v", err)
+	}
+	if len(r.Keys()) != 0 || Exists(path) {
+		t.Fatal("missing keyring is not empty")
+	}
+
+	private, _, err := crypto.GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ageIdentity, ageRecipient, err := crypto.GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []struct{ name, keyType, secret string }{
+		{"backup", TypeSymmetric, testSecret(1)},
+		{"offline", TypeX25519, hex.EncodeToString(private)},
+		{"age", TypeAge, ageIdentity},
+	} {
+		if _, err := r.Add(k.name, k.keyType, k.secret); err != nil {
+			t.Fatalf("Add %s: %v", k.name, err)
+		}
+	}
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// 文件中不出现明文密钥
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(testSecret(1))) || bytes.Contains(data, []byte("backup")) {
+		t.Error("keyring file contains plaintext keys")
+	}
+
+	reopened, err := Open(path, "keyring passphrase")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	keys := reopened.Keys()
+	if len(keys) != 3 || keys[0].Name != "age" || keys[1].Name != "backup" || keys[2].Name != "offline" {
+		t.Fatalf("reopened keys: %+v", keys)
+	}
+	if keys[1].Secret != testSecret(1) || keys[0].Public != ageRecipient {
+		t.Errorf("reopened keys do not match: %+v", keys)
+	}
+}
+
+func TestOpenWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring")
+	r, err := Open(path, "keyring passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Add("backup", TypeSymmetric, testSecret(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path, "wrong passphrase"); err == nil {
+		t.Error("wrong passphrase was accepted")
+	}
+	if _, err := Open(path, ""); err == nil {
+		t.Error("empty passphrase was accepted")
+	}
+
+	// 损坏的文件同样被拒绝
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, "keyring passphrase"); err == nil {
+		t.Error("corrupted keyring was accepted")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	r := &Keyring{}
+	first, err := r.Add("first", TypeSymmetric, testSecret(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := r.Add("second", TypeSymmetric, testSecret(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, public, err := crypto.GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, err := r.Add("offline", TypeX25519, hex.EncodeToString(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secondEnc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipientEnc, err := crypto.NewX25519Encryptor([][]byte{public})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownEnc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{3}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		want     *Key
+	}{
+		{"key fingerprint", secondEnc.GetMetadata(), second},
+		{"recipient", recipientEnc.GetMetadata(), offline},
+		{"key_id", map[string]string{"key_id": first.ID, "key_fingerprint": second.ID}, first},
+		{"recipient public key", map[string]string{"recipients": "unknown, " + offline.Public}, offline},
+	}
+	for _, tt := range tests {
+		got, err := r.Match(tt.metadata)
+		if err != nil {
+			t.Errorf("%s: Match: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: matched %q, want %q", tt.name, got.Name, tt.want.Name)
+		}
+	}
+
+	for _, metadata := range []map[string]string{
+		unknownEnc.GetMetadata(),
+		{"key_id": "unknown"},
+		{"recipients": first.ID}, // 对称密钥不作为接收者匹配
+		{},
+	} {
+		if got, err := r.Match(metadata); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Match(%v) = %v, %v, want ErrNotFound", metadata, got, err)
+		}
+	}
+}
+
+func TestGetAndRemove(t *testing.T) {
+	r := &Keyring{}
+	for i, name := range []string{"first", "second", "third"} {
+		if _, err := r.Add(name, TypeSymmetric, testSecret(byte(i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Add("first", TypeSymmetric, testSecret(9)); err == nil {
+		t.Error("duplicate name was accepted")
+	}
+	if _, err := r.Add("copy", TypeSymmetric, testSecret(1)); err == nil {
+		t.Error("duplicate key was accepted")
+	}
+
+	second, err := r.Get("second")
+	if err != nil {
+		t.Fatalf("Get by name: %v", err)
+	}
+	if byID, err := r.Get(second.ID); err != nil || byID != second {
+		t.Errorf("Get by ID = %v, %v", byID, err)
+	}
+
+	// 按名称删除
+	removed, err := r.Remove("first")
+	if err != nil || removed.Name != "first" {
+		t.Fatalf("Remove by name = %v, %v", removed, err)
+	}
+	// 按密钥ID删除
+	if removed, err = r.Remove(second.ID); err != nil || removed != second {
+		t.Fatalf("Remove by ID = %v, %v", removed, err)
+	}
+
+	for _, ref := range []string{"first", "second", second.ID} {
+		if _, err := r.Get(ref); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) after remove: got %v, want ErrNotFound", ref, err)
+		}
+	}
+	if _, err := r.Remove("first"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removing twice: got %v, want ErrNotFound", err)
+	}
+	if keys := r.Keys(); len(keys) != 1 || keys[0].Name != "third" {
+		t.Errorf("remaining keys: %+v", keys)
+	}
+}
+
+func TestMnemonicRoundTrip(t *testing.T) {
+	// 使用固定的密钥，写错单词后校验和碰巧通过的情况不会随机出现
+	for _, k := range []struct{ keyType, secret string }{
+		{TypeSymmetric, testSecret(7)},
+		{TypeSymmetric, hex.EncodeToString([]byte("0123456789abcdef"))},
+		{TypeX25519, testSecret(8)},
+	} {
+		key, err := NewKey("key", k.keyType, k.secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mnemonic, err := key.Mnemonic()
+		if err != nil {
+			t.Fatalf("%s: Mnemonic: %v", k.keyType, err)
+		}
+		secret, err := SecretFromMnemonic(mnemonic)
+		if err != nil {
+			t.Fatalf("%s: SecretFromMnemonic: %v", k.keyType, err)
+		}
+		if secret != k.secret {
+			t.Errorf("%s: got %s, want %s", k.keyType, secret, k.secret)
+		}
+
+		// 写错一个单词时校验和不通过
+		words := strings.Fields(mnemonic)
+		if words[0] == "abandon" {
+			words[0] = "ability"
+		} else {
+			words[0] = "abandon"
+		}
+		if _, err := SecretFromMnemonic(strings.Join(words, " ")); err == nil {
+			t.Errorf("%s: mistyped mnemonic was accepted", k.keyType)
+		}
+	}
+
+	identity, _, err := crypto.GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey("age", TypeAge, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := key.Mnemonic(); err == nil {
+		t.Error("age identity was encoded as a mnemonic")
+	}
+}
@@ -0,0 +1,189 @@
+package keyring
+
+import (
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"cryptobackup/pkg/crypto"
+)
+
+// Mnemonic 返回密钥的助记词（BIP39 单词表，带校验和）
+// 只支持16进制的对称密钥和X25519私钥，密钥长度必须是4字节的倍数
+func (k *Key) Mnemonic() (string, error) {
+	if k.Type == TypeAge {
+		return "", fmt.Errorf("age identities cannot be encoded as a mnemonic")
+	}
+	raw, err := hex.DecodeString(k.Secret)
+	if err != nil {
+		return "", fmt.Errorf("invalid key: %w", err)
+	}
+	return crypto.EncodeMnemonic(raw)
+}
+
+// SecretFromMnemonic 将助记词还原为16进制密钥，可以直接用于 Add
+func SecretFromMnemonic(mnemonic string) (string, error) {
+	raw, err := crypto.DecodeMnemonic(mnemonic)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// RecoverySheet 打印后保存在纸上的密钥恢复单
+// 同时包含助记词和16进制密钥，以及用于核对的密钥ID
+type RecoverySheet struct {
+	Name     string    // 密钥名称
+	Type     string    // 密钥类型
+	ID       string    // 密钥ID（指纹）
+	Secret   string    // 密钥（16进制或age身份）
+	Words    []string  // 助记词，密钥无法编码为助记词时为空
+	Public   string    // 公钥（仅X25519和age）
+	Created  time.Time // 生成时间
+	Restore  string    // 恢复命令
+	Warnings []string  // 保管提示
+}
+
+// NewRecoverySheet 创建密钥的恢复单
+func NewRecoverySheet(key *Key) *RecoverySheet {
+	sheet := &RecoverySheet{
+		Name:    key.Name,
+		Type:    key.Type,
+		ID:      key.ID,
+		Secret:  key.Secret,
+		Public:  key.Public,
+		Created: key.Created,
+		Warnings: []string{
+			"任何持有本页的人都可以解密全部备份，请保存在保险柜等安全的地方",
+			"不要拍照、扫描或保存电子副本",
+			"恢复后核对密钥ID与本页一致",
+		},
+	}
+	if sheet.Created.IsZero() {
+		sheet.Created = time.Now().UTC()
+	}
+
+	name := key.Name
+	if name == "" {
+		name = "<名称>"
+	}
+	if mnemonic, err := key.Mnemonic(); err == nil {
+		sheet.Words = strings.Fields(mnemonic)
+		sheet.Restore = fmt.Sprintf("cryptobackup key add -name %s -type %s -mnemonic \"<助记词>\"", name, key.Type)
+	} else {
+		sheet.Restore = fmt.Sprintf("cryptobackup key add -name %s -type %s -key <密钥>", name, key.Type)
+	}
+	return sheet
+}
+
+// Text 返回纯文本形式的恢复单
+func (s *RecoverySheet) Text() string {
+	var b strings.Builder
+	line := strings.Repeat("=", 64)
+
+	fmt.Fprintf(&b, "%s\n  CryptoBackup 密钥恢复单\n%s\n\n", line, line)
+	if s.Name != "" {
+		fmt.Fprintf(&b, "名称:     %s\n", s.Name)
+	}
+	fmt.Fprintf(&b, "类型:     %s\n", s.Type)
+	fmt.Fprintf(&b, "密钥ID:   %s\n", s.ID)
+	fmt.Fprintf(&b, "生成时间: %s\n", s.Created.Local().Format("2006-01-02 15:04"))
+	if s.Public != "" {
+		fmt.Fprintf(&b, "公钥:     %s\n", s.Public)
+	}
+
+	if len(s.Words) > 0 {
+		fmt.Fprintf(&b, "\n助记词（%d 个单词）:\n", len(s.Words))
+		const columns = 4
+		rows := (len(s.Words) + columns - 1) / columns
+		for r := 0; r < rows; r++ {
+			var row strings.Builder
+			for c := 0; c < columns; c++ {
+				if i := c*rows + r; i < len(s.Words) {
+					fmt.Fprintf(&row, "  %2d. %-10s", i+1, s.Words[i])
+				}
+			}
+			b.WriteString(strings.TrimRight(row.String(), " ") + "\n")
+		}
+	}
+
+	b.WriteString("\n密钥:\n")
+	for _, group := range s.SecretGroups() {
+		fmt.Fprintf(&b, "  %s\n", group)
+	}
+
+	fmt.Fprintf(&b, "\n恢复方法:\n  %s\n\n", s.Restore)
+	for _, w := range s.Warnings {
+		fmt.Fprintf(&b, "* %s\n", w)
+	}
+	b.WriteString(line + "\n")
+	return b.String()
+}
+
+// SecretGroups 将16进制密钥按每行32个字符、每组4个字符分组，便于抄写和核对
+// age 身份本身带有校验，原样输出
+func (s *RecoverySheet) SecretGroups() []string {
+	if s.Type == TypeAge {
+		return []string{s.Secret}
+	}
+	var lines []string
+	for start := 0; start < len(s.Secret); start += 32 {
+		end := min(start+32, len(s.Secret))
+		var groups []string
+		for i := start; i < end; i += 4 {
+			groups = append(groups, s.Secret[i:min(i+4, end)])
+		}
+		lines = append(lines, strings.Join(groups, " "))
+	}
+	return lines
+}
+
+// WriteHTML 输出可直接打印的HTML恢复单（不依赖外部资源）
+func (s *RecoverySheet) WriteHTML(w io.Writer) error {
+	return recoverySheetTemplate.Execute(w, s)
+}
+
+var recoverySheetTemplate = template.Must(template.New("recovery").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="UTF-8">
+<title>CryptoBackup 密钥恢复单{{if .Name}} - {{.Name}}{{end}}</title>
+<style>
+  body { font-family: sans-serif; max-width: 800px; margin: 2em auto; color: #000; }
+  h1 { border-bottom: 3px double #000; padding-bottom: .3em; }
+  table.info td { padding: .2em 1em .2em 0; vertical-align: top; }
+  code, .words li, .secret { font-family: monospace; font-size: 1.1em; }
+  .words { columns: 4; list-style-position: inside; padding: 0; border: 1px solid #000; padding: .8em; }
+  .words li { padding: .25em 0; }
+  .secret { border: 1px solid #000; padding: .8em; line-height: 1.8; }
+  .warning { border: 2px solid #000; padding: .5em 1em; margin-top: 2em; }
+  @media print { .noprint { display: none; } body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>CryptoBackup 密钥恢复单</h1>
+<table class="info">
+  {{if .Name}}<tr><td>名称</td><td><strong>{{.Name}}</strong></td></tr>{{end}}
+  <tr><td>类型</td><td>{{.Type}}</td></tr>
+  <tr><td>密钥ID</td><td><code>{{.ID}}</code></td></tr>
+  <tr><td>生成时间</td><td>{{.Created.Local.Format "2006-01-02 15:04"}}</td></tr>
+  {{if .Public}}<tr><td>公钥</td><td><code>{{.Public}}</code></td></tr>{{end}}
+</table>
+{{if .Words}}
+<h2>助记词（{{len .Words}} 个单词）</h2>
+<ol class="words">{{range .Words}}<li>{{.}}</li>{{end}}</ol>
+{{end}}
+<h2>密钥</h2>
+<div class="secret">{{range .SecretGroups}}{{.}}<br>{{end}}</div>
+<h2>恢复方法</h2>
+<p><code>{{.Restore}}</code></p>
+<div class="warning">
+  <ul>{{range .Warnings}}<li>{{.}}</li>{{end}}</ul>
+</div>
+<p class="noprint"><button onclick="window.print()">打印</button></p>
+</body>
+</html>
+`))
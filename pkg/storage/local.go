@@ -3,13 +3,17 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 )
 
 // LocalStorage 本地存储实现（用于测试或本地备份）
+// 路径经过 CleanPath 检查，拒绝 .meta 文件和临时文件的名称，并且不会跟随指向根目录之外的符号链接；在 Windows 上还会拒绝设备名
 type LocalStorage struct {
 	basePath string // 本地存储根目录
 }
@@ -29,8 +33,16 @@ func NewLocalStorage(basePath string) (*LocalStorage, error) {
 }
 
 // Upload 上传文件到本地存储
+// 数据先写入同目录下的临时文件再重命名，覆盖已有文件时不会留下写了一半的内容
 func (s *LocalStorage) Upload(ctx context.Context, remotePath string, data io.Reader, metadata map[string]string) error {
-	fullPath := filepath.Join(s.basePath, remotePath)
+	name, err := cleanSidecarFilePath(remotePath)
+	if err != nil {
+		return err
+	}
+	fullPath, err := s.fullPath(remotePath, name)
+	if err != nil {
+		return err
+	}
 
 	// 创建目录
 	dir := filepath.Dir(fullPath)
@@ -38,15 +50,11 @@ func (s *LocalStorage) Upload(ctx context.Context, remotePath string, data io.Re
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// 创建文件
-	file, err := os.Create(fullPath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer file.Close()
-
 	// 写入数据
-	if _, err := io.Copy(file, data); err != nil {
+	if err := writeFileAtomic(fullPath, func(w io.Writer) error {
+		_, err := io.Copy(w, data)
+		return err
+	}); err != nil {
 		return fmt.Errorf("failed to write data: %w", err)
 	}
 
@@ -62,7 +70,10 @@ func (s *LocalStorage) Upload(ctx context.Context, remotePath string, data io.Re
 
 // Download 从本地存储下载文件
 func (s *LocalStorage) Download(ctx context.Context, remotePath string, dst io.Writer) error {
-	fullPath := filepath.Join(s.basePath, remotePath)
+	fullPath, err := s.resolve(remotePath)
+	if err != nil {
+		return err
+	}
 
 	file, err := os.Open(fullPath)
 	if err != nil {
@@ -79,7 +90,14 @@ func (s *LocalStorage) Download(ctx context.Context, remotePath string, dst io.W
 
 // Delete 删除本地文件
 func (s *LocalStorage) Delete(ctx context.Context, remotePath string) error {
-	fullPath := filepath.Join(s.basePath, remotePath)
+	name, err := cleanSidecarFilePath(remotePath)
+	if err != nil {
+		return err
+	}
+	fullPath, err := s.fullPath(remotePath, name)
+	if err != nil {
+		return err
+	}
 
 	if err := os.Remove(fullPath); err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
@@ -94,7 +112,10 @@ func (s *LocalStorage) Delete(ctx context.Context, remotePath string) error {
 
 // List 列出目录下的文件
 func (s *LocalStorage) List(ctx context.Context, remotePath string) ([]FileInfo, error) {
-	fullPath := filepath.Join(s.basePath, remotePath)
+	fullPath, err := s.resolve(remotePath)
+	if err != nil {
+		return nil, err
+	}
 
 	entries, err := os.ReadDir(fullPath)
 	if err != nil {
@@ -103,8 +124,8 @@ func (s *LocalStorage) List(ctx context.Context, remotePath string) ([]FileInfo,
 
 	var files []FileInfo
 	for _, entry := range entries {
-		// 跳过元数据文件
-		if filepath.Ext(entry.Name()) == ".meta" {
+		// 跳过元数据文件和写入中的临时文件
+		if filepath.Ext(entry.Name()) == ".meta" || isTempFile(entry.Name()) {
 			continue
 		}
 
@@ -132,9 +153,12 @@ func (s *LocalStorage) List(ctx context.Context, remotePath string) ([]FileInfo,
 
 // Exists 检查文件是否存在
 func (s *LocalStorage) Exists(ctx context.Context, remotePath string) (bool, error) {
-	fullPath := filepath.Join(s.basePath, remotePath)
+	fullPath, err := s.resolve(remotePath)
+	if err != nil {
+		return false, err
+	}
 
-	_, err := os.Stat(fullPath)
+	_, err = os.Stat(fullPath)
 	if err == nil {
 		return true, nil
 	}
@@ -146,7 +170,10 @@ func (s *LocalStorage) Exists(ctx context.Context, remotePath string) (bool, err
 
 // GetMetadata 获取文件元数据
 func (s *LocalStorage) GetMetadata(ctx context.Context, remotePath string) (map[string]string, error) {
-	fullPath := filepath.Join(s.basePath, remotePath)
+	fullPath, err := s.resolve(remotePath)
+	if err != nil {
+		return nil, err
+	}
 
 	exists, err := s.Exists(ctx, remotePath)
 	if err != nil {
@@ -164,6 +191,33 @@ func (s *LocalStorage) GetMetadata(ctx context.Context, remotePath string) (map[
 	return metadata, nil
 }
 
+// resolve 检查存储路径并返回对应的本地路径
+func (s *LocalStorage) resolve(remotePath string) (string, error) {
+	name, err := cleanSidecarPath(remotePath)
+	if err != nil {
+		return "", err
+	}
+	return s.fullPath(remotePath, name)
+}
+
+// fullPath 返回 CleanPath 规范化后的路径对应的本地路径
+// 路径经过的符号链接指向根目录之外时返回 ErrSymlinkEscape；在 Windows 上设备名等保留的名称返回 ErrReservedName
+func (s *LocalStorage) fullPath(remotePath, name string) (string, error) {
+	if runtime.GOOS == "windows" && name != "" {
+		if err := checkWindowsNames(remotePath, name); err != nil {
+			return "", err
+		}
+	}
+	fullPath := filepath.Join(s.basePath, filepath.FromSlash(name))
+	if err := checkLocalSymlinks(s.basePath, fullPath); err != nil {
+		if errors.Is(err, ErrSymlinkEscape) {
+			return "", &PathError{Path: remotePath, Err: err}
+		}
+		return "", err
+	}
+	return fullPath, nil
+}
+
 // saveMetadata 保存元数据到.meta文件
 func (s *LocalStorage) saveMetadata(filePath string, metadata map[string]string) error {
 	metaPath := filePath + ".meta"
@@ -173,13 +227,56 @@ func (s *LocalStorage) saveMetadata(filePath string, metadata map[string]string)
 		return err
 	}
 
-	return os.WriteFile(metaPath, data, 0644)
+	return writeFileAtomic(metaPath, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// 写入中的临时文件名
+const (
+	tempFilePrefix = ".cryptobackup-"
+	tempFileSuffix = ".tmp"
+)
+
+// writeFileAtomic 将write的输出写入临时文件，成功后重命名为path
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempFilePrefix+"*"+tempFileSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// isTempFile 检查是否为写入中的临时文件
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, tempFilePrefix) && strings.HasSuffix(name, tempFileSuffix)
 }
 
 // loadMetadata 从.meta文件加载元数据
 func (s *LocalStorage) loadMetadata(filePath string) (map[string]string, error) {
 	metaPath := filePath + ".meta"
 
+	// 元数据文件本身也可能是指向根目录之外的符号链接
+	if err := checkLocalSymlinks(s.basePath, metaPath); err != nil {
+		return nil, err
+	}
 	data, err := os.ReadFile(metaPath)
 	if err != nil {
 		if os.IsNotExist(err) {
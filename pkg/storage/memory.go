@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemStorage 内存存储实现，进程退出后数据丢失，用于测试和演示
+type MemStorage struct {
+	mu    sync.RWMutex
+	files map[string]*memFile // 键为不以 / 开头的规范化路径
+}
+
+// memFile 内存中的文件
+type memFile struct {
+	data     []byte
+	metadata map[string]string
+	modTime  time.Time
+}
+
+// NewMemStorage 创建空的内存存储
+func NewMemStorage() *MemStorage {
+	return &MemStorage{files: make(map[string]*memFile)}
+}
+
+// Upload 保存文件到内存
+func (s *MemStorage) Upload(ctx context.Context, remotePath string, data io.Reader, metadata map[string]string) error {
+	name, err := cleanFilePath(remotePath)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, data); err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isDirLocked(name) {
+		return fmt.Errorf("failed to write data: %s is a directory", remotePath)
+	}
+	s.files[name] = &memFile{data: buf.Bytes(), metadata: copyMetadata(metadata), modTime: time.Now()}
+	return nil
+}
+
+// Download 从内存读取文件
+func (s *MemStorage) Download(ctx context.Context, remotePath string, dst io.Writer) error {
+	name, err := CleanPath(remotePath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	file, ok := s.files[name]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("file not found: %s", remotePath)
+	}
+
+	if _, err := dst.Write(file.data); err != nil {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除内存中的文件
+func (s *MemStorage) Delete(ctx context.Context, remotePath string) error {
+	name, err := cleanFilePath(remotePath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[name]; !ok {
+		return fmt.Errorf("failed to delete file: file not found: %s", remotePath)
+	}
+	delete(s.files, name)
+	return nil
+}
+
+// List 列出目录下的文件和子目录，目录由文件路径隐式构成
+func (s *MemStorage) List(ctx context.Context, remotePath string) ([]FileInfo, error) {
+	dir, err := CleanPath(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if dir != "" && !s.isDirLocked(dir) {
+		return nil, fmt.Errorf("failed to read directory: %s not found", remotePath)
+	}
+
+	var files []FileInfo
+	dirs := make(map[string]bool)
+	for name, file := range s.files {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		if child, _, isDir := strings.Cut(rest, "/"); isDir {
+			if !dirs[child] {
+				dirs[child] = true
+				files = append(files, FileInfo{Path: path.Join(remotePath, child), IsDir: true})
+			}
+			continue
+		}
+		files = append(files, FileInfo{
+			Path:     path.Join(remotePath, rest),
+			Size:     int64(len(file.data)),
+			ModTime:  file.modTime.Unix(),
+			Metadata: copyMetadata(file.metadata),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+// Exists 检查文件或目录是否存在
+func (s *MemStorage) Exists(ctx context.Context, remotePath string) (bool, error) {
+	name, err := CleanPath(remotePath)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.files[name]
+	return ok || name == "" || s.isDirLocked(name), nil
+}
+
+// GetMetadata 获取文件元数据
+func (s *MemStorage) GetMetadata(ctx context.Context, remotePath string) (map[string]string, error) {
+	name, err := CleanPath(remotePath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	file, ok := s.files[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("file not found: %s", remotePath)
+	}
+	return copyMetadata(file.metadata), nil
+}
+
+// isDirLocked 检查是否有文件位于该目录下，调用方必须持有锁
+func (s *MemStorage) isDirLocked(name string) bool {
+	prefix := name + "/"
+	for key := range s.files {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyMetadata 复制元数据，调用方修改返回值不会影响存储中的数据
+func copyMetadata(metadata map[string]string) map[string]string {
+	result := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMemStorage(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+
+	metadata := map[string]string{"algorithm": "AES-256-GCM"}
+	for _, p := range []string{"/a.enc", "/dir/b.enc", "dir/sub/c.enc"} {
+		if err := s.Upload(ctx, p, strings.NewReader("data "+p), metadata); err != nil {
+			t.Fatalf("Upload(%s): %v", p, err)
+		}
+	}
+	// 保存的是元数据的副本
+	metadata["algorithm"] = "changed"
+
+	var got bytes.Buffer
+	if err := s.Download(ctx, "dir/b.enc", &got); err != nil || got.String() != "data /dir/b.enc" {
+		t.Errorf("Download = %q, %v", got.String(), err)
+	}
+	stored, err := s.GetMetadata(ctx, "/dir/b.enc")
+	if err != nil {
+		t.Fatalf("GetMetadata: %v", err)
+	}
+	assertMetadata(t, stored, map[string]string{"algorithm": "AES-256-GCM"})
+	stored["algorithm"] = "changed"
+	if again, _ := s.GetMetadata(ctx, "/dir/b.enc"); again["algorithm"] != "AES-256-GCM" {
+		t.Error("GetMetadata returned the stored map")
+	}
+
+	// 目录由文件路径隐式构成
+	files, err := s.List(ctx, "/dir")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 2 || files[0].Path != "/dir/b.enc" || files[0].Size != int64(len("data /dir/b.enc")) ||
+		files[1].Path != "/dir/sub" || !files[1].IsDir {
+		t.Errorf("List(/dir) = %+v", files)
+	}
+	if files[0].Metadata["algorithm"] != "AES-256-GCM" {
+		t.Errorf("List metadata = %v", files[0].Metadata)
+	}
+	if root, err := s.List(ctx, "/"); err != nil || len(root) != 2 || root[0].Path != "/a.enc" || root[1].Path != "/dir" {
+		t.Errorf("List(/) = %+v, %v", root, err)
+	}
+	if _, err := s.List(ctx, "/missing"); err == nil {
+		t.Error("List of a missing directory succeeded")
+	}
+	if empty, err := NewMemStorage().List(ctx, "/"); err != nil || len(empty) != 0 {
+		t.Errorf("List of an empty storage = %+v, %v", empty, err)
+	}
+
+	for p, want := range map[string]bool{"/a.enc": true, "/dir": true, "/dir/sub": true, "/": true, "/missing": false, "/di": false} {
+		if exists, err := s.Exists(ctx, p); err != nil || exists != want {
+			t.Errorf("Exists(%s) = %v, %v; want %v", p, exists, err, want)
+		}
+	}
+
+	// 删除最后一个文件后目录随之消失
+	if err := s.Delete(ctx, "/dir/sub/c.enc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if exists, _ := s.Exists(ctx, "/dir/sub"); exists {
+		t.Error("empty directory still exists")
+	}
+	if err := s.Delete(ctx, "/dir/sub/c.enc"); err == nil {
+		t.Error("deleting a missing file succeeded")
+	}
+	if err := s.Download(ctx, "/dir/sub/c.enc", &got); err == nil {
+		t.Error("deleted file was downloaded")
+	}
+	if _, err := s.GetMetadata(ctx, "/dir/sub/c.enc"); err == nil {
+		t.Error("metadata of a deleted file was returned")
+	}
+}
+
+func TestMemStorageRejectsInvalidPaths(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	if err := s.Upload(ctx, "/dir/a.enc", strings.NewReader("data"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Upload(ctx, "/dir", strings.NewReader("data"), nil); err == nil {
+		t.Error("a file replaced a directory")
+	}
+	for _, p := range []string{"/", ""} {
+		if err := s.Upload(ctx, p, strings.NewReader("data"), nil); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Upload(%q) = %v, want ErrInvalidPath", p, err)
+		}
+		if err := s.Delete(ctx, p); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidPath", p, err)
+		}
+	}
+	if err := s.Download(ctx, "/../dir/a.enc", &bytes.Buffer{}); !errors.Is(err, ErrPathTraversal) {
+		t.Errorf("Download through ..: got %v, want ErrPathTraversal", err)
+	}
+	if _, err := s.List(ctx, "/dir/../.."); !errors.Is(err, ErrPathTraversal) {
+		t.Errorf("List through ..: got %v, want ErrPathTraversal", err)
+	}
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPath 存储路径无效，路径检查返回的错误都可以用 errors.Is 匹配它
+var ErrInvalidPath = errors.New("invalid path")
+
+var (
+	// ErrPathTraversal 路径中的 .. 超出了存储根目录
+	ErrPathTraversal = fmt.Errorf("%w: escapes storage root", ErrInvalidPath)
+
+	// ErrSymlinkEscape 路径经过的符号链接指向存储根目录之外
+	ErrSymlinkEscape = fmt.Errorf("%w: symlink escapes storage root", ErrInvalidPath)
+
+	// ErrNULByte 路径包含 NUL 字符
+	ErrNULByte = fmt.Errorf("%w: contains NUL byte", ErrInvalidPath)
+
+	// ErrReservedName 路径包含保留的名称
+	ErrReservedName = fmt.Errorf("%w: reserved name", ErrInvalidPath)
+)
+
+// PathError 存储路径检查失败
+type PathError struct {
+	Path string // 调用方传入的路径
+	Err  error  // 失败原因，ErrInvalidPath 或包装了它的错误
+}
+
+// Error 实现 error 接口
+func (e *PathError) Error() string {
+	return e.Err.Error() + ": " + strconv.Quote(e.Path)
+}
+
+// Unwrap 返回失败原因
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// CleanPath 检查存储路径并规范化为不以 / 开头、以 / 分隔的相对路径，根目录为空字符串
+//
+// \ 视为路径分隔符。. 和 .. 按层级解析，.. 超出根目录时返回 ErrPathTraversal，
+// 而不是像 path.Clean 那样停在根目录，../../etc/passwd 不会被悄悄当成另一个文件。
+// 包含 NUL 字符时返回 ErrNULByte。所有存储都使用这个函数。
+// 保留的名称由各存储自己检查：.meta 元数据文件和临时文件只在把它们保存在文件旁边的存储中拒绝
+// （见 cleanSidecarPath），Windows 的设备名只在 Windows 上的本地存储中拒绝（见 checkWindowsNames），
+// S3 和内存存储中 a.meta 和 con.txt 这样的名称是普通文件
+func CleanPath(remotePath string) (string, error) {
+	if strings.IndexByte(remotePath, 0) >= 0 {
+		return "", &PathError{Path: remotePath, Err: ErrNULByte}
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(strings.ReplaceAll(remotePath, "\\", "/"), "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			if len(segments) == 0 {
+				return "", &PathError{Path: remotePath, Err: ErrPathTraversal}
+			}
+			segments = segments[:len(segments)-1]
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// cleanFilePath 与 CleanPath 相同，但不接受根目录，用于上传和删除等针对单个文件的操作
+func cleanFilePath(remotePath string) (string, error) {
+	name, err := CleanPath(remotePath)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", &PathError{Path: remotePath, Err: ErrInvalidPath}
+	}
+	return name, nil
+}
+
+// cleanSidecarPath 与 CleanPath 相同，但拒绝 .meta 元数据文件和临时文件的名称（见 checkSidecarNames）
+// 用于在文件旁边保存 .meta 文件、先写入临时文件再重命名的存储：本地、WebDAV 和 SFTP
+func cleanSidecarPath(remotePath string) (string, error) {
+	name, err := CleanPath(remotePath)
+	if err != nil {
+		return "", err
+	}
+	if err := checkSidecarNames(remotePath, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// cleanSidecarFilePath 与 cleanFilePath 相同，但拒绝 .meta 元数据文件和临时文件的名称
+func cleanSidecarFilePath(remotePath string) (string, error) {
+	name, err := cleanFilePath(remotePath)
+	if err != nil {
+		return "", err
+	}
+	if err := checkSidecarNames(remotePath, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// checkSidecarNames 检查 CleanPath 规范化后的路径中是否有存储自己使用的文件名
+// 以 .meta 结尾的名称会与其他文件的元数据文件冲突，写入中的临时文件名会被列表跳过，都返回 ErrReservedName
+func checkSidecarNames(remotePath, name string) error {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasSuffix(segment, ".meta") || isTempFile(segment) {
+			return &PathError{Path: remotePath, Err: ErrReservedName}
+		}
+	}
+	return nil
+}
+
+// windowsDeviceNames Windows 保留的设备名，打开这些文件会访问设备而不是普通文件
+var windowsDeviceNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// checkWindowsNames 检查 CleanPath 规范化后的路径中是否有 Windows 保留的名称
+// Windows 的设备名（CON、NUL、COM1 等，带扩展名也算）和只由点和空格组成的名称返回 ErrReservedName
+func checkWindowsNames(remotePath, name string) error {
+	for _, segment := range strings.Split(name, "/") {
+		if isWindowsReservedName(segment) {
+			return &PathError{Path: remotePath, Err: ErrReservedName}
+		}
+	}
+	return nil
+}
+
+// isWindowsReservedName 检查路径中的一段在 Windows 上是否为保留的名称
+func isWindowsReservedName(segment string) bool {
+	// Windows 忽略名称末尾的点和空格，"..." 和 "CON." 分别等同于当前目录和 CON
+	trimmed := strings.TrimRight(segment, ". ")
+	if trimmed == "" {
+		return true
+	}
+	base, _, _ := strings.Cut(trimmed, ".")
+	return windowsDeviceNames[strings.ToUpper(strings.TrimRight(base, " "))]
+}
+
+// checkLocalSymlinks 检查本地路径解析符号链接后是否仍在 root 之内
+// 从 p 开始向上找到第一个存在的路径并解析，不存在的部分之后由存储自己创建，不会是符号链接
+func checkLocalSymlinks(root, p string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	realRoot, err = filepath.Abs(realRoot)
+	if err != nil {
+		return err
+	}
+
+	for {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			if real, err = filepath.Abs(real); err != nil {
+				return err
+			}
+			if rel, err := filepath.Rel(realRoot, real); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return ErrSymlinkEscape
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return nil
+		}
+		p = parent
+	}
+}
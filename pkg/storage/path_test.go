@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{"", "", nil},
+		{"/", "", nil},
+		{"/a/b.enc", "a/b.enc", nil},
+		{`a\b\..\c`, "a/c", nil},
+		{"./a//b/.", "a/b", nil},
+		{"a/../..", "", ErrPathTraversal},
+		{"../../etc/passwd", "", ErrPathTraversal},
+		{"a/b\x00.enc", "", ErrNULByte},
+		// .meta 文件和临时文件的名称只在保存 .meta 文件的存储中拒绝
+		{"a/file.meta", "a/file.meta", nil},
+		{"a/" + tempFilePrefix + "123" + tempFileSuffix, "a/" + tempFilePrefix + "123" + tempFileSuffix, nil},
+		// Windows 的保留名称只在 Windows 上的本地存储中拒绝
+		{"con.txt", "con.txt", nil},
+		{"dir/NUL/a", "dir/NUL/a", nil},
+		{"a/.../b", "a/.../b", nil},
+	}
+	for _, tt := range tests {
+		got, err := CleanPath(tt.path)
+		if tt.err != nil {
+			var pathErr *PathError
+			if !errors.Is(err, tt.err) || !errors.Is(err, ErrInvalidPath) || !errors.As(err, &pathErr) {
+				t.Errorf("CleanPath(%q) error = %v, want %v", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("CleanPath(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestCleanSidecarPath(t *testing.T) {
+	for _, name := range []string{"file.meta", "dir.meta/a.enc", "a/" + tempFilePrefix + "123" + tempFileSuffix} {
+		if _, err := cleanSidecarPath(name); !errors.Is(err, ErrReservedName) {
+			t.Errorf("cleanSidecarPath(%q) = %v, want ErrReservedName", name, err)
+		}
+		if _, err := cleanSidecarFilePath(name); !errors.Is(err, ErrReservedName) {
+			t.Errorf("cleanSidecarFilePath(%q) = %v, want ErrReservedName", name, err)
+		}
+	}
+	for _, name := range []string{"a/b.enc", "metadata", "a.meta.enc", tempFilePrefix + "123", "x" + tempFileSuffix} {
+		if got, err := cleanSidecarPath("/" + name); err != nil || got != name {
+			t.Errorf("cleanSidecarPath(%q) = %q, %v", name, got, err)
+		}
+	}
+	if got, err := cleanSidecarPath("/"); err != nil || got != "" {
+		t.Errorf("cleanSidecarPath(/) = %q, %v", got, err)
+	}
+	if _, err := cleanSidecarFilePath("/"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("cleanSidecarFilePath(/) = %v, want ErrInvalidPath", err)
+	}
+	if _, err := cleanSidecarPath("../a.enc"); !errors.Is(err, ErrPathTraversal) {
+		t.Errorf("cleanSidecarPath(../a.enc) = %v, want ErrPathTraversal", err)
+	}
+}
+
+func TestSidecarNamesPerBackend(t *testing.T) {
+	ctx := context.Background()
+	local, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, webdavStorage := newTestWebDAV(t, true)
+	_, sftpConfig := newTestSFTP(t)
+	sftpStorage, err := NewSFTPStorage(sftpConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sftpStorage.Close()
+	_, s3Storage := newFakeS3(t)
+
+	reserved := []string{"/a.enc.meta", "/" + tempFilePrefix + "123" + tempFileSuffix}
+	// 在文件旁边保存 .meta 文件的存储拒绝这些名称
+	for _, s := range []Storage{local, webdavStorage, sftpStorage} {
+		for _, p := range reserved {
+			if err := s.Upload(ctx, p, strings.NewReader("data"), nil); !errors.Is(err, ErrReservedName) {
+				t.Errorf("%T: Upload(%s) = %v, want ErrReservedName", s, p, err)
+			}
+			if _, err := s.Exists(ctx, p); !errors.Is(err, ErrReservedName) {
+				t.Errorf("%T: Exists(%s) = %v, want ErrReservedName", s, p, err)
+			}
+		}
+	}
+	// S3 和内存存储中是普通的对象
+	for _, s := range []Storage{NewMemStorage(), s3Storage} {
+		for _, p := range reserved {
+			if err := s.Upload(ctx, p, strings.NewReader("data"), map[string]string{"k": "v"}); err != nil {
+				t.Errorf("%T: Upload(%s) = %v", s, p, err)
+				continue
+			}
+			if exists, err := s.Exists(ctx, p); err != nil || !exists {
+				t.Errorf("%T: Exists(%s) = %v, %v", s, p, exists, err)
+			}
+		}
+		files, err := s.List(ctx, "/")
+		if err != nil || len(files) != len(reserved) {
+			t.Errorf("%T: List = %+v, %v", s, files, err)
+		}
+	}
+}
+
+func TestCheckWindowsNames(t *testing.T) {
+	for _, name := range []string{"CON", "con.txt", "dir/Nul.tar.gz", "LPT1 ", "aux.", "COM9/a", "a/...", ". ."} {
+		if err := checkWindowsNames(name, name); !errors.Is(err, ErrReservedName) {
+			t.Errorf("checkWindowsNames(%q) = %v, want ErrReservedName", name, err)
+		}
+	}
+	for _, name := range []string{"console", "a/COM10", "connect.txt", "dir/.hidden", "a..b"} {
+		if err := checkWindowsNames(name, name); err != nil {
+			t.Errorf("checkWindowsNames(%q) = %v, want nil", name, err)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory 根据配置创建存储
+type Factory func(cfg *Config) (Storage, error)
+
+// Config.Options 中所有存储通用的选项
+const (
+	// OptionURL 存储地址（string），如 s3://bucket/prefix，各存储从中解析自己的配置
+	OptionURL = "url"
+
+	// OptionPath 本地存储的目录（string）
+	OptionPath = "path"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+
+	memMu        sync.Mutex
+	memInstances = make(map[string]*MemStorage)
+)
+
+func init() {
+	Register("file", newLocalFromConfig)
+	Register("s3", newS3FromConfig)
+	Register("webdav", newWebDAVFromConfig)
+	Register("sftp", newSFTPFromConfig)
+	Register("mem", newMemFromConfig)
+}
+
+// Register 注册存储类型
+// 名称重复或factory为nil时panic，通常在包的init函数中调用
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" || factory == nil {
+		panic("storage: Register called with empty name or nil factory")
+	}
+	if _, exists := registry[name]; exists {
+		panic("storage: Register called twice for type " + name)
+	}
+	registry[name] = factory
+}
+
+// New 根据配置中的存储类型创建存储
+// 类型为 family+variant 形式（如 webdav+http）且没有完全匹配的注册项时，使用 family 的工厂函数
+func New(cfg *Config) (Storage, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[cfg.Type]
+	if !ok {
+		if family, _, found := strings.Cut(cfg.Type, "+"); found {
+			factory, ok = registry[family]
+		}
+	}
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage type: %s", cfg.Type)
+	}
+	return factory(cfg)
+}
+
+// ParseURL 将存储地址解析为配置，地址的 scheme 即存储类型
+// 不包含 :// 的地址视为本地目录，因此 ./backup 和 C:\backup 都是本地存储
+func ParseURL(rawURL string) (*Config, error) {
+	if !strings.Contains(rawURL, "://") {
+		return &Config{Type: "file", Options: map[string]interface{}{OptionPath: rawURL}}, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage url: %w", err)
+	}
+	return &Config{
+		Type:    strings.ToLower(u.Scheme),
+		Options: map[string]interface{}{OptionURL: rawURL},
+	}, nil
+}
+
+// Open 根据存储地址创建存储，等同于 ParseURL 之后调用 New
+func Open(rawURL string) (Storage, error) {
+	cfg, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// Types 返回已注册的存储类型（按名称排序）
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StringOption 读取字符串类型的选项，不存在时返回空字符串
+func (c *Config) StringOption(name string) (string, error) {
+	v, ok := c.Options[name]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("option %s must be a string, got %T", name, v)
+	}
+	return s, nil
+}
+
+// BoolOption 读取布尔类型的选项，不存在时返回 false
+func (c *Config) BoolOption(name string) (bool, error) {
+	v, ok := c.Options[name]
+	if !ok || v == nil {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("option %s must be a bool, got %T", name, v)
+	}
+	return b, nil
+}
+
+// applyStringOptions 用设置了的字符串选项覆盖对应的字段
+func (c *Config) applyStringOptions(fields map[string]*string) error {
+	for name, field := range fields {
+		v, err := c.StringOption(name)
+		if err != nil {
+			return err
+		}
+		if v != "" {
+			*field = v
+		}
+	}
+	return nil
+}
+
+// newLocalFromConfig 选项 path 为本地目录，也可以使用 file:///abs/path 或 file://./relative 形式的 url
+func newLocalFromConfig(cfg *Config) (Storage, error) {
+	basePath, err := cfg.StringOption(OptionPath)
+	if err != nil {
+		return nil, err
+	}
+	if basePath == "" {
+		rawURL, err := cfg.StringOption(OptionURL)
+		if err != nil {
+			return nil, err
+		}
+		if rawURL != "" {
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid file url: %w", err)
+			}
+			basePath = u.Host + u.Path
+		}
+	}
+	return NewLocalStorage(basePath)
+}
+
+// newS3FromConfig 从 url 选项（见 ParseS3URL）或 bucket、prefix、endpoint、region、path_style 选项创建 S3 存储
+// 选项 access_key_id、secret_access_key 和 session_token 覆盖环境变量中的凭证
+func newS3FromConfig(cfg *Config) (Storage, error) {
+	rawURL, err := cfg.StringOption(OptionURL)
+	if err != nil {
+		return nil, err
+	}
+	config := s3ConfigFromEnv()
+	if rawURL != "" {
+		if config, err = ParseS3URL(rawURL); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyStringOptions(map[string]*string{
+		"bucket":            &config.Bucket,
+		"prefix":            &config.Prefix,
+		"endpoint":          &config.Endpoint,
+		"region":            &config.Region,
+		"access_key_id":     &config.AccessKeyID,
+		"secret_access_key": &config.SecretAccessKey,
+		"session_token":     &config.SessionToken,
+	}); err != nil {
+		return nil, err
+	}
+	// 与 ParseS3URL 相同，指定了 endpoint 时默认使用路径形式的地址
+	if _, ok := cfg.Options["path_style"]; ok {
+		if config.PathStyle, err = cfg.BoolOption("path_style"); err != nil {
+			return nil, err
+		}
+	} else if rawURL == "" {
+		config.PathStyle = config.Endpoint != ""
+	}
+	return NewS3Storage(config)
+}
+
+// newWebDAVFromConfig 从 url 选项创建 WebDAV 存储，url 可以是 webdav://（见 ParseWebDAVURL）或 http(s):// 地址
+// 选项 username 和 password 覆盖地址和环境变量中的认证信息，sidecar 强制使用 .meta 文件
+func newWebDAVFromConfig(cfg *Config) (Storage, error) {
+	rawURL, err := cfg.StringOption(OptionURL)
+	if err != nil {
+		return nil, err
+	}
+	if rawURL == "" {
+		return nil, fmt.Errorf("option %s is required for webdav storage", OptionURL)
+	}
+
+	var config WebDAVConfig
+	if strings.HasPrefix(rawURL, "http://") || strings.HasPrefix(rawURL, "https://") {
+		config.URL = rawURL
+	} else if config, err = ParseWebDAVURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.applyStringOptions(map[string]*string{
+		"username": &config.Username,
+		"password": &config.Password,
+	}); err != nil {
+		return nil, err
+	}
+	sidecar, err := cfg.BoolOption("sidecar")
+	if err != nil {
+		return nil, err
+	}
+	config.SidecarMetadata = config.SidecarMetadata || sidecar
+	return NewWebDAVStorage(config)
+}
+
+// newSFTPFromConfig 从 url 选项（见 ParseSFTPURL）或 host、user、path 选项创建 SFTP 存储
+// 选项 key_file、key_passphrase 和 known_hosts 覆盖地址和环境变量中的设置
+func newSFTPFromConfig(cfg *Config) (Storage, error) {
+	rawURL, err := cfg.StringOption(OptionURL)
+	if err != nil {
+		return nil, err
+	}
+	var config SFTPConfig
+	if rawURL != "" {
+		if config, err = ParseSFTPURL(rawURL); err != nil {
+			return nil, err
+		}
+	}
+
+	var keyFile string
+	if err := cfg.applyStringOptions(map[string]*string{
+		"host":           &config.Host,
+		"user":           &config.User,
+		OptionPath:       &config.Path,
+		"key_file":       &keyFile,
+		"key_passphrase": &config.KeyPassphrase,
+		"known_hosts":    &config.KnownHostsFile,
+	}); err != nil {
+		return nil, err
+	}
+	if keyFile != "" {
+		config.KeyFiles = []string{keyFile}
+	}
+	return NewSFTPStorage(config)
+}
+
+// newMemFromConfig mem:// 每次创建新的空存储，mem://name 在进程内共享同名的存储
+func newMemFromConfig(cfg *Config) (Storage, error) {
+	rawURL, err := cfg.StringOption(OptionURL)
+	if err != nil {
+		return nil, err
+	}
+	name := ""
+	if rawURL != "" {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mem url: %w", err)
+		}
+		name = u.Host
+	}
+	if name == "" {
+		return NewMemStorage(), nil
+	}
+
+	memMu.Lock()
+	defer memMu.Unlock()
+	store, ok := memInstances[name]
+	if !ok {
+		store = NewMemStorage()
+		memInstances[name] = store
+	}
+	return store, nil
+}
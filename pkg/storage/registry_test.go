@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// registerForTest 注册测试使用的存储类型，测试结束后移除
+func registerForTest(t *testing.T, name string, factory Factory) {
+	t.Helper()
+	Register(name, factory)
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, name)
+		registryMu.Unlock()
+	})
+}
+
+// registerPanics 检查 Register 是否panic
+func registerPanics(name string, factory Factory) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	Register(name, factory)
+	return false
+}
+
+// openForTest 打开存储地址，测试结束后关闭需要关闭的存储
+func openForTest(t *testing.T, rawURL string) Storage {
+	t.Helper()
+	s, err := Open(rawURL)
+	if err != nil {
+		t.Fatalf("Open(%s): %v", rawURL, err)
+	}
+	if closer, ok := s.(io.Closer); ok {
+		t.Cleanup(func() { closer.Close() })
+	}
+	return s
+}
+
+// checkRoundTrip 上传后下载并读取元数据，检查存储可以使用
+func checkRoundTrip(t *testing.T, s Storage) {
+	t.Helper()
+	ctx := context.Background()
+	metadata := map[string]string{"original_name": "a.txt"}
+	if err := s.Upload(ctx, "/dir/a.enc", strings.NewReader("data"), metadata); err != nil {
+		t.Fatalf("%T: Upload: %v", s, err)
+	}
+	var got bytes.Buffer
+	if err := s.Download(ctx, "/dir/a.enc", &got); err != nil || got.String() != "data" {
+		t.Fatalf("%T: Download = %q, %v", s, got.String(), err)
+	}
+	stored, err := s.GetMetadata(ctx, "/dir/a.enc")
+	if err != nil {
+		t.Fatalf("%T: GetMetadata: %v", s, err)
+	}
+	assertMetadata(t, stored, metadata)
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		rawURL string
+		typ    string
+		option string
+	}{
+		{"./backup", "file", OptionPath},
+		{`C:\backup`, "file", OptionPath},
+		{"/var/backups", "file", OptionPath},
+		{"file:///var/backups", "file", OptionURL},
+		{"s3://bucket/prefix?region=eu-west-1", "s3", OptionURL},
+		{"WebDAV://nas.local/backups", "webdav", OptionURL},
+		{"webdav+http://nas.local/backups", "webdav+http", OptionURL},
+		{"sftp://backup@nas.local/~/backups", "sftp", OptionURL},
+		{"mem://shared", "mem", OptionURL},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseURL(tt.rawURL)
+		if err != nil {
+			t.Errorf("ParseURL(%q): %v", tt.rawURL, err)
+			continue
+		}
+		if cfg.Type != tt.typ || len(cfg.Options) != 1 || cfg.Options[tt.option] != tt.rawURL {
+			t.Errorf("ParseURL(%q) = %+v, want type %s with option %s", tt.rawURL, cfg, tt.typ, tt.option)
+		}
+	}
+
+	if _, err := ParseURL("s3://bucket/%zz"); err == nil {
+		t.Error("invalid url was accepted")
+	}
+}
+
+func TestOpenEachScheme(t *testing.T) {
+	// 本地目录和 file:// 地址
+	dir := t.TempDir()
+	checkRoundTrip(t, openForTest(t, dir))
+	fileURL := &url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(dir, "via-url"))}
+	checkRoundTrip(t, openForTest(t, fileURL.String()))
+	if _, err := os.Stat(filepath.Join(dir, "via-url", "dir", "a.enc")); err != nil {
+		t.Errorf("file url: %v", err)
+	}
+
+	// S3：凭证来自环境变量，服务地址来自查询参数
+	fake, _ := newFakeS3(t)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", testS3AccessKey)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", testS3SecretKey)
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	checkRoundTrip(t, openForTest(t, "s3://"+testS3Bucket+"/daily?endpoint="+url.QueryEscape(server.URL)))
+	if _, ok := fake.objects["daily/dir/a.enc"]; !ok {
+		t.Errorf("s3 objects = %v, want daily/dir/a.enc", fake.objects)
+	}
+
+	// WebDAV：webdav+http 没有单独注册，使用 webdav 的工厂函数
+	fs := webdav.NewMemFS()
+	davServer := httptest.NewServer(&webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()})
+	defer davServer.Close()
+	checkRoundTrip(t, openForTest(t, "webdav+http://"+strings.TrimPrefix(davServer.URL, "http://")+"/backups"))
+	if _, err := fs.Stat(context.Background(), "/backups/dir/a.enc"); err != nil {
+		t.Errorf("webdav: %v", err)
+	}
+
+	// SFTP
+	_, sftpConfig := newTestSFTP(t)
+	query := url.Values{"key": sftpConfig.KeyFiles, "known_hosts": {sftpConfig.KnownHostsFile}}
+	checkRoundTrip(t, openForTest(t, "sftp://backup@"+sftpConfig.Host+sftpConfig.Path+"?"+query.Encode()))
+	if _, err := os.Stat(filepath.Join(sftpConfig.Path, "dir", "a.enc")); err != nil {
+		t.Errorf("sftp: %v", err)
+	}
+
+	// mem:// 每次创建新的存储，mem://name 共享同名的存储
+	checkRoundTrip(t, openForTest(t, "mem://"))
+	if exists, _ := openForTest(t, "mem://").Exists(context.Background(), "/dir/a.enc"); exists {
+		t.Error("mem:// shares data between instances")
+	}
+	checkRoundTrip(t, openForTest(t, "mem://registry-test"))
+	if exists, _ := openForTest(t, "mem://registry-test").Exists(context.Background(), "/dir/a.enc"); !exists {
+		t.Error("mem://registry-test does not share data")
+	}
+}
+
+func TestOpenRejectsInvalid(t *testing.T) {
+	for _, rawURL := range []string{
+		"ftp://host/backups",
+		"unknown+variant://host",
+		"s3:///no-bucket",
+		"webdav://",
+		"sftp://nas.local/backups",
+	} {
+		if s, err := Open(rawURL); err == nil {
+			t.Errorf("Open(%q) = %T, want an error", rawURL, s)
+		}
+	}
+	if _, err := Open("ftp://host/backups"); err == nil || !strings.Contains(err.Error(), "unsupported storage type: ftp") {
+		t.Errorf("unknown scheme: got %v", err)
+	}
+	if _, err := New(nil); err == nil {
+		t.Error("New(nil) succeeded")
+	}
+	if _, err := New(&Config{Type: "mem", Options: map[string]interface{}{OptionURL: 42}}); err == nil {
+		t.Error("non-string url option was accepted")
+	}
+}
+
+func TestRegisterStorageType(t *testing.T) {
+	var configs []*Config
+	registerForTest(t, "test-custom", func(cfg *Config) (Storage, error) {
+		configs = append(configs, cfg)
+		return NewMemStorage(), nil
+	})
+	if !slices.Contains(Types(), "test-custom") {
+		t.Errorf("Types() = %v, missing test-custom", Types())
+	}
+
+	// 完全匹配和 family+variant 形式的地址都使用注册的工厂函数
+	for _, rawURL := range []string{"test-custom://host/path", "test-custom+tls://host/path"} {
+		if _, err := Open(rawURL); err != nil {
+			t.Fatalf("Open(%s): %v", rawURL, err)
+		}
+	}
+	if len(configs) != 2 || configs[0].Options[OptionURL] != "test-custom://host/path" || configs[1].Type != "test-custom+tls" {
+		t.Errorf("factory saw %+v", configs)
+	}
+
+	factory := func(cfg *Config) (Storage, error) { return NewMemStorage(), nil }
+	for _, tt := range []struct {
+		name    string
+		typ     string
+		factory Factory
+	}{
+		{"registered twice", "test-custom", factory},
+		{"built-in type", "s3", factory},
+		{"empty name", "", factory},
+		{"nil factory", "test-nil", nil},
+	} {
+		if !registerPanics(tt.typ, tt.factory) {
+			t.Errorf("%s: Register did not panic", tt.name)
+		}
+	}
+	if slices.Contains(Types(), "test-nil") || slices.Contains(Types(), "") {
+		t.Errorf("invalid registration was kept: %v", Types())
+	}
+}
@@ -0,0 +1,672 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultS3PartSize 分片上传的默认分片大小，小于这个大小的文件使用单个 PUT 请求上传
+	DefaultS3PartSize = 16 * 1024 * 1024
+
+	// MinS3PartSize S3 允许的最小分片大小（最后一个分片除外）
+	MinS3PartSize = 5 * 1024 * 1024
+
+	// maxS3MetadataSize S3 用户元数据（x-amz-meta-* 的名称和值）的总大小上限
+	maxS3MetadataSize = 2048
+
+	// s3MetaPrefix 用户元数据的头部前缀
+	s3MetaPrefix = "x-amz-meta-"
+)
+
+// S3Config S3 兼容存储的配置
+type S3Config struct {
+	Endpoint        string       // 服务地址，如 http://localhost:9000；为空时使用 AWS 的区域地址
+	Region          string       // 区域，默认 us-east-1
+	Bucket          string       // 存储桶名称
+	Prefix          string       // 对象键前缀，所有文件都保存在这个前缀下
+	AccessKeyID     string       // 访问密钥ID
+	SecretAccessKey string       // 访问密钥
+	SessionToken    string       // 临时凭证的会话令牌（可选）
+	PathStyle       bool         // 使用路径形式的地址（endpoint/bucket/key），MinIO 等自建服务通常需要
+	PartSize        int64        // 分片上传的分片大小，默认 DefaultS3PartSize
+	Client          *http.Client // HTTP 客户端，默认 http.DefaultClient
+}
+
+// S3Storage S3 兼容的对象存储实现，支持 AWS S3、MinIO 等
+//
+// 元数据保存为对象的 x-amz-meta-* 头部，值经过 URL 编码以支持任意字符。
+// S3 限制用户元数据总共不超过 2KB，加密元数据或使用加密文件名时请注意这个限制。
+// 对象存储没有真正的目录，以 / 分隔的键前缀视为目录
+type S3Storage struct {
+	config   S3Config
+	endpoint *url.URL
+	signer   *sigV4Signer
+	client   *http.Client
+}
+
+// NewS3Storage 创建 S3 存储
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("bucket cannot be empty")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("access key id and secret access key are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.PartSize == 0 {
+		config.PartSize = DefaultS3PartSize
+	}
+	if config.PartSize < MinS3PartSize {
+		return nil, fmt.Errorf("part size must be at least %d bytes", MinS3PartSize)
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint: %s", config.Endpoint)
+	}
+
+	return &S3Storage{
+		config:   config,
+		endpoint: endpoint,
+		client:   config.Client,
+		signer: &sigV4Signer{
+			accessKeyID:     config.AccessKeyID,
+			secretAccessKey: config.SecretAccessKey,
+			sessionToken:    config.SessionToken,
+			region:          config.Region,
+			service:         "s3",
+		},
+	}, nil
+}
+
+// ParseS3URL 解析 s3://bucket/prefix 形式的存储地址
+//
+// 查询参数 endpoint、region、path_style 和 part_size 覆盖对应的配置，
+// 凭证和未指定的配置从 AWS 的标准环境变量读取：AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY、
+// AWS_SESSION_TOKEN、AWS_REGION（或 AWS_DEFAULT_REGION）、AWS_ENDPOINT_URL_S3（或 AWS_ENDPOINT_URL）。
+// 指定了 endpoint 时默认使用路径形式的地址
+func ParseS3URL(rawURL string) (S3Config, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return S3Config{}, fmt.Errorf("invalid s3 url: %w", err)
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return S3Config{}, fmt.Errorf("invalid s3 url: expected s3://bucket/prefix")
+	}
+
+	config := s3ConfigFromEnv()
+	config.Bucket = u.Host
+	config.Prefix = strings.Trim(u.Path, "/")
+
+	query := u.Query()
+	if v := query.Get("endpoint"); v != "" {
+		config.Endpoint = v
+	}
+	if v := query.Get("region"); v != "" {
+		config.Region = v
+	}
+	config.PathStyle = config.Endpoint != ""
+	if v := query.Get("path_style"); v != "" {
+		if config.PathStyle, err = strconv.ParseBool(v); err != nil {
+			return S3Config{}, fmt.Errorf("invalid path_style: %s", v)
+		}
+	}
+	if v := query.Get("part_size"); v != "" {
+		if config.PartSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return S3Config{}, fmt.Errorf("invalid part_size: %s", v)
+		}
+	}
+
+	return config, nil
+}
+
+// s3ConfigFromEnv 从 AWS 的标准环境变量读取凭证、区域和服务地址
+func s3ConfigFromEnv() S3Config {
+	return S3Config{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Region:          firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		Endpoint:        firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+	}
+}
+
+// firstEnv 返回第一个不为空的环境变量
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Upload 上传文件到 S3
+// 不超过一个分片大小的文件使用单个 PUT 请求，更大的文件使用分片上传，内存中最多保留一个分片
+func (s *S3Storage) Upload(ctx context.Context, remotePath string, data io.Reader, metadata map[string]string) error {
+	key, err := s.objectKey(remotePath)
+	if err != nil {
+		return err
+	}
+	if key == s.config.Prefix {
+		return &PathError{Path: remotePath, Err: ErrInvalidPath}
+	}
+
+	header, err := metadataHeader(metadata)
+	if err != nil {
+		return err
+	}
+	header.Set("Content-Type", "application/octet-stream")
+
+	// 缓冲区按需增长，小文件（如 .meta 大小的数据）不会分配整个分片
+	buf, err := readPart(data, nil, int(s.config.PartSize))
+	if err != nil {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+	if len(buf) == int(s.config.PartSize) {
+		// 正好读满一个分片时，再读一个字节判断后面是否还有数据
+		var next [1]byte
+		n, err := io.ReadFull(data, next[:])
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read data: %w", err)
+		}
+		if n > 0 {
+			return s.multipartUpload(ctx, key, header, buf, io.MultiReader(bytes.NewReader(next[:n]), data))
+		}
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, nil, header, buf)
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// readPart 从r读取最多limit字节，追加到buf[:0]中返回
+// 缓冲区容量不足时按倍数增长，但不超过limit；读到末尾时返回的数据少于limit，错误为nil
+func readPart(r io.Reader, buf []byte, limit int) ([]byte, error) {
+	buf = buf[:0]
+	for len(buf) < limit {
+		if len(buf) == cap(buf) {
+			grown := make([]byte, len(buf), min(max(2*cap(buf), 64*1024), limit))
+			copy(grown, buf)
+			buf = grown
+		}
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// s3CompletedPart 已上传的分片
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// multipartUpload 分片上传，first 为已经读取的第一个分片，出错时中止上传以释放已上传的分片
+func (s *S3Storage) multipartUpload(ctx context.Context, key string, header http.Header, first []byte, rest io.Reader) error {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = decodeXML(resp, &initiated)
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	uploadID := initiated.UploadID
+
+	parts, err := s.uploadParts(ctx, key, uploadID, first, rest)
+	if err == nil {
+		err = s.completeMultipartUpload(ctx, key, uploadID, parts)
+	}
+	if err != nil {
+		// 上下文已取消时仍然需要中止上传
+		abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if resp, abortErr := s.do(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// uploadParts 依次上传各个分片，buf 在分片之间重复使用
+func (s *S3Storage) uploadParts(ctx context.Context, key, uploadID string, buf []byte, rest io.Reader) ([]s3CompletedPart, error) {
+	var parts []s3CompletedPart
+	part := buf
+	for {
+		number := len(parts) + 1
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, http.MethodPut, key, query, nil, part)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload part %d: %w", number, err)
+		}
+		resp.Body.Close()
+		parts = append(parts, s3CompletedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		part, err = readPart(rest, buf, len(buf))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data: %w", err)
+		}
+		if len(part) == 0 {
+			return parts, nil
+		}
+	}
+}
+
+// completeMultipartUpload 合并已上传的分片
+func (s *S3Storage) completeMultipartUpload(ctx context.Context, key, uploadID string, parts []s3CompletedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{"Content-Type": {"application/xml"}}
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, header, body)
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	// 合并失败时 S3 也可能返回 200，错误在响应体中
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := decodeXML(resp, &result); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("failed to complete multipart upload: %w", &S3Error{StatusCode: resp.StatusCode, Code: result.Code, Message: result.Message})
+	}
+	return nil
+}
+
+// Download 从 S3 下载文件
+func (s *S3Storage) Download(ctx context.Context, remotePath string, dst io.Writer) error {
+	key, err := s.objectKey(remotePath)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		if isS3NotFound(err) {
+			return fmt.Errorf("file not found: %s", remotePath)
+		}
+		return fmt.Errorf("failed to download object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除 S3 对象
+// S3 删除不存在的对象不会报错，这里先检查对象是否存在，与本地存储的行为保持一致
+func (s *S3Storage) Delete(ctx context.Context, remotePath string) error {
+	key, err := s.objectKey(remotePath)
+	if err != nil {
+		return err
+	}
+	exists, err := s.Exists(ctx, remotePath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("failed to delete file: file not found: %s", remotePath)
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List 列出目录下的文件和子目录
+// 每个文件需要一次 HEAD 请求获取元数据
+func (s *S3Storage) List(ctx context.Context, remotePath string) ([]FileInfo, error) {
+	prefix, err := s.objectKey(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var files []FileInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		var result struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			CommonPrefixes []struct {
+				Prefix string `xml:"Prefix"`
+			} `xml:"CommonPrefixes"`
+		}
+		if err := decodeXML(resp, &result); err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, p := range result.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/")
+			if name == "" {
+				continue
+			}
+			files = append(files, FileInfo{
+				Path:  path.Join(remotePath, name),
+				IsDir: true,
+			})
+		}
+		for _, obj := range result.Contents {
+			name := strings.TrimPrefix(obj.Key, prefix)
+			// 跳过部分工具创建的目录占位对象
+			if name == "" || strings.HasSuffix(name, "/") {
+				continue
+			}
+			filePath := path.Join(remotePath, name)
+			metadata, err := s.GetMetadata(ctx, filePath)
+			if err != nil {
+				metadata = make(map[string]string)
+			}
+			files = append(files, FileInfo{
+				Path:     filePath,
+				Size:     obj.Size,
+				ModTime:  obj.LastModified.Unix(),
+				Metadata: metadata,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return files, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Exists 检查对象是否存在
+func (s *S3Storage) Exists(ctx context.Context, remotePath string) (bool, error) {
+	key, err := s.objectKey(remotePath)
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		if isS3NotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// GetMetadata 获取对象的元数据
+func (s *S3Storage) GetMetadata(ctx context.Context, remotePath string) (map[string]string, error) {
+	key, err := s.objectKey(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, fmt.Errorf("file not found: %s", remotePath)
+		}
+		return nil, err
+	}
+	resp.Body.Close()
+
+	metadata := make(map[string]string)
+	for name, values := range resp.Header {
+		name = strings.ToLower(name)
+		if !strings.HasPrefix(name, s3MetaPrefix) || len(values) == 0 {
+			continue
+		}
+		value, err := url.QueryUnescape(values[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata %s: %w", name, err)
+		}
+		key, err := parseMetadataName(strings.TrimPrefix(name, s3MetaPrefix))
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = value
+	}
+	return metadata, nil
+}
+
+// objectKey 检查存储路径并转换为对象键
+func (s *S3Storage) objectKey(remotePath string) (string, error) {
+	key, err := CleanPath(remotePath)
+	if err != nil {
+		return "", err
+	}
+	if s.config.Prefix == "" {
+		return key, nil
+	}
+	if key == "" {
+		return s.config.Prefix, nil
+	}
+	return s.config.Prefix + "/" + key, nil
+}
+
+// objectURL 返回对象的地址，key 为空时返回存储桶的地址
+func (s *S3Storage) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	escaped := strings.TrimSuffix(u.EscapedPath(), "/")
+	if s.config.PathStyle {
+		escaped += "/" + uriEncode(s.config.Bucket, true)
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+	}
+	escaped += "/" + uriEncode(key, false)
+
+	u.RawPath = escaped
+	u.Path, _ = url.PathUnescape(escaped)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do 发送签名后的请求，响应状态码不是 2xx 时返回 *S3Error
+func (s *S3Storage) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = s.objectURL(key, query)
+	req.Host = req.URL.Host
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.ContentLength = int64(len(body))
+		payloadHash = sha256Hex(body)
+	} else if method == http.MethodPut || method == http.MethodPost {
+		// 空请求体使用 http.NoBody，确保发送 Content-Length: 0 而不是分块编码
+		req.Body = http.NoBody
+	}
+	s.signer.sign(req, payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, parseS3Error(resp)
+	}
+	return resp, nil
+}
+
+// S3Error S3 服务返回的错误
+type S3Error struct {
+	StatusCode int    // HTTP 状态码
+	Code       string // 错误代码，如 NoSuchKey、AccessDenied
+	Message    string // 错误信息
+}
+
+// Error 实现 error 接口
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: HTTP %d", e.StatusCode)
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("s3: %s (HTTP %d)", e.Code, e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s (HTTP %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// parseS3Error 从响应中解析错误，HEAD 请求的错误没有响应体，只有状态码
+func parseS3Error(resp *http.Response) error {
+	s3Err := &S3Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(data, &body) == nil {
+		s3Err.Code = body.Code
+		s3Err.Message = body.Message
+	}
+	return s3Err
+}
+
+// isS3NotFound 检查错误是否表示对象不存在，存储桶不存在（NoSuchBucket）不算
+func isS3NotFound(err error) bool {
+	var s3Err *S3Error
+	return errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound &&
+		(s3Err.Code == "" || s3Err.Code == "NoSuchKey")
+}
+
+// decodeXML 解析 XML 响应体并关闭它
+func decodeXML(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// metadataHeader 将元数据转换为 x-amz-meta-* 头部
+// 名称统一为小写（S3 不区分大小写），值使用 URL 编码，保证非 ASCII 字符和空白原样保存。
+// 名称中的 _ 和 - 编码为 -5f 和 -2d（见 metadataName），Nginx 等代理默认会丢弃带下划线的头部
+func metadataHeader(metadata map[string]string) (http.Header, error) {
+	header := make(http.Header)
+	size := 0
+	for k, v := range metadata {
+		name := strings.ToLower(k)
+		if name == "" || strings.IndexFunc(name, func(r rune) bool {
+			return !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '_' || r == '-' || r == '.')
+		}) >= 0 {
+			return nil, fmt.Errorf("invalid metadata key for s3: %q", k)
+		}
+		name = metadataName(name)
+		value := url.QueryEscape(v)
+		size += len(name) + len(value)
+		header[s3MetaPrefix+name] = []string{value}
+	}
+	if size > maxS3MetadataSize {
+		return nil, fmt.Errorf("metadata too large for s3: %d bytes, limit is %d", size, maxS3MetadataSize)
+	}
+	return header, nil
+}
+
+// metadataName 将元数据名称中的 _ 和 - 编码为 -5f 和 -2d
+// 编码后的名称只包含字母、数字、. 和作为转义符的 -，经过代理时不会被丢弃
+func metadataName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; c {
+		case '_':
+			b.WriteString("-5f")
+		case '-':
+			b.WriteString("-2d")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parseMetadataName 还原 metadataName 编码的名称
+// 名称中出现 _ 或无效的转义时返回错误
+func parseMetadataName(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c == '_':
+			return "", fmt.Errorf("invalid metadata name: %s", name)
+		case c != '-':
+			b.WriteByte(c)
+		case strings.HasPrefix(name[i+1:], "5f"):
+			b.WriteByte('_')
+			i += 2
+		case strings.HasPrefix(name[i+1:], "2d"):
+			b.WriteByte('-')
+			i += 2
+		default:
+			return "", fmt.Errorf("invalid metadata name: %s", name)
+		}
+	}
+	return b.String(), nil
+}
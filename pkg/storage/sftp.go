@@ -0,0 +1,622 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultSSHKeyFiles 未指定私钥时依次尝试的 ~/.ssh 下的私钥文件
+var defaultSSHKeyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// maxSymlinks 检查路径时最多跟随的符号链接数，与 Linux 的 ELOOP 上限相同
+const maxSymlinks = 40
+
+// SFTPConfig SFTP 存储的配置
+type SFTPConfig struct {
+	Host           string        // 服务器地址，可以带端口，默认端口 22
+	User           string        // 用户名
+	Path           string        // 备份根目录，相对路径相对于用户的主目录
+	KeyFiles       []string      // 私钥文件，为空时使用 ~/.ssh 下的 id_ed25519、id_ecdsa 和 id_rsa
+	KeyPassphrase  string        // 私钥的口令（可选）
+	KnownHostsFile string        // known_hosts 文件，默认 ~/.ssh/known_hosts
+	Timeout        time.Duration // 连接超时，默认 30 秒
+}
+
+// SFTPStorage SFTP 存储实现，文件保存在 SSH 服务器上
+//
+// 只支持公钥认证（私钥文件或 ssh-agent），服务器的主机密钥必须已经记录在 known_hosts 中。
+// 与本地存储相同，元数据保存在文件旁边的 .meta 文件中，数据先写入临时文件再重命名。
+// 路径经过 CleanPath 检查，拒绝 .meta 文件和临时文件的名称，并且不会跟随指向备份根目录之外的符号链接。
+// 连接断开后，下一次操作会自动重新连接
+type SFTPStorage struct {
+	config       SFTPConfig
+	clientConfig *ssh.ClientConfig
+	root         string // 备份根目录在服务器上的绝对路径
+
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+// NewSFTPStorage 连接 SFTP 服务器并创建存储，备份根目录不存在时会被创建
+func NewSFTPStorage(config SFTPConfig) (*SFTPStorage, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("host cannot be empty")
+	}
+	if config.User == "" {
+		return nil, fmt.Errorf("user cannot be empty")
+	}
+	if _, _, err := net.SplitHostPort(config.Host); err != nil {
+		config.Host = net.JoinHostPort(config.Host, "22")
+	}
+	if config.Path == "" {
+		config.Path = "."
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	home, _ := os.UserHomeDir()
+	if config.KnownHostsFile == "" {
+		config.KnownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(config.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts: %w", err)
+	}
+
+	auth, err := sshAuthMethods(config, home)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SFTPStorage{
+		config: config,
+		clientConfig: &ssh.ClientConfig{
+			User:              config.User,
+			Auth:              auth,
+			HostKeyCallback:   hostKeyCallback,
+			HostKeyAlgorithms: knownHostKeyAlgorithms(hostKeyCallback, config.Host),
+			Timeout:           config.Timeout,
+		},
+	}
+
+	client, err := s.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := client.MkdirAll(config.Path); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to create base directory: %w", err)
+	}
+	if s.root, err = client.RealPath(config.Path); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to resolve base directory: %w", err)
+	}
+	return s, nil
+}
+
+// ParseSFTPURL 解析 sftp://user@host:port/path 形式的存储地址
+//
+// 路径是服务器上的绝对路径，/~/ 开头的路径相对于用户的主目录。
+// 查询参数 key（可以重复）指定私钥文件，known_hosts 指定 known_hosts 文件；
+// 私钥的口令从环境变量 CRYPTOBACKUP_SFTP_KEY_PASSPHRASE 读取
+func ParseSFTPURL(rawURL string) (SFTPConfig, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return SFTPConfig{}, fmt.Errorf("invalid sftp url: %w", err)
+	}
+	if u.Scheme != "sftp" || u.Host == "" {
+		return SFTPConfig{}, fmt.Errorf("invalid sftp url: expected sftp://user@host/path")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return SFTPConfig{}, fmt.Errorf("invalid sftp url: missing user")
+	}
+	if _, ok := u.User.Password(); ok {
+		return SFTPConfig{}, fmt.Errorf("invalid sftp url: password authentication is not supported, use a key")
+	}
+
+	config := SFTPConfig{
+		Host:           u.Host,
+		User:           u.User.Username(),
+		Path:           u.Path,
+		KeyFiles:       u.Query()["key"],
+		KnownHostsFile: u.Query().Get("known_hosts"),
+		KeyPassphrase:  os.Getenv("CRYPTOBACKUP_SFTP_KEY_PASSPHRASE"),
+	}
+	switch {
+	case config.Path == "" || config.Path == "/~":
+		config.Path = "."
+	case strings.HasPrefix(config.Path, "/~/"):
+		config.Path = strings.TrimPrefix(config.Path, "/~/")
+	}
+	return config, nil
+}
+
+// sshAuthMethods 收集公钥认证方式：ssh-agent 中的密钥和私钥文件
+func sshAuthMethods(config SFTPConfig, home string) ([]ssh.AuthMethod, error) {
+	var signers []ssh.Signer
+
+	keyFiles := config.KeyFiles
+	explicit := len(keyFiles) > 0
+	if !explicit {
+		for _, name := range defaultSSHKeyFiles {
+			keyFiles = append(keyFiles, filepath.Join(home, ".ssh", name))
+		}
+	}
+	for _, keyFile := range keyFiles {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			if !explicit && os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			if config.KeyPassphrase == "" {
+				if explicit {
+					return nil, fmt.Errorf("private key %s is encrypted, set CRYPTOBACKUP_SFTP_KEY_PASSPHRASE", keyFile)
+				}
+				continue
+			}
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(config.KeyPassphrase))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %w", keyFile, err)
+		}
+		signers = append(signers, signer)
+	}
+
+	var methods []ssh.AuthMethod
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no ssh key available: specify a private key or start ssh-agent")
+	}
+	return methods, nil
+}
+
+// knownHostKeyAlgorithms 返回 known_hosts 中记录的该主机的密钥算法
+// 协商时只使用这些算法，否则服务器可能提供 known_hosts 中没有记录的另一种密钥而导致验证失败
+func knownHostKeyAlgorithms(callback ssh.HostKeyCallback, host string) []string {
+	addr, err := net.ResolveTCPAddr("tcp", host)
+	if err != nil {
+		addr = &net.TCPAddr{}
+	}
+	// 使用一个不可能匹配的密钥查询，错误中包含已记录的密钥
+	err = callback(host, addr, sftpProbeKey{})
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, known := range keyErr.Want {
+		for _, algorithm := range hostKeyAlgorithmsFor(known.Key.Type()) {
+			if !seen[algorithm] {
+				seen[algorithm] = true
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+	}
+	return algorithms
+}
+
+// hostKeyAlgorithmsFor 返回密钥类型对应的签名算法，RSA 密钥可以使用 SHA-2 签名
+func hostKeyAlgorithmsFor(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// sftpProbeKey 查询 known_hosts 使用的占位密钥
+type sftpProbeKey struct{}
+
+func (sftpProbeKey) Type() string                        { return "cryptobackup-probe" }
+func (sftpProbeKey) Marshal() []byte                     { return []byte("cryptobackup-probe") }
+func (sftpProbeKey) Verify([]byte, *ssh.Signature) error { return errors.New("probe key") }
+
+// sftpClient 返回当前的 SFTP 连接，没有连接时建立连接
+func (s *SFTPStorage) sftpClient() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	conn, err := ssh.Dial("tcp", s.config.Host, s.clientConfig)
+	if err != nil {
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return nil, fmt.Errorf("failed to connect to %s: host key is not in %s, add it with ssh-keyscan or connect with ssh once: %w",
+				s.config.Host, s.config.KnownHostsFile, err)
+		}
+		return nil, fmt.Errorf("failed to connect to %s: %w", s.config.Host, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start sftp session: %w", err)
+	}
+	s.conn = conn
+	s.client = client
+	return client, nil
+}
+
+// do 在 SFTP 连接上执行操作，连接已断开时丢弃连接，下一次操作重新连接
+func (s *SFTPStorage) do(ctx context.Context, op func(client *sftp.Client) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	client, err := s.sftpClient()
+	if err != nil {
+		return err
+	}
+	err = op(client)
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) {
+		s.mu.Lock()
+		if s.client == client {
+			s.closeLocked()
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// Close 关闭 SFTP 连接
+func (s *SFTPStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeLocked()
+}
+
+// closeLocked 关闭连接，调用方必须持有锁
+func (s *SFTPStorage) closeLocked() error {
+	if s.client == nil {
+		return nil
+	}
+	s.client.Close()
+	err := s.conn.Close()
+	s.client = nil
+	s.conn = nil
+	return err
+}
+
+// fullPath 返回 CleanPath 规范化后的路径在服务器上的路径
+func (s *SFTPStorage) fullPath(name string) string {
+	return path.Join(s.root, name)
+}
+
+// checkSymlinks 检查路径经过的符号链接是否都指向备份根目录之内
+// 逐段 Lstat 并自己解析符号链接，不依赖服务器的 realpath（部分服务器不解析符号链接）；
+// 遇到不存在的部分时停止，之后的目录由存储自己创建，不会是符号链接
+func (s *SFTPStorage) checkSymlinks(client *sftp.Client, remotePath, name string) error {
+	resolved := s.root // 已经解析的部分，始终位于根目录之内
+	parts := strings.Split(name, "/")
+	for links := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == s.root {
+				return &PathError{Path: remotePath, Err: ErrSymlinkEscape}
+			}
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		info, err := client.Lstat(next)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return fmt.Errorf("too many levels of symbolic links: %s", remotePath)
+		}
+		target, err := client.ReadLink(next)
+		if err != nil {
+			return err
+		}
+		// 绝对路径的目标必须以根目录开头，剩余部分从根目录开始继续解析
+		if path.IsAbs(target) {
+			if s.root != "/" && target != s.root && !strings.HasPrefix(target, s.root+"/") {
+				return &PathError{Path: remotePath, Err: ErrSymlinkEscape}
+			}
+			target = strings.TrimPrefix(target, s.root)
+			resolved = s.root
+		}
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return nil
+}
+
+// Upload 上传文件到 SFTP 服务器
+// 数据先写入同目录下的临时文件再重命名，覆盖已有文件时不会留下写了一半的内容
+func (s *SFTPStorage) Upload(ctx context.Context, remotePath string, data io.Reader, metadata map[string]string) error {
+	name, err := cleanSidecarFilePath(remotePath)
+	if err != nil {
+		return err
+	}
+	fullPath := s.fullPath(name)
+
+	return s.do(ctx, func(client *sftp.Client) error {
+		if err := s.checkSymlinks(client, remotePath, name); err != nil {
+			return err
+		}
+		if err := client.MkdirAll(path.Dir(fullPath)); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		if err := writeRemoteFileAtomic(client, fullPath, func(w io.Writer) error {
+			_, err := io.Copy(w, data)
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to write data: %w", err)
+		}
+
+		if len(metadata) > 0 {
+			encoded, err := json.Marshal(metadata)
+			if err != nil {
+				return fmt.Errorf("failed to save metadata: %w", err)
+			}
+			if err := writeRemoteFileAtomic(client, fullPath+".meta", func(w io.Writer) error {
+				_, err := w.Write(encoded)
+				return err
+			}); err != nil {
+				return fmt.Errorf("failed to save metadata: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// writeRemoteFileAtomic 将write的输出写入服务器上的临时文件，成功后重命名为p
+// 服务器支持 posix-rename 扩展时原子替换，否则先删除旧文件再重命名
+func writeRemoteFileAtomic(client *sftp.Client, p string, write func(w io.Writer) error) error {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	tmpPath := path.Join(path.Dir(p), tempFilePrefix+hex.EncodeToString(suffix)+tempFileSuffix)
+
+	tmp, err := client.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	defer client.Remove(tmpPath)
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := client.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(tmpPath, p)
+	}
+	if err := client.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return client.Rename(tmpPath, p)
+}
+
+// Download 从 SFTP 服务器下载文件
+func (s *SFTPStorage) Download(ctx context.Context, remotePath string, dst io.Writer) error {
+	name, err := cleanSidecarPath(remotePath)
+	if err != nil {
+		return err
+	}
+
+	return s.do(ctx, func(client *sftp.Client) error {
+		if err := s.checkSymlinks(client, remotePath, name); err != nil {
+			return err
+		}
+		file, err := client.Open(s.fullPath(name))
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
+		}
+		defer file.Close()
+
+		if _, err := io.Copy(dst, file); err != nil {
+			return fmt.Errorf("failed to read data: %w", err)
+		}
+		return nil
+	})
+}
+
+// Delete 删除服务器上的文件和元数据文件
+func (s *SFTPStorage) Delete(ctx context.Context, remotePath string) error {
+	name, err := cleanSidecarFilePath(remotePath)
+	if err != nil {
+		return err
+	}
+	fullPath := s.fullPath(name)
+
+	return s.do(ctx, func(client *sftp.Client) error {
+		if err := s.checkSymlinks(client, remotePath, name); err != nil {
+			return err
+		}
+		if err := client.Remove(fullPath); err != nil {
+			return fmt.Errorf("failed to delete file: %w", err)
+		}
+		client.Remove(fullPath + ".meta") // 忽略错误
+		return nil
+	})
+}
+
+// List 列出目录下的文件
+func (s *SFTPStorage) List(ctx context.Context, remotePath string) ([]FileInfo, error) {
+	name, err := cleanSidecarPath(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	fullPath := s.fullPath(name)
+
+	var files []FileInfo
+	err = s.do(ctx, func(client *sftp.Client) error {
+		if err := s.checkSymlinks(client, remotePath, name); err != nil {
+			return err
+		}
+		entries, err := client.ReadDir(fullPath)
+		if err != nil {
+			return fmt.Errorf("failed to read directory: %w", err)
+		}
+
+		// 记录普通文件形式的 .meta 文件，符号链接可能指向根目录之外，不读取
+		names := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			names[entry.Name()] = entry.Mode()&os.ModeSymlink == 0
+		}
+
+		for _, entry := range entries {
+			// 跳过元数据文件和写入中的临时文件
+			if path.Ext(entry.Name()) == ".meta" || isTempFile(entry.Name()) {
+				continue
+			}
+
+			fileInfo := FileInfo{
+				Path:     path.Join(remotePath, entry.Name()),
+				Size:     entry.Size(),
+				IsDir:    entry.IsDir(),
+				ModTime:  entry.ModTime().Unix(),
+				Metadata: make(map[string]string),
+			}
+
+			// 只有存在 .meta 文件时才读取，减少往返
+			if names[entry.Name()+".meta"] {
+				if metadata, err := loadRemoteMetadata(client, path.Join(fullPath, entry.Name())); err == nil {
+					fileInfo.Metadata = metadata
+				}
+			}
+
+			files = append(files, fileInfo)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Exists 检查文件是否存在
+func (s *SFTPStorage) Exists(ctx context.Context, remotePath string) (bool, error) {
+	name, err := cleanSidecarPath(remotePath)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err = s.do(ctx, func(client *sftp.Client) error {
+		if err := s.checkSymlinks(client, remotePath, name); err != nil {
+			return err
+		}
+		_, err := client.Stat(s.fullPath(name))
+		if err == nil {
+			exists = true
+			return nil
+		}
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	})
+	return exists, err
+}
+
+// GetMetadata 获取文件元数据
+func (s *SFTPStorage) GetMetadata(ctx context.Context, remotePath string) (map[string]string, error) {
+	name, err := cleanSidecarPath(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	fullPath := s.fullPath(name)
+
+	var metadata map[string]string
+	err = s.do(ctx, func(client *sftp.Client) error {
+		// 元数据文件本身也可能是指向根目录之外的符号链接
+		for _, p := range []string{name, name + ".meta"} {
+			if err := s.checkSymlinks(client, remotePath, p); err != nil {
+				return err
+			}
+		}
+		if _, err := client.Stat(fullPath); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("file not found: %s", remotePath)
+			}
+			return err
+		}
+
+		var err error
+		metadata, err = loadRemoteMetadata(client, fullPath)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// loadRemoteMetadata 从服务器上的 .meta 文件加载元数据，文件不存在时返回空的元数据
+func loadRemoteMetadata(client *sftp.Client, filePath string) (map[string]string, error) {
+	file, err := client.Open(filePath + ".meta")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string]string), nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var metadata map[string]string
+	if err := json.NewDecoder(file).Decode(&metadata); err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	return metadata, nil
+}
@@ -52,6 +52,6 @@ type FileInfo struct {
 
 // Config 存储配置
 type Config struct {
-	Type    string                 // 存储类型（如 "local", "baidu", "aliyun" 等）
-	Options map[string]interface{} // 配置选项
+	Type    string                 // 存储类型（如 "file"、"s3"、"webdav"、"sftp"、"mem"），见 Register
+	Options map[string]interface{} // 配置选项，见 OptionURL 和各存储类型的工厂函数
 }
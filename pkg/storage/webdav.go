@@ -0,0 +1,645 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// webdavNamespace 保存元数据的属性所在的 XML 命名空间
+	webdavNamespace = "urn:cryptobackup"
+
+	// webdavMetadataProp 保存元数据（JSON）的属性名称
+	webdavMetadataProp = "metadata"
+
+	// webdavSidecarSuffix 服务器不支持自定义属性时，元数据文件的后缀，与本地存储的 .meta 文件格式相同
+	webdavSidecarSuffix = ".meta"
+)
+
+// 元数据的保存方式，未知时由第一次上传检测
+const (
+	webdavMetadataUnknown int32 = iota
+	webdavMetadataDeadProps
+	webdavMetadataSidecar
+)
+
+// WebDAVConfig WebDAV 存储的配置
+type WebDAVConfig struct {
+	URL             string       // 备份根目录的地址，如 https://cloud.example.com/remote.php/dav/files/alice/backups
+	Username        string       // 基本认证的用户名（可选）
+	Password        string       // 基本认证的密码
+	SidecarMetadata bool         // 总是使用 .meta 文件保存元数据，不尝试自定义属性
+	Client          *http.Client // HTTP 客户端，默认 http.DefaultClient
+}
+
+// WebDAVStorage WebDAV 存储实现，支持 Nextcloud、ownCloud 以及 NAS 自带的 WebDAV 服务
+//
+// 元数据以 JSON 形式保存在文件的自定义属性（dead property）中，整体替换，不会残留旧字段；
+// 覆盖上传不带元数据的文件时删除原有的属性和 .meta 文件。
+// 服务器拒绝设置自定义属性时，改为在文件旁边保存与本地存储格式相同的 .meta 文件，
+// 因此与本地存储相同，拒绝 .meta 文件和临时文件的名称
+type WebDAVStorage struct {
+	config       WebDAVConfig
+	base         *url.URL
+	client       *http.Client
+	metadataMode atomic.Int32
+	collections  sync.Map // 已经确认存在的目录
+}
+
+// NewWebDAVStorage 创建 WebDAV 存储
+func NewWebDAVStorage(config WebDAVConfig) (*WebDAVStorage, error) {
+	base, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webdav url: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid webdav url: %s", config.URL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	base.RawPath = ""
+	base.RawQuery = ""
+	base.Fragment = ""
+
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+
+	s := &WebDAVStorage{config: config, base: base, client: config.Client}
+	if config.SidecarMetadata {
+		s.metadataMode.Store(webdavMetadataSidecar)
+	}
+	return s, nil
+}
+
+// ParseWebDAVURL 解析 webdav://user@host/path 形式的存储地址
+//
+// webdav:// 使用 HTTPS，webdav+http:// 使用不加密的 HTTP（仅用于本机或可信的局域网）。
+// 密码可以写在地址中，建议使用环境变量 CRYPTOBACKUP_WEBDAV_PASSWORD。
+// 查询参数 sidecar=true 强制使用 .meta 文件保存元数据
+func ParseWebDAVURL(rawURL string) (WebDAVConfig, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return WebDAVConfig{}, fmt.Errorf("invalid webdav url: %w", err)
+	}
+
+	var config WebDAVConfig
+	switch u.Scheme {
+	case "webdav":
+		u.Scheme = "https"
+	case "webdav+http":
+		u.Scheme = "http"
+	default:
+		return WebDAVConfig{}, fmt.Errorf("invalid webdav url: expected webdav://host/path")
+	}
+	if u.Host == "" {
+		return WebDAVConfig{}, fmt.Errorf("invalid webdav url: missing host")
+	}
+
+	if u.User != nil {
+		config.Username = u.User.Username()
+		config.Password, _ = u.User.Password()
+		u.User = nil
+	}
+	if password := os.Getenv("CRYPTOBACKUP_WEBDAV_PASSWORD"); password != "" {
+		config.Password = password
+	}
+	if v := u.Query().Get("sidecar"); v != "" {
+		if config.SidecarMetadata, err = strconv.ParseBool(v); err != nil {
+			return WebDAVConfig{}, fmt.Errorf("invalid sidecar: %s", v)
+		}
+	}
+	u.RawQuery = ""
+	config.URL = u.String()
+
+	return config, nil
+}
+
+// Upload 上传文件到 WebDAV 服务器，自动创建不存在的上级目录
+func (s *WebDAVStorage) Upload(ctx context.Context, remotePath string, data io.Reader, metadata map[string]string) error {
+	name, err := cleanSidecarFilePath(remotePath)
+	if err != nil {
+		return err
+	}
+
+	if err := s.makeCollections(ctx, path.Dir(name)); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// 能确定长度时发送 Content-Length，部分服务器不接受分块编码的上传
+	size := int64(-1)
+	if seeker, ok := data.(io.Seeker); ok {
+		if cur, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			if end, err := seeker.Seek(0, io.SeekEnd); err == nil {
+				size = end - cur
+			}
+			if _, err := seeker.Seek(cur, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to read data: %w", err)
+			}
+		}
+	}
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	resp, err := s.do(ctx, http.MethodPut, s.resourceURL(name, false), header, io.NopCloser(data), size)
+	if err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+	resp.Body.Close()
+
+	if len(metadata) > 0 {
+		if err := s.saveMetadata(ctx, name, metadata); err != nil {
+			return fmt.Errorf("failed to save metadata: %w", err)
+		}
+	} else if err := s.clearMetadata(ctx, name); err != nil {
+		// 覆盖文件时服务器通常保留原有的属性，不清除会读到旧文件的元数据
+		return fmt.Errorf("failed to clear metadata: %w", err)
+	}
+	return nil
+}
+
+// Download 从 WebDAV 服务器下载文件
+func (s *WebDAVStorage) Download(ctx context.Context, remotePath string, dst io.Writer) error {
+	name, err := cleanSidecarPath(remotePath)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.resourceURL(name, false), nil, nil, 0)
+	if err != nil {
+		if isWebDAVNotFound(err) {
+			return fmt.Errorf("file not found: %s", remotePath)
+		}
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除文件，同时删除可能存在的 .meta 文件
+func (s *WebDAVStorage) Delete(ctx context.Context, remotePath string) error {
+	name, err := cleanSidecarFilePath(remotePath)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, s.resourceURL(name, false), nil, nil, 0)
+	if err != nil {
+		if isWebDAVNotFound(err) {
+			return fmt.Errorf("failed to delete file: file not found: %s", remotePath)
+		}
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	resp.Body.Close()
+
+	if s.metadataMode.Load() != webdavMetadataDeadProps {
+		if resp, err := s.do(ctx, http.MethodDelete, s.resourceURL(name+webdavSidecarSuffix, false), nil, nil, 0); err == nil {
+			resp.Body.Close() // 忽略错误
+		}
+	}
+	return nil
+}
+
+// List 列出目录下的文件和子目录（PROPFIND Depth: 1）
+func (s *WebDAVStorage) List(ctx context.Context, remotePath string) ([]FileInfo, error) {
+	dir, err := cleanSidecarPath(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := s.propfind(ctx, s.resourceURL(dir, true), "1", webdavListProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	// 先找出目录中的 .meta 文件，不支持自定义属性的服务器从中读取元数据
+	sidecars := make(map[string]bool)
+	for _, r := range responses {
+		if name := r.name(); strings.HasSuffix(name, webdavSidecarSuffix) && !r.isCollection() {
+			sidecars[strings.TrimSuffix(name, webdavSidecarSuffix)] = true
+		}
+	}
+
+	self := path.Join(s.base.Path, dir)
+	var files []FileInfo
+	for _, r := range responses {
+		if r.path() == self {
+			continue
+		}
+		name := r.name()
+		if name == "" || !r.isCollection() && strings.HasSuffix(name, webdavSidecarSuffix) {
+			continue
+		}
+
+		info := FileInfo{
+			Path:    path.Join(remotePath, name),
+			Size:    r.contentLength(),
+			IsDir:   r.isCollection(),
+			ModTime: r.lastModified(),
+		}
+		if !info.IsDir {
+			metadata, ok := r.metadata()
+			if !ok && sidecars[name] {
+				metadata, _ = s.loadSidecar(ctx, path.Join(dir, name))
+			}
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			info.Metadata = metadata
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// Exists 检查文件是否存在（PROPFIND Depth: 0）
+func (s *WebDAVStorage) Exists(ctx context.Context, remotePath string) (bool, error) {
+	name, err := cleanSidecarPath(remotePath)
+	if err != nil {
+		return false, err
+	}
+	_, err = s.propfind(ctx, s.resourceURL(name, false), "0", webdavExistsProps)
+	if err != nil {
+		if isWebDAVNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GetMetadata 获取文件元数据，先读取自定义属性，没有时读取 .meta 文件
+func (s *WebDAVStorage) GetMetadata(ctx context.Context, remotePath string) (map[string]string, error) {
+	name, err := cleanSidecarPath(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := s.propfind(ctx, s.resourceURL(name, false), "0", webdavMetadataProps)
+	if err != nil {
+		if isWebDAVNotFound(err) {
+			return nil, fmt.Errorf("file not found: %s", remotePath)
+		}
+		return nil, err
+	}
+	for _, r := range responses {
+		if metadata, ok := r.metadata(); ok {
+			return metadata, nil
+		}
+	}
+	return s.loadSidecar(ctx, name)
+}
+
+// saveMetadata 保存元数据，优先使用自定义属性，服务器拒绝时改用 .meta 文件
+func (s *WebDAVStorage) saveMetadata(ctx context.Context, name string, metadata map[string]string) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	if s.metadataMode.Load() != webdavMetadataSidecar {
+		var value bytes.Buffer
+		if err := xml.EscapeText(&value, data); err != nil {
+			return err
+		}
+		update := `<D:set><D:prop><C:` + webdavMetadataProp + `>` + value.String() +
+			`</C:` + webdavMetadataProp + `></D:prop></D:set>`
+		supported, err := s.proppatch(ctx, s.resourceURL(name, false), update)
+		if err != nil {
+			return err
+		}
+		if supported {
+			s.metadataMode.Store(webdavMetadataDeadProps)
+			return nil
+		}
+		s.metadataMode.Store(webdavMetadataSidecar)
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	resp, err := s.do(ctx, http.MethodPut, s.resourceURL(name+webdavSidecarSuffix, false), header,
+		io.NopCloser(bytes.NewReader(data)), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// clearMetadata 删除文件的元数据属性和 .meta 文件，不存在时忽略
+func (s *WebDAVStorage) clearMetadata(ctx context.Context, name string) error {
+	mode := s.metadataMode.Load()
+	if mode != webdavMetadataSidecar {
+		// 删除不存在的属性不算错误；不支持自定义属性的服务器上也不会有旧的属性
+		update := `<D:remove><D:prop><C:` + webdavMetadataProp + `/></D:prop></D:remove>`
+		if _, err := s.proppatch(ctx, s.resourceURL(name, false), update); err != nil {
+			return err
+		}
+	}
+	if mode != webdavMetadataDeadProps {
+		resp, err := s.do(ctx, http.MethodDelete, s.resourceURL(name+webdavSidecarSuffix, false), nil, nil, 0)
+		if err != nil {
+			if isWebDAVNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// loadSidecar 从 .meta 文件读取元数据，文件不存在时返回空的元数据
+func (s *WebDAVStorage) loadSidecar(ctx context.Context, name string) (map[string]string, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.resourceURL(name+webdavSidecarSuffix, false), nil, nil, 0)
+	if err != nil {
+		if isWebDAVNotFound(err) {
+			return make(map[string]string), nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var metadata map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata file: %w", err)
+	}
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	return metadata, nil
+}
+
+// makeCollections 逐级创建目录（MKCOL），已经存在的目录会被跳过
+// 备份根目录本身不存在时也会创建，但它的上级目录必须已经存在
+func (s *WebDAVStorage) makeCollections(ctx context.Context, dir string) error {
+	if dir == "." {
+		dir = ""
+	}
+	if _, ok := s.collections.Load(dir); ok {
+		return nil
+	}
+	if dir != "" {
+		if err := s.makeCollections(ctx, path.Dir(dir)); err != nil {
+			return err
+		}
+	}
+
+	resp, err := s.do(ctx, "MKCOL", s.resourceURL(dir, true), nil, nil, 0)
+	if err != nil {
+		// 405 表示目录已经存在
+		var davErr *WebDAVError
+		if !errors.As(err, &davErr) || davErr.StatusCode != http.StatusMethodNotAllowed {
+			return err
+		}
+	} else {
+		resp.Body.Close()
+	}
+	s.collections.Store(dir, true)
+	return nil
+}
+
+// 各个 PROPFIND 请求查询的属性
+var (
+	webdavListProps = []string{
+		`<D:resourcetype/>`, `<D:getcontentlength/>`, `<D:getlastmodified/>`, `<C:` + webdavMetadataProp + `/>`,
+	}
+	webdavExistsProps   = []string{`<D:resourcetype/>`}
+	webdavMetadataProps = []string{`<C:` + webdavMetadataProp + `/>`}
+)
+
+// propfind 查询资源的属性
+func (s *WebDAVStorage) propfind(ctx context.Context, target, depth string, props []string) ([]davResponse, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<D:propfind xmlns:D="DAV:" xmlns:C="` + webdavNamespace + `"><D:prop>` +
+		strings.Join(props, "") + `</D:prop></D:propfind>`
+	header := http.Header{
+		"Depth":        {depth},
+		"Content-Type": {"application/xml; charset=utf-8"},
+	}
+	resp, err := s.do(ctx, "PROPFIND", target, header, io.NopCloser(strings.NewReader(body)), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("invalid PROPFIND response: %w", err)
+	}
+	return ms.Responses, nil
+}
+
+// proppatch 修改自定义属性，update 为 <D:set> 或 <D:remove> 元素，服务器拒绝修改属性时返回 false
+func (s *WebDAVStorage) proppatch(ctx context.Context, target, update string) (bool, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<D:propertyupdate xmlns:D="DAV:" xmlns:C="` + webdavNamespace + `">` +
+		update + `</D:propertyupdate>`
+	header := http.Header{"Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := s.do(ctx, "PROPPATCH", target, header, io.NopCloser(strings.NewReader(body)), int64(len(body)))
+	if err != nil {
+		var davErr *WebDAVError
+		if errors.As(err, &davErr) {
+			switch davErr.StatusCode {
+			case http.StatusForbidden, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+				return false, nil
+			}
+		}
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return true, nil
+	}
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return false, fmt.Errorf("invalid PROPPATCH response: %w", err)
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if !statusOK(ps.Status) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// resourceURL 返回存储路径对应的地址，collection 为 true 时以 / 结尾
+func (s *WebDAVStorage) resourceURL(name string, collection bool) string {
+	u := *s.base
+	if name != "" {
+		u.Path += "/" + name
+	}
+	if collection {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+// do 发送请求，响应状态码不是 2xx 时返回 *WebDAVError
+// body 不为 nil 时 size 为请求体长度，未知时为 -1
+func (s *WebDAVStorage) do(ctx context.Context, method, target string, header http.Header, body io.ReadCloser, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Body = body
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.config.Username != "" {
+		req.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &WebDAVError{Method: method, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp, nil
+}
+
+// WebDAVError WebDAV 服务器返回的错误状态
+type WebDAVError struct {
+	Method     string // 请求方法
+	StatusCode int    // HTTP 状态码
+	Status     string // HTTP 状态，如 "404 Not Found"
+}
+
+// Error 实现 error 接口
+func (e *WebDAVError) Error() string {
+	return fmt.Sprintf("webdav: %s: %s", e.Method, e.Status)
+}
+
+// isWebDAVNotFound 检查错误是否表示资源不存在
+func isWebDAVNotFound(err error) bool {
+	var davErr *WebDAVError
+	return errors.As(err, &davErr) && davErr.StatusCode == http.StatusNotFound
+}
+
+// davMultistatus PROPFIND 和 PROPPATCH 的 207 响应
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+// davResponse multistatus 中单个资源的结果
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+}
+
+// davPropstat 一组状态相同的属性
+type davPropstat struct {
+	Prop   davProp `xml:"DAV: prop"`
+	Status string  `xml:"DAV: status"`
+}
+
+// davProp 查询的属性，只有状态为 2xx 的 propstat 中的值有效
+type davProp struct {
+	ResourceType *struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	} `xml:"DAV: resourcetype"`
+	ContentLength string  `xml:"DAV: getcontentlength"`
+	LastModified  string  `xml:"DAV: getlastmodified"`
+	Metadata      *string `xml:"urn:cryptobackup metadata"`
+}
+
+// props 返回所有状态为 2xx 的属性
+func (r *davResponse) props() []davProp {
+	var props []davProp
+	for _, ps := range r.Propstats {
+		if statusOK(ps.Status) {
+			props = append(props, ps.Prop)
+		}
+	}
+	return props
+}
+
+// path 返回资源解码后的路径，不含结尾的 /
+func (r *davResponse) path() string {
+	u, err := url.Parse(r.Href)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// name 返回资源的名称
+func (r *davResponse) name() string {
+	return path.Base(r.path())
+}
+
+// isCollection 检查资源是否为目录
+func (r *davResponse) isCollection() bool {
+	for _, p := range r.props() {
+		if p.ResourceType != nil && p.ResourceType.Collection != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// contentLength 返回文件大小
+func (r *davResponse) contentLength() int64 {
+	for _, p := range r.props() {
+		if n, err := strconv.ParseInt(strings.TrimSpace(p.ContentLength), 10, 64); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// lastModified 返回修改时间（Unix时间戳）
+func (r *davResponse) lastModified() int64 {
+	for _, p := range r.props() {
+		if t, err := http.ParseTime(strings.TrimSpace(p.LastModified)); err == nil {
+			return t.Unix()
+		}
+	}
+	return 0
+}
+
+// metadata 返回自定义属性中的元数据，没有设置时返回 false
+func (r *davResponse) metadata() (map[string]string, bool) {
+	for _, p := range r.props() {
+		if p.Metadata == nil {
+			continue
+		}
+		var metadata map[string]string
+		if err := json.Unmarshal([]byte(*p.Metadata), &metadata); err != nil {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		return metadata, true
+	}
+	return nil, false
+}
+
+// statusOK 检查 "HTTP/1.1 200 OK" 形式的状态行是否为 2xx
+func statusOK(status string) bool {
+	fields := strings.Fields(status)
+	return len(fields) >= 2 && len(fields[1]) == 3 && fields[1][0] == '2'
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// testWebDAVServer 内存中的 WebDAV 服务器
+// deadProps 为 false 时拒绝所有 PROPPATCH 请求，模拟不支持自定义属性的服务器
+type testWebDAVServer struct {
+	fs         webdav.FileSystem
+	handler    *webdav.Handler
+	deadProps  bool
+	proppatchN atomic.Int32
+}
+
+func (s *testWebDAVServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PROPPATCH" {
+		s.proppatchN.Add(1)
+		if !s.deadProps {
+			http.Error(w, "properties are not supported", http.StatusNotImplemented)
+			return
+		}
+	}
+	s.handler.ServeHTTP(w, r)
+}
+
+func newTestWebDAV(t *testing.T, deadProps bool) (*testWebDAVServer, *WebDAVStorage) {
+	t.Helper()
+	fs := webdav.NewMemFS()
+	srv := &testWebDAVServer{
+		fs:        fs,
+		handler:   &webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()},
+		deadProps: deadProps,
+	}
+	server := httptest.NewServer(srv)
+	t.Cleanup(server.Close)
+
+	s, err := NewWebDAVStorage(WebDAVConfig{URL: server.URL + "/backups", Client: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, s
+}
+
+// exists 检查服务器上的文件是否存在，name 为备份根目录下的路径
+func (s *testWebDAVServer) exists(t *testing.T, name string) bool {
+	t.Helper()
+	_, err := s.fs.Stat(context.Background(), "/backups/"+name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func assertMetadata(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("metadata = %v, want %v", got, want)
+		return
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("metadata %s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestWebDAVUploadDownload(t *testing.T) {
+	srv, s := newTestWebDAV(t, true)
+	ctx := context.Background()
+
+	name := "dir/sub/报告 final&v2.pdf"
+	data := []byte("encrypted data")
+	metadata := map[string]string{"original_name": "<b>&\"quoted\"</b>", "original_size": "14"}
+	if err := s.Upload(ctx, name, bytes.NewReader(data), metadata); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := s.Download(ctx, name, &out); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("Download = %q, want %q", out.Bytes(), data)
+	}
+
+	got, err := s.GetMetadata(ctx, name)
+	if err != nil {
+		t.Fatalf("GetMetadata: %v", err)
+	}
+	assertMetadata(t, got, metadata)
+	if srv.exists(t, name+webdavSidecarSuffix) {
+		t.Error("sidecar file created although the server supports dead properties")
+	}
+
+	if ok, err := s.Exists(ctx, name); err != nil || !ok {
+		t.Errorf("Exists = %v, %v; want true", ok, err)
+	}
+	if ok, err := s.Exists(ctx, "dir/missing"); err != nil || ok {
+		t.Errorf("Exists(missing) = %v, %v; want false", ok, err)
+	}
+	if err := s.Download(ctx, "dir/missing", io.Discard); err == nil {
+		t.Error("downloading a missing file succeeded")
+	}
+
+	if err := s.Delete(ctx, name); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if srv.exists(t, name) {
+		t.Error("file still exists after Delete")
+	}
+	if err := s.Delete(ctx, name); err == nil {
+		t.Error("deleting a missing file succeeded")
+	}
+}
+
+func TestWebDAVList(t *testing.T) {
+	for _, deadProps := range []bool{true, false} {
+		_, s := newTestWebDAV(t, deadProps)
+		ctx := context.Background()
+
+		files := map[string]string{"dir/a.enc": "aaa", "dir/b c.enc": "bb", "dir/sub/nested.enc": "x", "other.enc": "y"}
+		for name, data := range files {
+			if err := s.Upload(ctx, name, strings.NewReader(data), map[string]string{"original_name": name}); err != nil {
+				t.Fatalf("Upload %s: %v", name, err)
+			}
+		}
+
+		list, err := s.List(ctx, "dir")
+		if err != nil {
+			t.Fatalf("deadProps=%v: List: %v", deadProps, err)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+
+		var paths []string
+		for _, f := range list {
+			paths = append(paths, f.Path)
+			if f.IsDir {
+				continue
+			}
+			if f.Size != int64(len(files[f.Path])) {
+				t.Errorf("deadProps=%v: %s: size %d, want %d", deadProps, f.Path, f.Size, len(files[f.Path]))
+			}
+			if f.ModTime == 0 {
+				t.Errorf("deadProps=%v: %s: missing modification time", deadProps, f.Path)
+			}
+			if f.Metadata["original_name"] != f.Path {
+				t.Errorf("deadProps=%v: %s: metadata %v", deadProps, f.Path, f.Metadata)
+			}
+		}
+		// .meta 文件不出现在列表中
+		if want := "dir/a.enc,dir/b c.enc,dir/sub"; strings.Join(paths, ",") != want {
+			t.Errorf("deadProps=%v: List = %v, want %s", deadProps, paths, want)
+		}
+		if len(list) == 3 && !list[2].IsDir {
+			t.Errorf("deadProps=%v: dir/sub is not reported as a directory", deadProps)
+		}
+	}
+}
+
+func TestWebDAVSidecarFallback(t *testing.T) {
+	srv, s := newTestWebDAV(t, false)
+	ctx := context.Background()
+
+	metadata := map[string]string{"original_name": "a.txt"}
+	for _, name := range []string{"a.enc", "b.enc"} {
+		if err := s.Upload(ctx, name, strings.NewReader("data"), metadata); err != nil {
+			t.Fatalf("Upload %s: %v", name, err)
+		}
+		if !srv.exists(t, name+webdavSidecarSuffix) {
+			t.Fatalf("%s: sidecar file not created", name)
+		}
+	}
+	// 第一次被拒绝后不再尝试自定义属性
+	if n := srv.proppatchN.Load(); n != 1 {
+		t.Errorf("sent %d PROPPATCH requests, want 1", n)
+	}
+
+	got, err := s.GetMetadata(ctx, "a.enc")
+	if err != nil {
+		t.Fatalf("GetMetadata: %v", err)
+	}
+	assertMetadata(t, got, metadata)
+
+	if err := s.Delete(ctx, "a.enc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if srv.exists(t, "a.enc"+webdavSidecarSuffix) {
+		t.Error("sidecar file left behind after Delete")
+	}
+}
+
+func TestWebDAVOverwriteClearsMetadata(t *testing.T) {
+	for _, deadProps := range []bool{true, false} {
+		srv, s := newTestWebDAV(t, deadProps)
+		ctx := context.Background()
+
+		if err := s.Upload(ctx, "file.enc", strings.NewReader("old"), map[string]string{"original_name": "old.txt"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Upload(ctx, "file.enc", strings.NewReader("new"), nil); err != nil {
+			t.Fatalf("deadProps=%v: overwrite: %v", deadProps, err)
+		}
+
+		got, err := s.GetMetadata(ctx, "file.enc")
+		if err != nil {
+			t.Fatalf("deadProps=%v: GetMetadata: %v", deadProps, err)
+		}
+		if len(got) != 0 {
+			t.Errorf("deadProps=%v: overwritten file kept old metadata %v", deadProps, got)
+		}
+		if srv.exists(t, "file.enc"+webdavSidecarSuffix) {
+			t.Errorf("deadProps=%v: old sidecar file left behind", deadProps)
+		}
+	}
+}
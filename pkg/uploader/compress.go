@@ -0,0 +1,215 @@
+package uploader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 支持的压缩算法
+const (
+	CompressionNone = "none" // 不压缩
+	CompressionGzip = "gzip" // gzip
+	CompressionZstd = "zstd" // Zstandard
+)
+
+// compressionKey 元数据中记录压缩算法的字段
+// 启用压缩时总是写入，数据被判断为无法压缩时为 none；没有这个字段的文件未压缩
+const compressionKey = "compression"
+
+const (
+	// compressionSampleSize 判断数据能否压缩时读取的样本大小
+	compressionSampleSize = 64 * 1024
+
+	// minCompressionSize 小于这个大小的数据不压缩
+	minCompressionSize = 128
+
+	// minCompressionSaving 样本压缩后至少减小的比例，否则认为数据已经压缩或加密过
+	minCompressionSaving = 0.1
+)
+
+// ErrUnknownCompression 不支持的压缩算法
+var ErrUnknownCompression = errors.New("unknown compression algorithm")
+
+// compressedMagic 常见压缩格式和媒体格式的文件头，这些数据再次压缩几乎没有收益
+var compressedMagic = [][]byte{
+	{0x1f, 0x8b},                       // gzip
+	{0x28, 0xb5, 0x2f, 0xfd},           // zstd
+	{0xfd, '7', 'z', 'X', 'Z', 0x00},   // xz
+	{'B', 'Z', 'h'},                    // bzip2
+	{'P', 'K', 0x03, 0x04},             // zip、docx、jar
+	{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}, // 7z
+	{'R', 'a', 'r', '!', 0x1a, 0x07},   // rar
+	{0x04, 0x22, 0x4d, 0x18},           // lz4
+	{0x89, 'P', 'N', 'G'},              // png
+	{0xff, 0xd8, 0xff},                 // jpeg
+	{'G', 'I', 'F', '8'},               // gif
+	{'R', 'I', 'F', 'F'},               // webp、avi、wav
+	[]byte("CRYPTBAK"),                 // cryptobackup 加密文件
+	[]byte("age-encryption.org/"),      // age 加密文件
+}
+
+// WithCompression 加密前使用指定的算法压缩数据（none、gzip 或 zstd）
+// 元数据中记录实际使用的算法，下载时自动解压。已经压缩过或无法压缩的数据不会再次压缩
+func WithCompression(algorithm string) Option {
+	return func(u *Uploader) {
+		u.compression = algorithm
+	}
+}
+
+// ParseCompression 检查压缩算法名称，空字符串等同于 none
+func ParseCompression(name string) (string, error) {
+	switch name {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip, CompressionZstd:
+		return name, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownCompression, name)
+	}
+}
+
+// compress 根据上传器的压缩设置和数据样本决定是否压缩，并将结果记录到元数据中
+// 返回的读取器输出压缩后的数据，调用方使用完后必须关闭它以结束后台的压缩
+func (u *Uploader) compress(src io.Reader, metadata map[string]string) (io.ReadCloser, error) {
+	if u.compression == "" {
+		return io.NopCloser(src), nil
+	}
+	algorithm, err := ParseCompression(u.compression)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == CompressionNone {
+		metadata[compressionKey] = CompressionNone
+		return io.NopCloser(src), nil
+	}
+
+	br := bufio.NewReaderSize(src, compressionSampleSize)
+	sample, err := br.Peek(compressionSampleSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+	if !isCompressible(sample) {
+		metadata[compressionKey] = CompressionNone
+		return io.NopCloser(br), nil
+	}
+	metadata[compressionKey] = algorithm
+
+	pr, pw := io.Pipe()
+	go func() {
+		zw, err := newCompressWriter(pw, algorithm)
+		if err == nil {
+			if _, err = io.Copy(zw, br); err == nil {
+				err = zw.Close()
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// newCompressWriter 创建指定算法的压缩写入器
+func newCompressWriter(w io.Writer, algorithm string) (io.WriteCloser, error) {
+	switch algorithm {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCompression, algorithm)
+	}
+}
+
+// newDecompressReader 创建指定算法的解压读取器
+func newDecompressReader(r io.Reader, algorithm string) (io.ReadCloser, error) {
+	switch algorithm {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCompression, algorithm)
+	}
+}
+
+// decompressWriter 将写入的压缩数据解压后写入目标
+// 解密器以写入的方式输出明文，解压在后台读取管道
+type decompressWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// newDecompressWriter 返回解压到 dst 的写入器，algorithm 为空或 none 时直接写入 dst
+func newDecompressWriter(dst io.Writer, algorithm string) (*decompressWriter, io.Writer) {
+	if algorithm == "" || algorithm == CompressionNone {
+		return nil, dst
+	}
+
+	pr, pw := io.Pipe()
+	w := &decompressWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		r, err := newDecompressReader(pr, algorithm)
+		if err == nil {
+			_, err = io.Copy(dst, r)
+			if closeErr := r.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to decompress data: %w", err)
+		}
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w, w
+}
+
+// Write 写入压缩数据
+func (w *decompressWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// finish 结束写入并等待解压完成，cause 不为 nil 表示写入方出错
+func (w *decompressWriter) finish(cause error) error {
+	if w == nil {
+		return cause
+	}
+	w.pw.CloseWithError(cause)
+	err := <-w.done
+	if cause != nil {
+		return cause
+	}
+	return err
+}
+
+// isCompressible 根据样本判断数据是否值得压缩
+// 已知的压缩格式直接跳过，其他数据使用最快的压缩级别试压缩样本
+func isCompressible(sample []byte) bool {
+	if len(sample) < minCompressionSize {
+		return false
+	}
+	for _, magic := range compressedMagic {
+		if bytes.HasPrefix(sample, magic) {
+			return false
+		}
+	}
+
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return false
+	}
+	fw.Write(sample)
+	fw.Close()
+	return float64(buf.Len()) < float64(len(sample))*(1-minCompressionSaving)
+}
@@ -0,0 +1,186 @@
+package uploader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+
+	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/storage"
+)
+
+// compressibleData 返回大于采样大小、可以压缩的文本
+func compressibleData() []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 3*compressionSampleSize; i++ {
+		buf.WriteString("2025-06-01 12:00:00 INFO request served in " + strconv.Itoa(i%97) + "ms\n")
+	}
+	return buf.Bytes()
+}
+
+// randomData 返回n字节的随机数据
+func randomData(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// gzipData 返回gzip压缩后的数据
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// compressForTest 使用上传器的压缩设置处理数据，返回输出和记录的元数据
+func compressForTest(t *testing.T, u *Uploader, data []byte) ([]byte, map[string]string) {
+	t.Helper()
+	metadata := make(map[string]string)
+	r, err := u.compress(bytes.NewReader(data), metadata)
+	if err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	return out, metadata
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	enc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{8}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := compressibleData()
+
+	for algorithm, magic := range map[string][]byte{
+		CompressionGzip: {0x1f, 0x8b},
+		CompressionZstd: {0x28, 0xb5, 0x2f, 0xfd},
+	} {
+		store := storage.NewMemStorage()
+		u := NewUploader(enc, store, WithCompression(algorithm))
+
+		// 元数据记录的算法与实际输出的格式一致
+		out, metadata := compressForTest(t, u, plaintext)
+		if metadata[compressionKey] != algorithm || !bytes.HasPrefix(out, magic) {
+			t.Errorf("%s: compression = %q, output starts with %x", algorithm, metadata[compressionKey], out[:4])
+		}
+		if len(out) >= len(plaintext)/2 {
+			t.Errorf("%s: compressed %d bytes to %d", algorithm, len(plaintext), len(out))
+		}
+
+		if err := u.UploadStream(ctx, bytes.NewReader(plaintext), "/app.log.enc", nil); err != nil {
+			t.Fatalf("%s: UploadStream: %v", algorithm, err)
+		}
+		stored, err := store.GetMetadata(ctx, "/app.log.enc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored[compressionKey] != algorithm {
+			t.Errorf("%s: stored compression = %q", algorithm, stored[compressionKey])
+		}
+		if size, _ := strconv.Atoi(stored["encrypted_size"]); size == 0 || size >= len(plaintext)/2 {
+			t.Errorf("%s: encrypted_size = %s for %d bytes of text", algorithm, stored["encrypted_size"], len(plaintext))
+		}
+
+		// 下载时根据元数据解压，不需要压缩选项
+		var got bytes.Buffer
+		if err := NewUploader(enc, store).DownloadStream(ctx, "/app.log.enc", &got); err != nil {
+			t.Fatalf("%s: DownloadStream: %v", algorithm, err)
+		}
+		if !bytes.Equal(got.Bytes(), plaintext) {
+			t.Errorf("%s: round trip mismatch", algorithm)
+		}
+	}
+}
+
+func TestIncompressibleDataStoredRaw(t *testing.T) {
+	ctx := context.Background()
+	enc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{8}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := NewUploader(enc, storage.NewMemStorage(), WithCompression(CompressionZstd))
+
+	for name, data := range map[string][]byte{
+		"random":  randomData(t, 2*compressionSampleSize),
+		"gzipped": gzipData(t, compressibleData()),
+		"short":   []byte("too short to compress"),
+		"empty":   nil,
+	} {
+		out, metadata := compressForTest(t, u, data)
+		if metadata[compressionKey] != CompressionNone {
+			t.Errorf("%s: compression = %q, want none", name, metadata[compressionKey])
+		}
+		if !bytes.Equal(out, data) {
+			t.Errorf("%s: data was changed", name)
+		}
+
+		if err := u.UploadStream(ctx, bytes.NewReader(data), "/"+name+".enc", nil); err != nil {
+			t.Fatalf("%s: UploadStream: %v", name, err)
+		}
+		var got bytes.Buffer
+		if err := u.DownloadStream(ctx, "/"+name+".enc", &got); err != nil {
+			t.Fatalf("%s: DownloadStream: %v", name, err)
+		}
+		if !bytes.Equal(got.Bytes(), data) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+	}
+
+	// 没有启用压缩时不写入 compression 字段；none 明确记录为未压缩
+	if _, metadata := compressForTest(t, NewUploader(enc, nil), compressibleData()); len(metadata) != 0 {
+		t.Errorf("compression disabled: metadata = %v", metadata)
+	}
+	if out, metadata := compressForTest(t, NewUploader(enc, nil, WithCompression(CompressionNone)), compressibleData()); metadata[compressionKey] != CompressionNone || !bytes.Equal(out, compressibleData()) {
+		t.Errorf("compression none: metadata = %v", metadata)
+	}
+
+	bad := NewUploader(enc, storage.NewMemStorage(), WithCompression("lzma"))
+	if err := bad.UploadStream(ctx, bytes.NewReader(compressibleData()), "/x.enc", nil); !errors.Is(err, ErrUnknownCompression) {
+		t.Errorf("unknown algorithm: got %v, want ErrUnknownCompression", err)
+	}
+}
+
+func TestIsCompressible(t *testing.T) {
+	text := compressibleData()[:compressionSampleSize]
+	tests := []struct {
+		name   string
+		sample []byte
+		want   bool
+	}{
+		{"text", text, true},
+		{"zeros", make([]byte, 1024), true},
+		{"shorter than the minimum", text[:minCompressionSize-1], false},
+		{"minimum size", bytes.Repeat([]byte("a"), minCompressionSize), true},
+		{"random", randomData(t, compressionSampleSize), false},
+		{"gzip", gzipData(t, text), false},
+		{"png header", append([]byte{0x89, 'P', 'N', 'G'}, text...), false},
+		{"zip header", append([]byte{'P', 'K', 0x03, 0x04}, text...), false},
+		{"encrypted file", append([]byte("CRYPTBAK"), text...), false},
+		{"age file", append([]byte("age-encryption.org/v1\n"), text...), false},
+	}
+	for _, tt := range tests {
+		if got := isCompressible(tt.sample); got != tt.want {
+			t.Errorf("%s: isCompressible = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package uploader
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"cryptobackup/pkg/crypto"
+)
+
+// sealedMetadataKey 加密后的元数据保存在这个字段中
+const sealedMetadataKey = "sealed"
+
+// publicMetadataFields 加密元数据模式下保持公开的字段
+// 只包含选择解密器需要的信息：算法、格式版本和密钥标识
+var publicMetadataFields = []string{
+	"algorithm",
+	"format_version",
+	"key_fingerprint",
+	"key_id",
+	"kdf",
+	"recipients",
+	"age_recipients",
+	"plugin",
+}
+
+// WithSealedMetadata 加密元数据
+// 只有 publicMetadataFields 中的字段保持公开，其余字段（原始文件名、大小、上传时间等）
+// 使用从主密钥派生的元数据密钥加密后保存在 sealed 字段中（只有公钥的加密器使用文件的加密器）。
+// 读取时会自动解密
+func WithSealedMetadata() Option {
+	return func(u *Uploader) {
+		u.sealMetadata = true
+	}
+}
+
+// seal 将元数据拆分为公开部分和加密部分
+// 加密部分与远程路径绑定，不能复制到其他文件的元数据中使用
+func (u *Uploader) seal(remotePath string, metadata map[string]string) (map[string]string, error) {
+	public := make(map[string]string)
+	private := make(map[string]string)
+	for k, v := range metadata {
+		private[k] = v
+	}
+	for _, k := range publicMetadataFields {
+		if v, ok := private[k]; ok {
+			public[k] = v
+			delete(private, k)
+		}
+	}
+
+	data, err := json.Marshal(private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	metaCipher, err := u.metadataCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	var sealed []byte
+	if metaCipher != nil {
+		sealed, err = metaCipher.Seal(data, sealedMetadataAAD(remotePath))
+	} else {
+		// 只有接收者公钥时无法派生对称密钥，使用完整的加密器
+		var buf bytes.Buffer
+		src := bytes.NewReader(data)
+		if encryptor, ok := u.encryptor.(crypto.AADEncryptor); ok {
+			err = encryptor.EncryptWithAAD(src, &buf, sealedMetadataAAD(remotePath))
+		} else {
+			err = u.encryptor.Encrypt(src, &buf)
+		}
+		sealed = buf.Bytes()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal metadata: %w", err)
+	}
+
+	public[sealedMetadataKey] = base64.StdEncoding.EncodeToString(sealed)
+	return public, nil
+}
+
+// unseal 解密元数据中的加密部分，并合并到metadata中
+// 没有加密部分时直接返回
+func (u *Uploader) unseal(remotePath string, metadata map[string]string) error {
+	encoded, ok := metadata[sealedMetadataKey]
+	if !ok {
+		return nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid sealed metadata: %w", err)
+	}
+
+	metaCipher, err := u.metadataCipher()
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if metaCipher != nil {
+		if data, err = metaCipher.Open(sealed, sealedMetadataAAD(remotePath)); err != nil {
+			return fmt.Errorf("failed to unseal metadata: %w", err)
+		}
+	} else {
+		// 只有接收者私钥时，元数据由完整的加密器加密
+		var buf bytes.Buffer
+		src := bytes.NewReader(sealed)
+		if decryptor, ok := u.encryptor.(crypto.AADEncryptor); ok {
+			err = decryptor.DecryptWithAAD(src, &buf, sealedMetadataAAD(remotePath))
+		} else {
+			err = u.encryptor.Decrypt(src, &buf)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to unseal metadata: %w", err)
+		}
+		data = buf.Bytes()
+	}
+
+	var private map[string]string
+	if err := json.Unmarshal(data, &private); err != nil {
+		return fmt.Errorf("invalid sealed metadata: %w", err)
+	}
+
+	delete(metadata, sealedMetadataKey)
+	for k, v := range private {
+		metadata[k] = v
+	}
+	return nil
+}
+
+// metadataCipher 返回元数据加密器，第一次调用时创建
+// 同一上传器加密的所有元数据共用一个盐，口令模式下只需运行一次Argon2id；
+// 解密其他上传器加密的元数据时每个盐运行一次。
+// 加密器没有对称主密钥时返回nil，调用方使用完整的加密器
+func (u *Uploader) metadataCipher() (*crypto.MetadataCipher, error) {
+	u.meta.once.Do(func() {
+		u.meta.cipher, u.meta.err = crypto.NewMetadataCipher(u.encryptor)
+		if errors.Is(u.meta.err, crypto.ErrNoMetadataKey) {
+			u.meta.err = nil
+		}
+	})
+	return u.meta.cipher, u.meta.err
+}
+
+// associatedData 根据远程路径和关键元数据构造附加认证数据
+// 使用明文路径和明文元数据，加密文件名的密钥更换后附加数据保持不变。
+// optionalBoundMetadataFields 只在存在时参与认证，没有使用这些功能的文件与旧版本的附加数据一致
+func associatedData(remotePath string, metadata map[string]string) []byte {
+	items := []string{"cryptobackup aad v1", canonicalPath(remotePath)}
+	for _, k := range boundMetadataFields {
+		items = append(items, k, metadata[k])
+	}
+	for _, k := range optionalBoundMetadataFields {
+		if v, ok := metadata[k]; ok {
+			items = append(items, k, v)
+		}
+	}
+	return encodeAAD(items)
+}
+
+// sealedMetadataAAD 加密元数据使用的附加认证数据
+func sealedMetadataAAD(remotePath string) []byte {
+	return encodeAAD([]string{"cryptobackup sealed metadata v1", canonicalPath(remotePath)})
+}
+
+// encodeAAD 将各项编码为 长度(uint32) || 值 的序列
+func encodeAAD(items []string) []byte {
+	var buf bytes.Buffer
+	for _, item := range items {
+		binary.Write(&buf, binary.BigEndian, uint32(len(item)))
+		buf.WriteString(item)
+	}
+	return buf.Bytes()
+}
+
+// canonicalPath 将远程路径统一为以 / 开头的规范形式
+func canonicalPath(remotePath string) string {
+	return path.Clean("/" + filepath.ToSlash(remotePath))
+}
@@ -0,0 +1,185 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/storage"
+)
+
+func TestSealedMetadataRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemStorage()
+	key := bytes.Repeat([]byte{7}, 32)
+
+	enc, err := crypto.NewAESEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := NewUploader(enc, store, WithSealedMetadata())
+	meta := map[string]string{"original_name": "report.pdf", "original_size": "6"}
+	if err := u.UploadStream(ctx, bytes.NewReader([]byte("secret")), "/docs/report.pdf.enc", meta); err != nil {
+		t.Fatalf("UploadStream: %v", err)
+	}
+
+	stored, err := store.GetMetadata(ctx, "/docs/report.pdf.enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored["original_name"]; ok {
+		t.Fatal("original_name stored in the clear")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(stored[sealedMetadataKey])
+	if err != nil || !crypto.IsSealedMetadata(sealed) {
+		t.Fatalf("sealed field does not use the metadata key format (err %v)", err)
+	}
+
+	// 相同主密钥的自动识别解密器可以读取
+	auto, err := crypto.NewAutoDecryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := NewUploader(auto, store).GetFileInfo(ctx, "/docs/report.pdf.enc")
+	if err != nil {
+		t.Fatalf("GetFileInfo: %v", err)
+	}
+	if info["original_name"] != "report.pdf" {
+		t.Errorf("original_name = %q, want report.pdf", info["original_name"])
+	}
+
+	// 元数据不能复制到其他路径
+	if err := store.Upload(ctx, "/docs/other.enc", bytes.NewReader(nil), stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.GetFileInfo(ctx, "/docs/other.enc"); err == nil {
+		t.Error("sealed metadata copied to another path was accepted")
+	}
+}
+
+func TestSealedMetadataRandomSalt(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemStorage()
+	newEncryptor := func() crypto.Encryptor {
+		enc, err := crypto.NewAESEncryptorWithPassphrase("correct horse battery staple", crypto.KDFArgon2id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enc
+	}
+
+	// 两个上传器各自生成随机盐，同一上传器的文件共用一个盐
+	first := NewUploader(newEncryptor(), store, WithSealedMetadata())
+	second := NewUploader(newEncryptor(), store, WithSealedMetadata())
+	var salts [][]byte
+	for i, p := range []string{"/a.enc", "/b.enc", "/c.enc"} {
+		u := first
+		if i == 2 {
+			u = second
+		}
+		if err := u.UploadStream(ctx, bytes.NewReader([]byte(p)), p, map[string]string{"original_name": p}); err != nil {
+			t.Fatalf("UploadStream %s: %v", p, err)
+		}
+		stored, err := store.GetMetadata(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed, err := base64.StdEncoding.DecodeString(stored[sealedMetadataKey])
+		if err != nil || !crypto.IsSealedMetadata(sealed) {
+			t.Fatalf("%s: invalid sealed field (err %v)", p, err)
+		}
+		salts = append(salts, sealed[8:24])
+	}
+	if !bytes.Equal(salts[0], salts[1]) {
+		t.Error("one uploader used different metadata salts")
+	}
+	if bytes.Equal(salts[1], salts[2]) {
+		t.Error("separate uploaders used the same metadata salt")
+	}
+
+	// 另一个上传器按密文中的盐派生密钥，可以读取所有文件
+	reader := NewUploader(newEncryptor(), store)
+	for _, p := range []string{"/a.enc", "/b.enc", "/c.enc"} {
+		info, err := reader.GetFileInfo(ctx, p)
+		if err != nil {
+			t.Fatalf("GetFileInfo %s: %v", p, err)
+		}
+		if info["original_name"] != p {
+			t.Errorf("%s: original_name = %q", p, info["original_name"])
+		}
+	}
+
+	// 修改盐后无法解密
+	stored, err := store.GetMetadata(ctx, "/a.enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(stored[sealedMetadataKey])
+	sealed[8] ^= 1
+	stored[sealedMetadataKey] = base64.StdEncoding.EncodeToString(sealed)
+	if err := store.Upload(ctx, "/a.enc", bytes.NewReader(nil), stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.GetFileInfo(ctx, "/a.enc"); err == nil {
+		t.Error("metadata with a modified salt was accepted")
+	}
+}
+
+func TestSealedMetadataRejectsFullEncryptorFormat(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemStorage()
+	enc, err := crypto.NewChaCha20Encryptor(bytes.Repeat([]byte{9}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 持有对称主密钥时只接受元数据密钥格式
+	var sealed bytes.Buffer
+	if err := enc.EncryptWithAAD(bytes.NewReader([]byte(`{"original_name":"old.txt"}`)), &sealed, sealedMetadataAAD("/old.enc")); err != nil {
+		t.Fatal(err)
+	}
+	metadata := enc.GetMetadata()
+	metadata[sealedMetadataKey] = base64.StdEncoding.EncodeToString(sealed.Bytes())
+	if err := store.Upload(ctx, "/old.enc", bytes.NewReader(nil), metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewUploader(enc, store).GetFileInfo(ctx, "/old.enc"); err == nil {
+		t.Error("metadata sealed with the full encryptor was accepted")
+	}
+}
+
+func TestSealedMetadataRecipientsFallBack(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemStorage()
+	private, public, err := crypto.GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := crypto.NewX25519Encryptor([][]byte{public})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crypto.NewMetadataCipher(enc); err != crypto.ErrNoMetadataKey {
+		t.Fatalf("NewMetadataCipher with public keys only: got %v, want ErrNoMetadataKey", err)
+	}
+
+	u := NewUploader(enc, store, WithSealedMetadata())
+	if err := u.UploadStream(ctx, bytes.NewReader([]byte("data")), "/x.enc", map[string]string{"original_name": "x"}); err != nil {
+		t.Fatalf("UploadStream: %v", err)
+	}
+
+	dec, err := crypto.NewX25519Decryptor(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := NewUploader(dec, store).GetFileInfo(ctx, "/x.enc")
+	if err != nil {
+		t.Fatalf("GetFileInfo: %v", err)
+	}
+	if info["original_name"] != "x" {
+		t.Errorf("original_name = %q, want x", info["original_name"])
+	}
+}
@@ -0,0 +1,50 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/storage"
+)
+
+// NameSaltPath 仓库中保存文件名盐的路径
+// 口令派生文件名密钥时使用该盐，盐不是秘密，明文保存在仓库根目录
+const NameSaltPath = "/.cryptobackup-name-salt"
+
+// LoadNameSalt 读取仓库的文件名盐，仓库中还没有时生成随机盐并保存
+func LoadNameSalt(ctx context.Context, store storage.Storage) ([]byte, error) {
+	exists, err := store.Exists(ctx, NameSaltPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check name salt: %w", err)
+	}
+
+	if !exists {
+		salt := make([]byte, crypto.NameSaltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, fmt.Errorf("failed to generate name salt: %w", err)
+		}
+		if err := store.Upload(ctx, NameSaltPath, bytes.NewReader(salt), nil); err != nil {
+			return nil, fmt.Errorf("failed to save name salt: %w", err)
+		}
+		return salt, nil
+	}
+
+	var buf bytes.Buffer
+	if err := store.Download(ctx, NameSaltPath, &buf); err != nil {
+		return nil, fmt.Errorf("failed to read name salt: %w", err)
+	}
+	if buf.Len() != crypto.NameSaltSize {
+		return nil, fmt.Errorf("invalid name salt size: %d", buf.Len())
+	}
+	return buf.Bytes(), nil
+}
+
+// IsRepositoryFile 判断存储路径是否为仓库自身使用的文件（如文件名盐），
+// 列出、验证和重新加密文件时跳过这些文件
+func IsRepositoryFile(storagePath string) bool {
+	return canonicalPath(storagePath) == NameSaltPath
+}
@@ -0,0 +1,227 @@
+package uploader
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// 支持的填充方案
+const (
+	PaddingNone  = "none"  // 不填充
+	PaddingPadme = "padme" // Padmé：最多增加约12%，大文件的长度只保留 O(log log n) 位信息
+	PaddingPow2  = "pow2"  // 填充到2的幂：只泄露长度的数量级，最多增加一倍
+)
+
+// paddingKey 元数据中记录填充方案的字段，没有这个字段的文件未填充
+const paddingKey = "padding"
+
+const (
+	// paddingFrameSize 填充格式中每帧数据的最大长度
+	paddingFrameSize = 64 * 1024
+
+	// paddingFrameHeaderSize 帧头（数据长度）的字节数
+	paddingFrameHeaderSize = 4
+
+	// minPow2Size pow2 方案的最小长度，小文件都填充到这个长度
+	minPow2Size = 4096
+)
+
+// ErrUnknownPadding 不支持的填充方案
+var ErrUnknownPadding = errors.New("unknown padding scheme")
+
+// ErrInvalidPadding 解密后的数据不是有效的填充格式
+var ErrInvalidPadding = errors.New("invalid padding")
+
+// WithPadding 加密前使用指定的方案填充数据，隐藏文件的准确长度
+//
+// 填充在加密信封内部进行：明文分帧后补零到方案规定的长度再整体加密，
+// 密文长度只反映填充后的长度。元数据中记录填充方案，下载时自动去除填充。
+// 启用压缩时先压缩再填充
+func WithPadding(scheme string) Option {
+	return func(u *Uploader) {
+		u.padding = scheme
+	}
+}
+
+// WithoutOriginalSize 不在公开的元数据中保存原始文件大小
+// 加密元数据时原始大小本来就不公开，仍然保存在加密的部分中
+func WithoutOriginalSize() Option {
+	return func(u *Uploader) {
+		u.hideSize = true
+	}
+}
+
+// ParsePadding 检查填充方案名称，空字符串等同于 none
+func ParsePadding(name string) (string, error) {
+	switch name {
+	case "", PaddingNone:
+		return PaddingNone, nil
+	case PaddingPadme, PaddingPow2:
+		return name, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownPadding, name)
+	}
+}
+
+// paddedSize 返回长度为 size 的数据按方案填充后的长度
+func paddedSize(size uint64, scheme string) uint64 {
+	switch scheme {
+	case PaddingPadme:
+		return padme(size)
+	case PaddingPow2:
+		if size <= minPow2Size {
+			return minPow2Size
+		}
+		return 1 << bits.Len64(size-1)
+	default:
+		return size
+	}
+}
+
+// padme 计算 Padmé 填充后的长度
+// 长度 L 的二进制表示中只保留最高的 floor(log2(floor(log2 L)))+1 位，其余低位向上取整
+func padme(size uint64) uint64 {
+	if size < 2 {
+		return size
+	}
+	e := uint64(bits.Len64(size) - 1)
+	s := uint64(bits.Len64(e))
+	mask := uint64(1)<<(e-s) - 1
+	return (size + mask) &^ mask
+}
+
+// dropOriginalSize 设置了 WithoutOriginalSize 且元数据不加密时删除原始大小
+// 必须在加密前调用，原始大小参与附加认证
+func (u *Uploader) dropOriginalSize(metadata map[string]string) {
+	if u.hideSize && !u.sealMetadata {
+		delete(metadata, "original_size")
+	}
+}
+
+// pad 按上传器的填充设置填充数据，并将方案记录到元数据中
+// 返回的读取器使用完后必须关闭，以结束后台的填充
+func (u *Uploader) pad(src io.Reader, metadata map[string]string) (io.ReadCloser, error) {
+	if u.padding == "" {
+		return io.NopCloser(src), nil
+	}
+	scheme, err := ParsePadding(u.padding)
+	if err != nil {
+		return nil, err
+	}
+	metadata[paddingKey] = scheme
+	if scheme == PaddingNone {
+		return io.NopCloser(src), nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writePadded(pw, src, scheme))
+	}()
+	return pr, nil
+}
+
+// writePadded 将 src 按帧写入 w，写入结束帧后补零到方案规定的长度
+//
+// 格式为若干个 长度(uint32) || 数据 的帧，长度为0的帧表示数据结束，之后全部是填充。
+// 使用帧而不是在开头记录总长度，填充时不需要预先知道数据长度，明文也不需要写入临时文件
+func writePadded(w io.Writer, src io.Reader, scheme string) error {
+	buf := make([]byte, paddingFrameHeaderSize+paddingFrameSize)
+	var written uint64
+	for {
+		n, err := io.ReadFull(src, buf[paddingFrameHeaderSize:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := w.Write(buf[:paddingFrameHeaderSize+n]); err != nil {
+				return err
+			}
+			written += uint64(paddingFrameHeaderSize + n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// 结束帧
+	clear(buf[:paddingFrameHeaderSize])
+	if _, err := w.Write(buf[:paddingFrameHeaderSize]); err != nil {
+		return err
+	}
+	written += paddingFrameHeaderSize
+
+	_, err := io.CopyN(w, zeroReader{}, int64(paddedSize(written, scheme)-written))
+	return err
+}
+
+// zeroReader 无限输出零字节
+type zeroReader struct{}
+
+// Read 用零填满p
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// unpadWriter 去除填充：解析 writePadded 写入的帧，只向目标写入数据，丢弃结束帧之后的填充
+type unpadWriter struct {
+	dst       io.Writer
+	header    []byte // 正在读取的帧头
+	remaining int    // 当前帧还未写入的数据长度
+	done      bool   // 是否已经读到结束帧
+}
+
+// newUnpadWriter 返回去除填充后写入 dst 的写入器，scheme 为空或 none 时直接写入 dst
+func newUnpadWriter(dst io.Writer, scheme string) (*unpadWriter, io.Writer) {
+	if scheme == "" || scheme == PaddingNone {
+		return nil, dst
+	}
+	w := &unpadWriter{dst: dst, header: make([]byte, 0, paddingFrameHeaderSize)}
+	return w, w
+}
+
+// Write 写入填充后的数据
+func (w *unpadWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 && !w.done {
+		if w.remaining > 0 {
+			data := p[:min(len(p), w.remaining)]
+			if _, err := w.dst.Write(data); err != nil {
+				return 0, err
+			}
+			w.remaining -= len(data)
+			p = p[len(data):]
+			continue
+		}
+
+		take := min(paddingFrameHeaderSize-len(w.header), len(p))
+		w.header = append(w.header, p[:take]...)
+		p = p[take:]
+		if len(w.header) < paddingFrameHeaderSize {
+			break
+		}
+		size := binary.BigEndian.Uint32(w.header)
+		w.header = w.header[:0]
+		if size > paddingFrameSize {
+			return 0, fmt.Errorf("%w: frame too large", ErrInvalidPadding)
+		}
+		w.remaining = int(size)
+		w.done = size == 0
+	}
+	return n, nil
+}
+
+// finish 检查是否读到了结束帧，cause 不为 nil 表示写入方出错
+func (w *unpadWriter) finish(cause error) error {
+	if w == nil || cause != nil {
+		return cause
+	}
+	if !w.done {
+		return fmt.Errorf("%w: data is truncated", ErrInvalidPadding)
+	}
+	return nil
+}
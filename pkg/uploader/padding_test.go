@@ -0,0 +1,175 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"testing"
+
+	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/storage"
+)
+
+// paddedForTest 返回 writePadded 的输出
+func paddedForTest(t *testing.T, data []byte, scheme string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writePadded(&buf, bytes.NewReader(data), scheme); err != nil {
+		t.Fatalf("writePadded: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// unpadForTest 一次写入padded后去除填充
+func unpadForTest(padded []byte) ([]byte, error) {
+	var out bytes.Buffer
+	unpadder, w := newUnpadWriter(&out, PaddingPadme)
+	if _, err := w.Write(padded); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), unpadder.finish(nil)
+}
+
+func TestPaddedSize(t *testing.T) {
+	tests := []struct {
+		size   uint64
+		scheme string
+		want   uint64
+	}{
+		{0, PaddingPow2, minPow2Size},
+		{1, PaddingPow2, minPow2Size},
+		{minPow2Size, PaddingPow2, minPow2Size},
+		{minPow2Size + 1, PaddingPow2, 2 * minPow2Size},
+		{1 << 20, PaddingPow2, 1 << 20},
+		{1<<20 + 1, PaddingPow2, 1 << 21},
+		{0, PaddingPadme, 0},
+		{1, PaddingPadme, 1},
+		{2, PaddingPadme, 2},
+		{9, PaddingPadme, 10},
+		{100, PaddingPadme, 104},
+		{1000, PaddingPadme, 1024},
+		{1 << 20, PaddingPadme, 1 << 20},
+		{1<<20 + 1, PaddingPadme, 1<<20 + 1<<15},
+		{12345, PaddingNone, 12345},
+	}
+	for _, tt := range tests {
+		if got := paddedSize(tt.size, tt.scheme); got != tt.want {
+			t.Errorf("paddedSize(%d, %s) = %d, want %d", tt.size, tt.scheme, got, tt.want)
+		}
+	}
+
+	// Padmé 不会缩短数据，最多增加约12%
+	for size := uint64(1); size < 1<<24; size = size*3/2 + 1 {
+		got := padme(size)
+		if got < size || float64(got-size) > 0.12*float64(size)+1 {
+			t.Errorf("padme(%d) = %d", size, got)
+		}
+	}
+}
+
+func TestPaddingRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	enc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{9}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, scheme := range []string{PaddingPadme, PaddingPow2} {
+		store := storage.NewMemStorage()
+		u := NewUploader(enc, store, WithPadding(scheme))
+
+		sizes := []int{0, 1, paddingFrameSize - 1, paddingFrameSize, paddingFrameSize + 1, 5000, 6000}
+		encryptedSizes := make(map[int]string)
+		for _, size := range sizes {
+			data := bytes.Repeat([]byte{byte(size)}, size)
+			remotePath := "/" + strconv.Itoa(size) + ".enc"
+			if err := u.UploadStream(ctx, bytes.NewReader(data), remotePath, nil); err != nil {
+				t.Fatalf("%s/%d: UploadStream: %v", scheme, size, err)
+			}
+			metadata, err := store.GetMetadata(ctx, remotePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metadata[paddingKey] != scheme {
+				t.Errorf("%s/%d: padding = %q", scheme, size, metadata[paddingKey])
+			}
+			encryptedSizes[size] = metadata["encrypted_size"]
+
+			var got bytes.Buffer
+			if err := NewUploader(enc, store).DownloadStream(ctx, remotePath, &got); err != nil {
+				t.Fatalf("%s/%d: DownloadStream: %v", scheme, size, err)
+			}
+			if !bytes.Equal(got.Bytes(), data) {
+				t.Errorf("%s/%d: round trip mismatch (%d bytes)", scheme, size, got.Len())
+			}
+		}
+
+		// 填充到同一长度的文件密文长度相同
+		if scheme == PaddingPow2 && encryptedSizes[0] != encryptedSizes[1] {
+			t.Errorf("pow2: encrypted sizes %s and %s differ", encryptedSizes[0], encryptedSizes[1])
+		}
+		if scheme == PaddingPow2 && encryptedSizes[5000] != encryptedSizes[6000] {
+			t.Errorf("pow2: encrypted sizes %s and %s differ", encryptedSizes[5000], encryptedSizes[6000])
+		}
+	}
+
+	bad := NewUploader(enc, storage.NewMemStorage(), WithPadding("random"))
+	if err := bad.UploadStream(ctx, bytes.NewReader([]byte("data")), "/x.enc", nil); !errors.Is(err, ErrUnknownPadding) {
+		t.Errorf("unknown scheme: got %v, want ErrUnknownPadding", err)
+	}
+}
+
+func TestUnpadWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("padded data "), 10000)
+	padded := paddedForTest(t, data, PaddingPadme)
+	if uint64(len(padded)) != padme(uint64(len(data)+3*paddingFrameHeaderSize)) {
+		t.Fatalf("padded length %d", len(padded))
+	}
+
+	// 逐字节写入，帧头被拆开时也能正确解析
+	var out bytes.Buffer
+	unpadder, w := newUnpadWriter(&out, PaddingPadme)
+	for i := range padded {
+		if _, err := w.Write(padded[i : i+1]); err != nil {
+			t.Fatalf("byte %d: %v", i, err)
+		}
+	}
+	if err := unpadder.finish(nil); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("byte by byte: %v", err)
+	}
+
+	// 截断：缺少结束帧或帧头不完整
+	endFrame := len(data) + 2*paddingFrameHeaderSize
+	for _, n := range []int{0, 2, paddingFrameHeaderSize + 10, endFrame, endFrame + 2} {
+		if _, err := unpadForTest(padded[:n]); !errors.Is(err, ErrInvalidPadding) {
+			t.Errorf("truncated to %d bytes: got %v, want ErrInvalidPadding", n, err)
+		}
+	}
+	if got, err := unpadForTest(padded[:endFrame+paddingFrameHeaderSize]); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("without the zero padding: %v", err)
+	}
+
+	// 帧长度超过最大值
+	corrupted := bytes.Clone(padded)
+	binary.BigEndian.PutUint32(corrupted, paddingFrameSize+1)
+	if _, err := unpadForTest(corrupted); !errors.Is(err, ErrInvalidPadding) {
+		t.Errorf("oversized frame: got %v, want ErrInvalidPadding", err)
+	}
+	// 帧长度被改小后，后续数据被当作帧头解析
+	corrupted = bytes.Clone(padded)
+	binary.BigEndian.PutUint32(corrupted, 1)
+	if _, err := unpadForTest(corrupted); !errors.Is(err, ErrInvalidPadding) {
+		t.Errorf("shortened frame: got %v, want ErrInvalidPadding", err)
+	}
+
+	// 写入方出错时返回原来的错误
+	cause := errors.New("decryption failed")
+	if err := unpadder.finish(cause); err != cause {
+		t.Errorf("finish(cause) = %v", err)
+	}
+	if unpadder, w := newUnpadWriter(&out, PaddingNone); unpadder != nil || w != &out {
+		t.Error("scheme none wraps the writer")
+	}
+}
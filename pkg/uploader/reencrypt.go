@@ -0,0 +1,521 @@
+package uploader
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"cryptobackup/pkg/crypto"
+)
+
+// cryptoMetadataFields 由加密器和上传器生成的元数据字段，重新加密时使用新的值
+var cryptoMetadataFields = []string{
+	"algorithm",
+	"format_version",
+	"key_size",
+	"key_fingerprint",
+	"key_id",
+	"kdf",
+	"recipients",
+	"age_recipients",
+	"plugin",
+	"plugin_algorithm",
+	"encrypted_size",
+	sealedMetadataKey,
+	compressionKey,
+	paddingKey,
+	contentHashKey,
+	signerKey,
+	signatureKey,
+}
+
+// ReencryptReport 重新加密的结果
+type ReencryptReport struct {
+	Reencrypted []string         // 本次重新加密的文件（明文路径）
+	Skipped     []string         // 日志中记录为已完成而跳过的文件
+	Failed      map[string]error // 失败的文件及原因
+}
+
+// Reencrypt 使用新的加密器重新加密 root 目录下的所有文件
+//
+// 与 Rekey 只重新包装数据密钥不同，这里会完整解密并重新加密文件内容，数据密钥和算法都会更换，
+// 适用于密钥可能已经泄露的情况。明文只在内存中以流的形式传递，不会写入磁盘。
+//
+// 每个文件替换前，原始的密文和元数据保存在日志旁的备份文件中，日志中记录开始和完成。
+// 中途崩溃后使用同一个日志再次执行：已完成的文件被跳过，未完成的文件先从备份恢复再重新处理，
+// 因此日志始终记录了哪些文件已经使用新密钥加密。journal 为 nil 时不记录进度。
+//
+// 单个文件失败不会中断处理，失败原因记录在返回结果中；日志写入等无法继续的错误直接返回
+func (u *Uploader) Reencrypt(ctx context.Context, root string, newEncryptor crypto.Encryptor, journal *Journal, opts ...Option) (*ReencryptReport, error) {
+	return u.reencrypt(ctx, root, newEncryptor, journal, nil, opts)
+}
+
+// Migrate 将 root 目录下使用不安全算法（如 XOR）加密的文件重新加密为 newEncryptor 的算法
+//
+// 处理方式和进度日志与 Reencrypt 相同，其他算法加密的文件保持不变。
+// 元数据中的密钥指纹或密钥大小与当前密钥不一致的文件记录为失败（ErrKeyMismatch），
+// 避免使用错误的密钥解密没有完整性保护的数据。
+func (u *Uploader) Migrate(ctx context.Context, root string, newEncryptor crypto.Encryptor, journal *Journal, opts ...Option) (*ReencryptReport, error) {
+	if algorithm := newEncryptor.GetMetadata()["algorithm"]; crypto.IsInsecure(algorithm) {
+		return nil, fmt.Errorf("%w: %s", ErrInsecureAlgorithm, algorithm)
+	}
+	return u.reencrypt(ctx, root, newEncryptor, journal, u.needsMigration, opts)
+}
+
+// needsMigration 检查文件是否使用不安全的算法加密，并且可以用当前密钥解密
+func (u *Uploader) needsMigration(stored map[string]string) (bool, error) {
+	if !crypto.IsInsecure(stored["algorithm"]) {
+		return false, nil
+	}
+	current := u.encryptor.GetMetadata()
+	for _, k := range []string{"key_fingerprint", "key_size"} {
+		if stored[k] != "" && current[k] != "" && stored[k] != current[k] {
+			return false, crypto.ErrKeyMismatch
+		}
+	}
+	return true, nil
+}
+
+// reencrypt 重新加密 root 目录下的文件，filter 不为 nil 时只处理它根据存储中的元数据选择的文件
+func (u *Uploader) reencrypt(ctx context.Context, root string, newEncryptor crypto.Encryptor, journal *Journal, filter func(stored map[string]string) (bool, error), opts []Option) (*ReencryptReport, error) {
+	target := NewUploader(newEncryptor, u.storage, opts...)
+	report := &ReencryptReport{Failed: make(map[string]error)}
+	if algorithm := newEncryptor.GetMetadata()["algorithm"]; crypto.IsInsecure(algorithm) && !target.insecure {
+		return report, fmt.Errorf("%w: %s", ErrInsecureAlgorithm, algorithm)
+	}
+
+	if journal != nil {
+		if err := journal.start(targetDescription(newEncryptor)); err != nil {
+			return report, err
+		}
+		if err := journal.restore(ctx, u, "interrupted, restored from backup"); err != nil {
+			return report, err
+		}
+	}
+
+	files, err := u.walk(ctx, root)
+	if err != nil {
+		return report, err
+	}
+
+	for _, remotePath := range files {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if journal != nil && journal.isDone(remotePath) {
+			report.Skipped = append(report.Skipped, remotePath)
+			continue
+		}
+		if filter != nil {
+			selected, err := u.selectFile(ctx, remotePath, filter)
+			if err != nil {
+				report.Failed[remotePath] = err
+				continue
+			}
+			if !selected {
+				continue
+			}
+		}
+
+		if err := u.reencryptFile(ctx, remotePath, target, journal); err != nil {
+			var fatal *journalError
+			if errors.As(err, &fatal) {
+				return report, err
+			}
+			report.Failed[remotePath] = err
+			if journal != nil {
+				if err := journal.restore(ctx, u, err.Error()); err != nil {
+					return report, err
+				}
+			}
+			continue
+		}
+		report.Reencrypted = append(report.Reencrypted, remotePath)
+	}
+
+	return report, nil
+}
+
+// walk 递归列出 root 下所有文件的明文路径（按路径排序）
+// 使用加密文件名时，无法解密的名称不属于当前密钥，直接跳过
+func (u *Uploader) walk(ctx context.Context, root string) ([]string, error) {
+	storageRoot, err := u.storagePath(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	var visit func(dir string) error
+	visit = func(dir string) error {
+		entries, err := u.storage.List(ctx, dir)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir {
+				if err := visit(entry.Path); err != nil {
+					return err
+				}
+				continue
+			}
+			if IsRepositoryFile(entry.Path) {
+				continue
+			}
+			remotePath := entry.Path
+			if u.names != nil {
+				if remotePath, err = u.names.DecryptPath(entry.Path); err != nil {
+					continue
+				}
+			}
+			files = append(files, canonicalPath(remotePath))
+		}
+		return nil
+	}
+	if err := visit(storageRoot); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// selectFile 读取存储中的元数据，由 filter 决定是否处理该文件
+func (u *Uploader) selectFile(ctx context.Context, remotePath string, filter func(map[string]string) (bool, error)) (bool, error) {
+	storagePath, err := u.storagePath(remotePath)
+	if err != nil {
+		return false, err
+	}
+	stored, err := u.storage.GetMetadata(ctx, storagePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	return filter(stored)
+}
+
+// reencryptFile 重新加密单个文件
+func (u *Uploader) reencryptFile(ctx context.Context, remotePath string, target *Uploader, journal *Journal) error {
+	storagePath, err := u.storagePath(remotePath)
+	if err != nil {
+		return err
+	}
+	newStoragePath, err := target.storagePath(remotePath)
+	if err != nil {
+		return err
+	}
+
+	// 读取明文元数据，同时检查旧密钥能否解密
+	metadata, err := u.GetFileInfo(ctx, remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to get metadata: %w", err)
+	}
+	stored, err := u.storage.GetMetadata(ctx, storagePath)
+	if err != nil {
+		return fmt.Errorf("failed to get metadata: %w", err)
+	}
+
+	// 保存原始密文：有日志时保存为备份，否则使用临时文件
+	var original *os.File
+	if journal != nil {
+		if original, err = journal.begin(ctx, u, remotePath, storagePath, stored); err != nil {
+			return err
+		}
+		defer original.Close()
+	} else {
+		tmp, err := writeTemp(func(w io.Writer) error {
+			return u.storage.Download(ctx, storagePath, w)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to download file: %w", err)
+		}
+		defer tmp.cleanup()
+		original = tmp.File
+	}
+
+	// 新的元数据：保留原始文件名等字段，替换加密相关的字段
+	newMetadata := target.encryptor.GetMetadata()
+	target.setKeyID(newMetadata)
+	for k, v := range metadata {
+		if !isCryptoMetadataField(k) {
+			newMetadata[k] = v
+		}
+	}
+
+	// 没有指定新的压缩算法和填充方案时，保持文件原来的设置
+	encryptor := target
+	if (target.compression == "" && metadata[compressionKey] != "") || (target.padding == "" && metadata[paddingKey] != "") {
+		inherited := *target
+		if inherited.compression == "" {
+			inherited.compression = metadata[compressionKey]
+		}
+		if inherited.padding == "" {
+			inherited.padding = metadata[paddingKey]
+		}
+		encryptor = &inherited
+	}
+	encryptor.dropOriginalSize(newMetadata)
+
+	// 解密的明文通过管道直接交给新的加密器
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(u.decrypt(ctx, remotePath, storagePath, original, pw))
+	}()
+	encryptedData, err := encryptor.encryptToTemp(pr, remotePath, newMetadata)
+	pr.Close()
+	if err != nil {
+		return fmt.Errorf("failed to reencrypt file: %w", err)
+	}
+	defer encryptedData.cleanup()
+
+	if err := target.encryptOriginalName(newMetadata); err != nil {
+		return err
+	}
+	newMetadata["encrypted_size"] = fmt.Sprintf("%d", encryptedData.size)
+	// 原来加密了元数据的文件保持加密
+	if _, sealed := stored[sealedMetadataKey]; sealed || target.sealMetadata {
+		if newMetadata, err = target.seal(remotePath, newMetadata); err != nil {
+			return err
+		}
+	}
+	if err := target.sign(newStoragePath, encryptedData, newMetadata); err != nil {
+		return err
+	}
+
+	if err := u.storage.Upload(ctx, newStoragePath, encryptedData.File, newMetadata); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	if newStoragePath != storagePath {
+		if err := u.storage.Delete(ctx, storagePath); err != nil {
+			return fmt.Errorf("failed to delete old file: %w", err)
+		}
+	}
+
+	if journal != nil {
+		return journal.finish(remotePath)
+	}
+	return nil
+}
+
+// isCryptoMetadataField 检查字段是否由加密器或上传器生成
+func isCryptoMetadataField(name string) bool {
+	for _, k := range cryptoMetadataFields {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
+
+// targetDescription 描述新的加密器，用于检查恢复时是否使用了同一个新密钥
+func targetDescription(encryptor crypto.Encryptor) string {
+	metadata := encryptor.GetMetadata()
+	var parts []string
+	for _, k := range []string{"algorithm", "key_fingerprint", "kdf", "recipients", "plugin"} {
+		if v := metadata[k]; v != "" {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// Journal 重新加密的进度日志
+//
+// 日志是追加写入的JSON行文件，每次写入后同步到磁盘。替换文件前，原始密文保存在
+// <日志>.backup，元数据记录在日志中；文件处理完成后删除备份
+type Journal struct {
+	path    string
+	file    *os.File
+	target  string          // 新加密器的描述
+	done    map[string]bool // 已完成的文件
+	pending *journalEntry   // 开始但未完成的文件
+}
+
+// journalEntry 日志中的一条记录
+type journalEntry struct {
+	Op          string            `json:"op"`                     // start|begin|done|fail
+	Path        string            `json:"path,omitempty"`         // 明文路径
+	StoragePath string            `json:"storage_path,omitempty"` // 存储中的路径
+	Metadata    map[string]string `json:"metadata,omitempty"`     // 原始元数据
+	Target      string            `json:"target,omitempty"`       // 新加密器的描述
+	Error       string            `json:"error,omitempty"`        // 失败原因
+}
+
+// journalError 日志读写失败，重新加密无法安全地继续
+type journalError struct {
+	err error
+}
+
+func (e *journalError) Error() string { return "journal: " + e.err.Error() }
+func (e *journalError) Unwrap() error { return e.err }
+
+// OpenJournal 打开或创建进度日志
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{
+		path: path,
+		done: make(map[string]bool),
+	}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var entry journalEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				// 最后一行可能因崩溃而不完整
+				continue
+			}
+			j.apply(&entry)
+		}
+		err := scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	j.file = file
+
+	// 崩溃时最后一行可能没有写完，新的记录从下一行开始
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			if _, err := file.Write([]byte{'\n'}); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("failed to write journal: %w", err)
+			}
+		}
+	}
+	return j, nil
+}
+
+// Close 关闭日志文件
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Done 返回日志中已完成的文件数量
+func (j *Journal) Done() int {
+	return len(j.done)
+}
+
+// apply 根据记录更新日志状态
+func (j *Journal) apply(entry *journalEntry) {
+	switch entry.Op {
+	case "start":
+		if j.target == "" {
+			j.target = entry.Target
+		}
+	case "begin":
+		j.pending = entry
+	case "done", "fail":
+		if entry.Op == "done" {
+			j.done[entry.Path] = true
+		}
+		if j.pending != nil && j.pending.Path == entry.Path {
+			j.pending = nil
+		}
+	}
+}
+
+// write 追加一条记录并同步到磁盘
+func (j *Journal) write(entry *journalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return &journalError{err}
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return &journalError{err}
+	}
+	if err := j.file.Sync(); err != nil {
+		return &journalError{err}
+	}
+	j.apply(entry)
+	return nil
+}
+
+// backupPath 原始密文备份文件的路径
+func (j *Journal) backupPath() string {
+	return j.path + ".backup"
+}
+
+// start 记录新加密器，已有日志使用了不同的新加密器时返回错误
+func (j *Journal) start(target string) error {
+	if j.target != "" {
+		if j.target != target {
+			return &journalError{fmt.Errorf("journal %s was created for a different target key (%s)", j.path, j.target)}
+		}
+		return nil
+	}
+	return j.write(&journalEntry{Op: "start", Target: target})
+}
+
+// isDone 检查文件是否已完成
+func (j *Journal) isDone(remotePath string) bool {
+	return j.done[remotePath]
+}
+
+// restore 将正在处理的文件从备份恢复为原始状态，并记录失败原因
+// 用于上次执行中断后的恢复，以及单个文件处理失败时撤销可能不完整的替换
+func (j *Journal) restore(ctx context.Context, u *Uploader, cause string) error {
+	if j.pending == nil {
+		return nil
+	}
+
+	backup, err := os.Open(j.backupPath())
+	if err != nil {
+		return &journalError{fmt.Errorf("backup of %s is missing: %w", j.pending.Path, err)}
+	}
+	defer backup.Close()
+
+	if err := u.storage.Upload(ctx, j.pending.StoragePath, backup, j.pending.Metadata); err != nil {
+		return &journalError{fmt.Errorf("failed to restore %s from backup: %w", j.pending.Path, err)}
+	}
+	return j.write(&journalEntry{Op: "fail", Path: j.pending.Path, Error: cause})
+}
+
+// begin 备份原始密文并记录开始处理，返回读取位置在开头的备份文件
+func (j *Journal) begin(ctx context.Context, u *Uploader, remotePath, storagePath string, metadata map[string]string) (*os.File, error) {
+	backup, err := os.OpenFile(j.backupPath(), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, &journalError{fmt.Errorf("failed to create backup: %w", err)}
+	}
+	if err := u.storage.Download(ctx, storagePath, backup); err != nil {
+		backup.Close()
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if err := backup.Sync(); err != nil {
+		backup.Close()
+		return nil, &journalError{fmt.Errorf("failed to write backup: %w", err)}
+	}
+	if _, err := backup.Seek(0, io.SeekStart); err != nil {
+		backup.Close()
+		return nil, &journalError{fmt.Errorf("failed to seek backup: %w", err)}
+	}
+
+	entry := &journalEntry{Op: "begin", Path: remotePath, StoragePath: storagePath, Metadata: metadata}
+	if err := j.write(entry); err != nil {
+		backup.Close()
+		return nil, err
+	}
+	return backup, nil
+}
+
+// finish 记录文件已完成并删除备份
+func (j *Journal) finish(remotePath string) error {
+	if err := j.write(&journalEntry{Op: "done", Path: remotePath}); err != nil {
+		return err
+	}
+	os.Remove(j.backupPath())
+	return nil
+}
@@ -0,0 +1,239 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/storage"
+)
+
+// errCrash 模拟进程在上传过程中退出
+var errCrash = errors.New("simulated crash")
+
+// failingStorage 上传 failPath 时只写入一半数据，然后返回错误或模拟崩溃
+type failingStorage struct {
+	storage.Storage
+	failPath string
+	crash    bool
+	failures int // 剩余的失败次数
+}
+
+func (s *failingStorage) Upload(ctx context.Context, remotePath string, data io.Reader, metadata map[string]string) error {
+	if remotePath != s.failPath || s.failures == 0 {
+		return s.Storage.Upload(ctx, remotePath, data, metadata)
+	}
+	s.failures--
+
+	buf, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	if err := s.Storage.Upload(ctx, remotePath, bytes.NewReader(buf[:len(buf)/2]), metadata); err != nil {
+		return err
+	}
+	if s.crash {
+		panic(errCrash)
+	}
+	return errors.New("connection reset")
+}
+
+// recordingStorage 记录上传的路径，并检查第一次上传的是否为原始密文
+type recordingStorage struct {
+	storage.Storage
+	uploads          []string
+	restoredOriginal bool
+}
+
+func (s *recordingStorage) Upload(ctx context.Context, remotePath string, data io.Reader, metadata map[string]string) error {
+	buf, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	if len(s.uploads) == 0 {
+		h, err := crypto.ReadHeader(bytes.NewReader(buf))
+		s.restoredOriginal = err == nil && h.Algorithm == crypto.AlgorithmAES && metadata["algorithm"] == h.Algorithm.String()
+	}
+	s.uploads = append(s.uploads, remotePath)
+	return s.Storage.Upload(ctx, remotePath, bytes.NewReader(buf), metadata)
+}
+
+// reencryptFixture 上传测试文件，返回存储、新旧加密器和各文件的明文
+func reencryptFixture(t *testing.T) (storage.Storage, crypto.Encryptor, crypto.Encryptor, map[string][]byte) {
+	t.Helper()
+	store := storage.NewMemStorage()
+	oldEnc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newEnc, err := crypto.NewChaCha20Encryptor(bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"/a.enc":     bytes.Repeat([]byte("a"), 1000),
+		"/b.enc":     bytes.Repeat([]byte("b"), 100000),
+		"/dir/c.enc": bytes.Repeat([]byte("c"), 10),
+	}
+	u := NewUploader(oldEnc, store)
+	for p, data := range files {
+		if err := u.UploadStream(context.Background(), bytes.NewReader(data), p, map[string]string{"original_name": filepath.Base(p)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store, oldEnc, newEnc, files
+}
+
+// checkDecrypts 检查文件能否用enc解密为原来的明文
+func checkDecrypts(t *testing.T, store storage.Storage, enc crypto.Encryptor, remotePath string, want []byte) {
+	t.Helper()
+	var out bytes.Buffer
+	if err := NewUploader(enc, store).DownloadStream(context.Background(), remotePath, &out); err != nil {
+		t.Errorf("%s: %v", remotePath, err)
+		return
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("%s: content mismatch", remotePath)
+	}
+}
+
+// reencryptUntilCrash 执行重新加密，返回模拟崩溃时的panic值
+func reencryptUntilCrash(u *Uploader, newEnc crypto.Encryptor, journal *Journal) (crashed interface{}) {
+	defer func() {
+		crashed = recover()
+	}()
+	u.Reencrypt(context.Background(), "/", newEnc, journal)
+	return nil
+}
+
+func TestReencryptResumesAfterCrash(t *testing.T) {
+	store, oldEnc, newEnc, files := reencryptFixture(t)
+	journalPath := filepath.Join(t.TempDir(), "reencrypt.journal")
+
+	// 第一次执行在上传 /b.enc 时崩溃，存储中留下一半的新密文
+	journal, err := OpenJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flaky := &failingStorage{Storage: store, failPath: "/b.enc", crash: true, failures: 1}
+	if crashed := reencryptUntilCrash(NewUploader(oldEnc, flaky), newEnc, journal); crashed != errCrash {
+		t.Fatalf("first run: got panic %v, want the simulated crash", crashed)
+	}
+	journal.Close()
+
+	if _, err := os.Stat(journalPath + ".backup"); err != nil {
+		t.Fatalf("backup of the interrupted file: %v", err)
+	}
+	if err := NewUploader(newEnc, store).DownloadStream(context.Background(), "/b.enc", io.Discard); err == nil {
+		t.Fatal("the half-written file decrypted")
+	}
+
+	// 重新打开日志：已完成的文件被跳过，中断的文件先从备份恢复
+	journal, err = OpenJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	if journal.Done() != 1 {
+		t.Errorf("journal records %d finished files, want 1", journal.Done())
+	}
+
+	restored := &recordingStorage{Storage: store}
+	report, err := NewUploader(oldEnc, restored).Reencrypt(context.Background(), "/", newEnc, journal)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if !slices.Equal(report.Skipped, []string{"/a.enc"}) {
+		t.Errorf("Skipped = %v, want [/a.enc]", report.Skipped)
+	}
+	if !slices.Equal(report.Reencrypted, []string{"/b.enc", "/dir/c.enc"}) {
+		t.Errorf("Reencrypted = %v, want [/b.enc /dir/c.enc]", report.Reencrypted)
+	}
+	if len(report.Failed) != 0 {
+		t.Errorf("Failed = %v", report.Failed)
+	}
+	if len(restored.uploads) == 0 || restored.uploads[0] != "/b.enc" || !restored.restoredOriginal {
+		t.Errorf("the interrupted file was not restored from the backup first (uploads %v)", restored.uploads)
+	}
+	if _, err := os.Stat(journalPath + ".backup"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("backup left behind: %v", err)
+	}
+
+	for p, data := range files {
+		checkDecrypts(t, store, newEnc, p, data)
+	}
+}
+
+func TestReencryptRestoresFailedFile(t *testing.T) {
+	store, oldEnc, newEnc, files := reencryptFixture(t)
+	journalPath := filepath.Join(t.TempDir(), "reencrypt.journal")
+	journal, err := OpenJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 上传 /b.enc 失败，只写入了一半：从备份恢复原文件，其他文件继续处理
+	flaky := &failingStorage{Storage: store, failPath: "/b.enc", failures: 1}
+	report, err := NewUploader(oldEnc, flaky).Reencrypt(context.Background(), "/", newEnc, journal)
+	if err != nil {
+		t.Fatalf("Reencrypt: %v", err)
+	}
+	if _, failed := report.Failed["/b.enc"]; !failed || len(report.Failed) != 1 {
+		t.Errorf("Failed = %v, want only /b.enc", report.Failed)
+	}
+	if !slices.Equal(report.Reencrypted, []string{"/a.enc", "/dir/c.enc"}) {
+		t.Errorf("Reencrypted = %v", report.Reencrypted)
+	}
+	checkDecrypts(t, store, oldEnc, "/b.enc", files["/b.enc"])
+	journal.Close()
+
+	// 修复后使用同一日志重试，只处理失败的文件
+	journal, err = OpenJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	report, err = NewUploader(oldEnc, store).Reencrypt(context.Background(), "/", newEnc, journal)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if !slices.Equal(report.Skipped, []string{"/a.enc", "/dir/c.enc"}) || !slices.Equal(report.Reencrypted, []string{"/b.enc"}) {
+		t.Errorf("retry: Skipped = %v, Reencrypted = %v", report.Skipped, report.Reencrypted)
+	}
+	for p, data := range files {
+		checkDecrypts(t, store, newEnc, p, data)
+	}
+}
+
+func TestJournalRejectsDifferentTarget(t *testing.T) {
+	store, oldEnc, newEnc, _ := reencryptFixture(t)
+	journalPath := filepath.Join(t.TempDir(), "reencrypt.journal")
+	journal, err := OpenJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewUploader(oldEnc, store).Reencrypt(context.Background(), "/", newEnc, journal); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	other, err := crypto.NewChaCha20Encryptor(bytes.Repeat([]byte{3}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, err = OpenJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	if _, err := NewUploader(newEnc, store).Reencrypt(context.Background(), "/", other, journal); err == nil {
+		t.Error("journal created for another key was reused")
+	}
+}
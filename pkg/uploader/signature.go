@@ -0,0 +1,178 @@
+package uploader
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/storage"
+)
+
+// 签名相关的元数据字段，在加密元数据之后写入，始终公开
+const (
+	contentHashKey = "content_sha256" // 存储中密文的 SHA-256
+	signerKey      = "signer"         // 签名公钥的指纹
+	signatureKey   = "signature"      // Ed25519 签名（base64）
+)
+
+// signatureMetadataFields 签名相关的元数据字段，文件重新加密或更换密钥后需要重新生成
+var signatureMetadataFields = []string{contentHashKey, signerKey, signatureKey}
+
+// ErrNotSigned 文件没有签名
+var ErrNotSigned = errors.New("file is not signed")
+
+// WithSigner 使用Ed25519私钥对上传的文件签名
+//
+// 签名覆盖存储路径、密文的 SHA-256 和存储中的全部元数据（加密元数据时为加密后的形式），
+// 保存在元数据的 signature 字段中。验证只需要公钥，不需要解密密钥，
+// 审计方可以确认文件由持有私钥的备份主机生成且没有被修改
+func WithSigner(key ed25519.PrivateKey) Option {
+	return func(u *Uploader) {
+		u.signer = key
+	}
+}
+
+// SignatureInfo 签名验证通过的文件信息
+type SignatureInfo struct {
+	Path        string // 存储路径
+	Signer      string // 签名公钥的指纹
+	ContentHash string // 密文的 SHA-256（16进制）
+}
+
+// VerifyReport 目录签名验证的结果
+type VerifyReport struct {
+	Verified []*SignatureInfo // 签名有效的文件
+	Failed   map[string]error // 没有签名或签名无效的文件及原因
+}
+
+// sign 设置了签名私钥时，计算密文的哈希并对元数据签名
+// data 的读写位置会重置到文件开头
+func (u *Uploader) sign(storagePath string, data *tempFile, metadata map[string]string) error {
+	for _, k := range signatureMetadataFields {
+		delete(metadata, k)
+	}
+	if u.signer == nil {
+		return nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, data); err != nil {
+		return fmt.Errorf("failed to hash encrypted data: %w", err)
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek temp file: %w", err)
+	}
+
+	metadata[contentHashKey] = hex.EncodeToString(hash.Sum(nil))
+	metadata[signerKey] = crypto.FingerprintString(u.signer.Public().(ed25519.PublicKey))
+	signature := ed25519.Sign(u.signer, signedMessage(storagePath, metadata))
+	metadata[signatureKey] = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// Verify 使用公钥验证存储中文件的签名，不需要解密密钥
+// storagePath 为文件在存储中的路径，使用加密文件名时即加密后的路径
+func Verify(ctx context.Context, store storage.Storage, storagePath string, publicKey ed25519.PublicKey) (*SignatureInfo, error) {
+	metadata, err := store.GetMetadata(ctx, storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+	encoded, ok := metadata[signatureKey]
+	if !ok {
+		return nil, ErrNotSigned
+	}
+	if signer := crypto.FingerprintString(publicKey); metadata[signerKey] != signer {
+		return nil, fmt.Errorf("%w: signed by %s, expected %s", crypto.ErrInvalidSignature, metadata[signerKey], signer)
+	}
+
+	// 先检查元数据的签名，再检查密文是否与签名的哈希一致
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", crypto.ErrInvalidSignature)
+	}
+	if !ed25519.Verify(publicKey, signedMessage(storagePath, metadata), signature) {
+		return nil, fmt.Errorf("%w: metadata or path has been modified", crypto.ErrInvalidSignature)
+	}
+
+	hash := sha256.New()
+	if err := store.Download(ctx, storagePath, hash); err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != metadata[contentHashKey] {
+		return nil, fmt.Errorf("%w: encrypted data has been modified", crypto.ErrInvalidSignature)
+	}
+
+	return &SignatureInfo{
+		Path:        storagePath,
+		Signer:      metadata[signerKey],
+		ContentHash: metadata[contentHashKey],
+	}, nil
+}
+
+// VerifyTree 验证 root 目录下所有文件的签名，返回的路径均为存储路径
+// 单个文件验证失败不会中断处理，失败原因记录在返回结果中
+func VerifyTree(ctx context.Context, store storage.Storage, root string, publicKey ed25519.PublicKey) (*VerifyReport, error) {
+	report := &VerifyReport{Failed: make(map[string]error)}
+
+	var visit func(dir string) error
+	visit = func(dir string) error {
+		entries, err := store.List(ctx, dir)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if entry.IsDir {
+				if err := visit(entry.Path); err != nil {
+					return err
+				}
+				continue
+			}
+			if IsRepositoryFile(entry.Path) {
+				continue
+			}
+			info, err := Verify(ctx, store, entry.Path, publicKey)
+			if err != nil {
+				report.Failed[canonicalPath(entry.Path)] = err
+				continue
+			}
+			info.Path = canonicalPath(info.Path)
+			report.Verified = append(report.Verified, info)
+		}
+		return nil
+	}
+	if err := visit(root); err != nil {
+		return report, err
+	}
+
+	sort.Slice(report.Verified, func(i, j int) bool {
+		return report.Verified[i].Path < report.Verified[j].Path
+	})
+	return report, nil
+}
+
+// signedMessage 构造签名的内容：存储路径和按名称排序的元数据（不含签名本身）
+func signedMessage(storagePath string, metadata map[string]string) []byte {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		if k != signatureKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	items := []string{"cryptobackup signature v1", canonicalPath(storagePath)}
+	for _, k := range keys {
+		items = append(items, k, metadata[k])
+	}
+	return encodeAAD(items)
+}
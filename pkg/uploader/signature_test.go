@@ -0,0 +1,166 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/storage"
+)
+
+// signedFixture 上传签名的文件，返回存储和签名公钥
+func signedFixture(t *testing.T, paths ...string) (storage.Storage, ed25519.PublicKey) {
+	t.Helper()
+	store := storage.NewMemStorage()
+	enc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{6}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	u := NewUploader(enc, store, WithSigner(signer))
+	for _, p := range paths {
+		meta := map[string]string{"original_name": "report.pdf"}
+		if err := u.UploadStream(context.Background(), bytes.NewReader(bytes.Repeat([]byte(p), 100)), p, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store, signer.Public().(ed25519.PublicKey)
+}
+
+// rewriteObject 修改存储中的密文和元数据后重新写入
+func rewriteObject(t *testing.T, store storage.Storage, storagePath string, modify func(data []byte, metadata map[string]string) []byte) {
+	t.Helper()
+	ctx := context.Background()
+	var data bytes.Buffer
+	if err := store.Download(ctx, storagePath, &data); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := store.GetMetadata(ctx, storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := modify(data.Bytes(), metadata)
+	if err := store.Upload(ctx, storagePath, bytes.NewReader(modified), metadata); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	store, public := signedFixture(t, "/docs/report.pdf.enc")
+
+	info, err := Verify(ctx, store, "/docs/report.pdf.enc", public)
+	if err != nil {
+		t.Fatalf("valid signature: %v", err)
+	}
+	if info.Signer != crypto.FingerprintString(public) || len(info.ContentHash) != 64 {
+		t.Errorf("SignatureInfo = %+v", info)
+	}
+
+	// 其他公钥
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize)).Public().(ed25519.PublicKey)
+	if _, err := Verify(ctx, store, "/docs/report.pdf.enc", other); !errors.Is(err, crypto.ErrInvalidSignature) {
+		t.Errorf("wrong public key: got %v, want ErrInvalidSignature", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(data []byte, metadata map[string]string) []byte
+	}{
+		{"ciphertext byte flipped", func(data []byte, _ map[string]string) []byte {
+			data[len(data)/2] ^= 1
+			return data
+		}},
+		{"ciphertext truncated", func(data []byte, _ map[string]string) []byte {
+			return data[:len(data)-1]
+		}},
+		{"original_name edited", func(data []byte, metadata map[string]string) []byte {
+			metadata["original_name"] = "invoice.pdf"
+			return data
+		}},
+		{"metadata field added", func(data []byte, metadata map[string]string) []byte {
+			metadata["note"] = "unsigned"
+			return data
+		}},
+		{"content hash replaced", func(data []byte, metadata map[string]string) []byte {
+			data[0] ^= 1
+			metadata[contentHashKey] = "00"
+			return data
+		}},
+		{"signature corrupted", func(data []byte, metadata map[string]string) []byte {
+			sig := []byte(metadata[signatureKey])
+			if sig[0] == 'A' {
+				sig[0] = 'B'
+			} else {
+				sig[0] = 'A'
+			}
+			metadata[signatureKey] = string(sig)
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		store, public := signedFixture(t, "/docs/report.pdf.enc")
+		rewriteObject(t, store, "/docs/report.pdf.enc", tt.modify)
+		if _, err := Verify(ctx, store, "/docs/report.pdf.enc", public); !errors.Is(err, crypto.ErrInvalidSignature) {
+			t.Errorf("%s: got %v, want ErrInvalidSignature", tt.name, err)
+		}
+	}
+
+	// 签名与存储路径绑定，移动后验证失败
+	copyObject(t, store, "/docs/report.pdf.enc", "/docs/other.pdf.enc", nil)
+	if _, err := Verify(ctx, store, "/docs/other.pdf.enc", public); !errors.Is(err, crypto.ErrInvalidSignature) {
+		t.Errorf("moved file: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyTree(t *testing.T) {
+	ctx := context.Background()
+	store, public := signedFixture(t, "/a.enc", "/dir/b.enc", "/dir/sub/c.enc")
+
+	// 没有签名的文件
+	if err := store.Upload(ctx, "/dir/unsigned.enc", bytes.NewReader([]byte("data")), map[string]string{"algorithm": "AES-256-GCM"}); err != nil {
+		t.Fatal(err)
+	}
+	// 签名后被修改的文件
+	rewriteObject(t, store, "/dir/sub/c.enc", func(data []byte, _ map[string]string) []byte {
+		data[len(data)-1] ^= 1
+		return data
+	})
+	// 仓库自身的文件不参与验证
+	if _, err := LoadNameSalt(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyTree(ctx, store, "/", public)
+	if err != nil {
+		t.Fatalf("VerifyTree: %v", err)
+	}
+	var verified []string
+	for _, info := range report.Verified {
+		verified = append(verified, info.Path)
+	}
+	if len(verified) != 2 || verified[0] != "/a.enc" || verified[1] != "/dir/b.enc" {
+		t.Errorf("Verified = %v, want [/a.enc /dir/b.enc]", verified)
+	}
+	if len(report.Failed) != 2 {
+		t.Errorf("Failed = %v, want the unsigned and the modified file", report.Failed)
+	}
+	if err := report.Failed["/dir/unsigned.enc"]; !errors.Is(err, ErrNotSigned) {
+		t.Errorf("unsigned file: got %v, want ErrNotSigned", err)
+	}
+	if err := report.Failed["/dir/sub/c.enc"]; !errors.Is(err, crypto.ErrInvalidSignature) {
+		t.Errorf("modified file: got %v, want ErrInvalidSignature", err)
+	}
+
+	// 只验证子目录
+	report, err = VerifyTree(ctx, store, "/dir/sub", public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Verified) != 0 || len(report.Failed) != 1 {
+		t.Errorf("subtree: Verified = %v, Failed = %v", report.Verified, report.Failed)
+	}
+}
@@ -1,12 +1,14 @@
 package uploader
 
 import (
-	"bytes"
 	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"cryptobackup/pkg/crypto"
@@ -17,14 +19,76 @@ import (
 type Uploader struct {
 	encryptor crypto.Encryptor
 	storage   storage.Storage
+	names     *crypto.NameCipher // 文件名加密器，nil 表示使用明文名称
+
+	sealMetadata bool   // 是否加密元数据
+	keyID        string // 写入元数据的密钥ID
+	insecure     bool   // 是否允许使用不安全的算法加密
+	compression  string // 加密前使用的压缩算法，为空时不压缩
+	padding      string // 加密前使用的填充方案，为空时不填充
+	hideSize     bool   // 是否不公开原始文件大小
+
+	signer ed25519.PrivateKey // 签名私钥，nil 表示不签名
+
+	meta *metadataKey // 元数据密钥，第一次使用时派生
+}
+
+// metadataKey 上传器的元数据加密器，只派生一次
+// 以指针保存，复制上传器（如继承压缩设置）时共用同一个密钥
+type metadataKey struct {
+	once   sync.Once
+	cipher *crypto.MetadataCipher // 加密器没有对称主密钥时为nil
+	err    error
+}
+
+// ErrInsecureAlgorithm 加密器使用不安全的算法且没有使用 WithInsecure 明确允许
+var ErrInsecureAlgorithm = errors.New("refusing to encrypt with an insecure algorithm")
+
+// Option 上传器选项
+type Option func(*Uploader)
+
+// WithEncryptedNames 使用加密后的名称保存文件
+// 远程路径的每一段都会确定性加密后再交给存储，元数据中的 original_name 同样加密；
+// 调用方仍然使用明文路径，ListFiles 返回解密后的路径
+func WithEncryptedNames(names *crypto.NameCipher) Option {
+	return func(u *Uploader) {
+		u.names = names
+	}
 }
 
+// WithKeyID 在元数据中记录加密使用的密钥ID（key_id）
+// 下载时可以根据它从密钥环中选择密钥
+func WithKeyID(id string) Option {
+	return func(u *Uploader) {
+		u.keyID = id
+	}
+}
+
+// WithInsecure 允许使用不安全的算法（如 XOR）加密新文件，仅用于测试或兼容旧系统
+func WithInsecure() Option {
+	return func(u *Uploader) {
+		u.insecure = true
+	}
+}
+
+// boundMetadataFields 与密文绑定的关键元数据字段
+// 加密器支持附加认证数据时，远程路径和这些字段会参与认证，被修改后解密失败
+var boundMetadataFields = []string{"original_name", "original_size"}
+
+// optionalBoundMetadataFields 描述数据如何处理的元数据字段，存在时同样与密文绑定
+var optionalBoundMetadataFields = []string{compressionKey, paddingKey}
+
 // NewUploader 创建上传器
-func NewUploader(encryptor crypto.Encryptor, storage storage.Storage) *Uploader {
-	return &Uploader{
+func NewUploader(encryptor crypto.Encryptor, storage storage.Storage, opts ...Option) *Uploader {
+	u := &Uploader{
 		encryptor: encryptor,
 		storage:   storage,
+		meta:      &metadataKey{},
 	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
 }
 
 // UploadFile 加密并上传文件
@@ -42,21 +106,43 @@ func (u *Uploader) UploadFile(ctx context.Context, localPath string, remotePath
 		return fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	// 加密文件
-	var encryptedData bytes.Buffer
-	if err := u.encryptor.Encrypt(file, &encryptedData); err != nil {
-		return fmt.Errorf("failed to encrypt file: %w", err)
+	storagePath, err := u.storagePath(remotePath)
+	if err != nil {
+		return err
 	}
 
 	// 准备元数据
 	metadata := u.encryptor.GetMetadata()
+	u.setKeyID(metadata)
 	metadata["original_name"] = filepath.Base(localPath)
 	metadata["original_size"] = fmt.Sprintf("%d", fileInfo.Size())
-	metadata["encrypted_size"] = fmt.Sprintf("%d", encryptedData.Len())
+	u.dropOriginalSize(metadata)
+
+	// 加密文件到临时文件，避免大文件占用内存
+	encryptedData, err := u.encryptToTemp(file, remotePath, metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt file: %w", err)
+	}
+	defer encryptedData.cleanup()
+
+	if err := u.encryptOriginalName(metadata); err != nil {
+		return err
+	}
+
+	metadata["encrypted_size"] = fmt.Sprintf("%d", encryptedData.size)
 	metadata["upload_time"] = time.Now().Format(time.RFC3339)
 
+	if u.sealMetadata {
+		if metadata, err = u.seal(remotePath, metadata); err != nil {
+			return err
+		}
+	}
+	if err := u.sign(storagePath, encryptedData, metadata); err != nil {
+		return err
+	}
+
 	// 上传到存储
-	if err := u.storage.Upload(ctx, remotePath, &encryptedData, metadata); err != nil {
+	if err := u.storage.Upload(ctx, storagePath, encryptedData.File, metadata); err != nil {
 		return fmt.Errorf("failed to upload file: %w", err)
 	}
 
@@ -65,17 +151,14 @@ func (u *Uploader) UploadFile(ctx context.Context, localPath string, remotePath
 
 // DownloadFile 下载并解密文件
 func (u *Uploader) DownloadFile(ctx context.Context, remotePath string, localPath string) error {
-	// 下载文件
-	var encryptedData bytes.Buffer
-	if err := u.storage.Download(ctx, remotePath, &encryptedData); err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
+	storagePath, err := u.storagePath(remotePath)
+	if err != nil {
+		return err
 	}
 
-	// 解密文件
-	var decryptedData bytes.Buffer
-	if err := u.encryptor.Decrypt(&encryptedData, &decryptedData); err != nil {
-		return fmt.Errorf("failed to decrypt file: %w", err)
-	}
+	// 以流的形式下载
+	encryptedData := u.openRemote(ctx, storagePath)
+	defer encryptedData.Close()
 
 	// 创建本地目录
 	dir := filepath.Dir(localPath)
@@ -83,8 +166,26 @@ func (u *Uploader) DownloadFile(ctx context.Context, remotePath string, localPat
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
+	// 先解密到同目录下的临时文件，成功后再重命名，避免失败时留下不完整的文件
+	tmp, err := os.CreateTemp(dir, ".cryptobackup-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := u.decrypt(ctx, remotePath, storagePath, encryptedData, tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to decrypt file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
 	// 保存到本地文件
-	if err := os.WriteFile(localPath, decryptedData.Bytes(), 0644); err != nil {
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -92,38 +193,108 @@ func (u *Uploader) DownloadFile(ctx context.Context, remotePath string, localPat
 }
 
 // ListFiles 列出远程文件
+// 使用加密文件名时返回解密后的路径，无法解密的名称（如未加密名称上传的文件）保持原样；
+// 加密的元数据会尽量解密，仓库自身使用的文件不会列出
 func (u *Uploader) ListFiles(ctx context.Context, remotePath string) ([]storage.FileInfo, error) {
-	return u.storage.List(ctx, remotePath)
+	storagePath, err := u.storagePath(remotePath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := u.storage.List(ctx, storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []storage.FileInfo
+	for _, entry := range entries {
+		if !IsRepositoryFile(entry.Path) {
+			files = append(files, entry)
+		}
+	}
+	for i := range files {
+		if u.names != nil {
+			if name, err := u.names.DecryptPath(files[i].Path); err == nil {
+				files[i].Path = name
+			}
+		}
+		// 加密的元数据无法解密（如使用了其他密钥）时保持原样
+		if files[i].Metadata != nil {
+			u.unseal(files[i].Path, files[i].Metadata)
+		}
+		u.decryptOriginalName(files[i].Metadata)
+	}
+	return files, nil
 }
 
 // DeleteFile 删除远程文件
 func (u *Uploader) DeleteFile(ctx context.Context, remotePath string) error {
-	return u.storage.Delete(ctx, remotePath)
+	storagePath, err := u.storagePath(remotePath)
+	if err != nil {
+		return err
+	}
+	return u.storage.Delete(ctx, storagePath)
 }
 
 // GetFileInfo 获取文件信息
+// 元数据已加密时使用上传器的加密器解密，密钥不正确时返回错误
 func (u *Uploader) GetFileInfo(ctx context.Context, remotePath string) (map[string]string, error) {
-	return u.storage.GetMetadata(ctx, remotePath)
+	storagePath, err := u.storagePath(remotePath)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := u.storage.GetMetadata(ctx, storagePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.unseal(remotePath, metadata); err != nil {
+		return nil, err
+	}
+	u.decryptOriginalName(metadata)
+	return metadata, nil
 }
 
 // UploadStream 加密并上传数据流
 func (u *Uploader) UploadStream(ctx context.Context, data io.Reader, remotePath string, metadata map[string]string) error {
-	// 加密数据流
-	var encryptedData bytes.Buffer
-	if err := u.encryptor.Encrypt(data, &encryptedData); err != nil {
-		return fmt.Errorf("failed to encrypt data: %w", err)
+	storagePath, err := u.storagePath(remotePath)
+	if err != nil {
+		return err
 	}
 
 	// 合并元数据
 	finalMetadata := u.encryptor.GetMetadata()
+	u.setKeyID(finalMetadata)
 	for k, v := range metadata {
 		finalMetadata[k] = v
 	}
-	finalMetadata["encrypted_size"] = fmt.Sprintf("%d", encryptedData.Len())
+	u.dropOriginalSize(finalMetadata)
+
+	// 加密数据流到临时文件
+	encryptedData, err := u.encryptToTemp(data, remotePath, finalMetadata)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt data: %w", err)
+	}
+	defer encryptedData.cleanup()
+
+	if err := u.encryptOriginalName(finalMetadata); err != nil {
+		return err
+	}
+
+	finalMetadata["encrypted_size"] = fmt.Sprintf("%d", encryptedData.size)
 	finalMetadata["upload_time"] = time.Now().Format(time.RFC3339)
 
+	if u.sealMetadata {
+		if finalMetadata, err = u.seal(remotePath, finalMetadata); err != nil {
+			return err
+		}
+	}
+	if err := u.sign(storagePath, encryptedData, finalMetadata); err != nil {
+		return err
+	}
+
 	// 上传到存储
-	if err := u.storage.Upload(ctx, remotePath, &encryptedData, finalMetadata); err != nil {
+	if err := u.storage.Upload(ctx, storagePath, encryptedData.File, finalMetadata); err != nil {
 		return fmt.Errorf("failed to upload data: %w", err)
 	}
 
@@ -132,16 +303,252 @@ func (u *Uploader) UploadStream(ctx context.Context, data io.Reader, remotePath
 
 // DownloadStream 下载并解密数据流
 func (u *Uploader) DownloadStream(ctx context.Context, remotePath string, dst io.Writer) error {
-	// 下载文件
-	var encryptedData bytes.Buffer
-	if err := u.storage.Download(ctx, remotePath, &encryptedData); err != nil {
-		return fmt.Errorf("failed to download data: %w", err)
+	storagePath, err := u.storagePath(remotePath)
+	if err != nil {
+		return err
 	}
 
+	// 以流的形式下载
+	encryptedData := u.openRemote(ctx, storagePath)
+	defer encryptedData.Close()
+
 	// 解密数据
-	if err := u.encryptor.Decrypt(&encryptedData, dst); err != nil {
+	if err := u.decrypt(ctx, remotePath, storagePath, encryptedData, dst); err != nil {
 		return fmt.Errorf("failed to decrypt data: %w", err)
 	}
 
 	return nil
 }
+
+// Rekey 使用新的主密钥重新包装远程文件的数据密钥
+// 只重写文件头部中的密钥字段，密文数据不会重新加密；元数据中的密钥指纹同步更新。
+// 上传器的加密器需要持有当前的主密钥，opts 为更换后使用的选项：
+// 文件名加密密钥由主密钥派生，使用加密文件名时需要通过 WithEncryptedNames 提供新的文件名加密器，
+// 文件会移动到新的加密名称下。原来的签名失效，需要保留签名时通过 WithSigner 重新签名
+func (u *Uploader) Rekey(ctx context.Context, remotePath string, newEncryptor crypto.Encryptor, opts ...Option) error {
+	target := NewUploader(newEncryptor, u.storage, opts...)
+	if u.names != nil && target.names == nil {
+		return fmt.Errorf("new name cipher is required to rekey files with encrypted names")
+	}
+
+	storagePath, err := u.storagePath(remotePath)
+	if err != nil {
+		return err
+	}
+	newStoragePath, err := target.storagePath(remotePath)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := u.storage.GetMetadata(ctx, storagePath)
+	if err != nil {
+		return fmt.Errorf("failed to get metadata: %w", err)
+	}
+	_, sealed := metadata[sealedMetadataKey]
+	if err := u.unseal(remotePath, metadata); err != nil {
+		return err
+	}
+
+	encryptedData := u.openRemote(ctx, storagePath)
+	defer encryptedData.Close()
+
+	// 先写入临时文件，完整读取旧文件后再覆盖
+	rekeyed, err := writeTemp(func(w io.Writer) error {
+		return crypto.Rekey(encryptedData, w, u.encryptor, newEncryptor)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rekey file: %w", err)
+	}
+	defer rekeyed.cleanup()
+
+	// 更新与主密钥相关的元数据
+	newMetadata := newEncryptor.GetMetadata()
+	for _, k := range []string{"key_fingerprint", "kdf"} {
+		delete(metadata, k)
+		if v, ok := newMetadata[k]; ok {
+			metadata[k] = v
+		}
+	}
+	metadata["encrypted_size"] = fmt.Sprintf("%d", rekeyed.size)
+	delete(metadata, "key_id")
+	target.setKeyID(metadata)
+	// 密文和元数据已经改变，原来的签名失效
+	for _, k := range signatureMetadataFields {
+		delete(metadata, k)
+	}
+
+	// 原始文件名使用新的文件名密钥重新加密
+	u.decryptOriginalName(metadata)
+	if err := target.encryptOriginalName(metadata); err != nil {
+		return err
+	}
+
+	// 加密的元数据使用新的主密钥重新加密
+	if sealed {
+		if metadata, err = target.seal(remotePath, metadata); err != nil {
+			return err
+		}
+	}
+	if err := target.sign(newStoragePath, rekeyed, metadata); err != nil {
+		return err
+	}
+
+	if err := u.storage.Upload(ctx, newStoragePath, rekeyed.File, metadata); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	// 加密名称改变时删除旧文件
+	if newStoragePath != storagePath {
+		if err := u.storage.Delete(ctx, storagePath); err != nil {
+			return fmt.Errorf("failed to delete old file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// setKeyID 设置了密钥ID时写入元数据
+func (u *Uploader) setKeyID(metadata map[string]string) {
+	if u.keyID != "" {
+		metadata["key_id"] = u.keyID
+	}
+}
+
+// storagePath 返回远程路径在存储中实际使用的路径
+func (u *Uploader) storagePath(remotePath string) (string, error) {
+	if u.names == nil {
+		return remotePath, nil
+	}
+	encrypted, err := u.names.EncryptPath(remotePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt remote path: %w", err)
+	}
+	return encrypted, nil
+}
+
+// encryptOriginalName 使用加密文件名时，加密元数据中的原始文件名
+func (u *Uploader) encryptOriginalName(metadata map[string]string) error {
+	name := metadata["original_name"]
+	if u.names == nil || name == "" {
+		return nil
+	}
+	encrypted, err := u.names.EncryptName(name)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt original name: %w", err)
+	}
+	metadata["original_name"] = encrypted
+	return nil
+}
+
+// decryptOriginalName 使用加密文件名时，解密元数据中的原始文件名
+func (u *Uploader) decryptOriginalName(metadata map[string]string) {
+	if u.names == nil || metadata["original_name"] == "" {
+		return
+	}
+	if name, err := u.names.DecryptName(metadata["original_name"]); err == nil {
+		metadata["original_name"] = name
+	}
+}
+
+// tempFile 保存加密结果的临时文件
+type tempFile struct {
+	*os.File
+	size int64 // 文件大小
+}
+
+// cleanup 关闭并删除临时文件
+func (t *tempFile) cleanup() {
+	t.Close()
+	os.Remove(t.Name())
+}
+
+// encryptToTemp 将数据压缩、填充（启用时）并加密写入临时文件，并将读写位置重置到文件开头
+// 加密器支持附加认证数据时，密文与远程路径和关键元数据绑定
+func (u *Uploader) encryptToTemp(src io.Reader, remotePath string, metadata map[string]string) (*tempFile, error) {
+	if algorithm := metadata["algorithm"]; crypto.IsInsecure(algorithm) && !u.insecure {
+		return nil, fmt.Errorf("%w: %s", ErrInsecureAlgorithm, algorithm)
+	}
+	compressed, err := u.compress(src, metadata)
+	if err != nil {
+		return nil, err
+	}
+	defer compressed.Close()
+	padded, err := u.pad(compressed, metadata)
+	if err != nil {
+		return nil, err
+	}
+	defer padded.Close()
+	src = padded
+
+	return writeTemp(func(w io.Writer) error {
+		if encryptor, ok := u.encryptor.(crypto.AADEncryptor); ok {
+			return encryptor.EncryptWithAAD(src, w, associatedData(remotePath, metadata))
+		}
+		return u.encryptor.Encrypt(src, w)
+	})
+}
+
+// decrypt 解密存储在storagePath的远程文件，上传时填充和压缩过的数据自动还原
+// 加密器支持附加认证数据时，使用远程路径和存储中的元数据校验文件是否被调换或篡改
+func (u *Uploader) decrypt(ctx context.Context, remotePath, storagePath string, src io.Reader, dst io.Writer) error {
+	metadata, err := u.storage.GetMetadata(ctx, storagePath)
+	if err != nil {
+		return fmt.Errorf("failed to get metadata: %w", err)
+	}
+	if err := u.unseal(remotePath, metadata); err != nil {
+		return err
+	}
+	u.decryptOriginalName(metadata)
+
+	// 没有头部的旧版本文件只能根据元数据判断算法
+	encryptor := u.encryptor
+	if auto, ok := encryptor.(*crypto.AutoDecryptor); ok {
+		encryptor = auto.WithLegacyAlgorithm(metadata["algorithm"])
+	}
+
+	decompressor, w := newDecompressWriter(dst, metadata[compressionKey])
+	unpadder, w := newUnpadWriter(w, metadata[paddingKey])
+	if decryptor, ok := encryptor.(crypto.AADEncryptor); ok {
+		err = decryptor.DecryptWithAAD(src, w, associatedData(remotePath, metadata))
+	} else {
+		err = encryptor.Decrypt(src, w)
+	}
+	return decompressor.finish(unpadder.finish(err))
+}
+
+// writeTemp 将write的输出写入临时文件，并将读写位置重置到文件开头
+func writeTemp(write func(w io.Writer) error) (*tempFile, error) {
+	file, err := os.CreateTemp("", "cryptobackup-*.enc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmp := &tempFile{File: file}
+
+	if err := write(tmp); err != nil {
+		tmp.cleanup()
+		return nil, err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		tmp.cleanup()
+		return nil, fmt.Errorf("failed to seek temp file: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.cleanup()
+		return nil, fmt.Errorf("failed to seek temp file: %w", err)
+	}
+	tmp.size = size
+
+	return tmp, nil
+}
+
+// openRemote 以流的形式读取远程文件
+// 下载在后台进行，调用方读取完成或出错后必须关闭返回的读取器
+func (u *Uploader) openRemote(ctx context.Context, remotePath string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(u.storage.Download(ctx, remotePath, pw))
+	}()
+	return pr
+}
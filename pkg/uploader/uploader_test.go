@@ -0,0 +1,277 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/storage"
+)
+
+func TestDownloadLegacyXORWithAuto(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("0123456789abcdef")
+	plaintext := []byte("pre-header XOR backup")
+
+	// 旧版本上传的文件：没有头部，元数据只记录算法和密钥长度
+	ciphertext := make([]byte, len(plaintext))
+	for i := range plaintext {
+		ciphertext[i] = plaintext[i] ^ key[i%len(key)]
+	}
+	metadata := map[string]string{"algorithm": "XOR", "key_size": "16"}
+	if err := store.Upload(ctx, "/old.enc", bytes.NewReader(ciphertext), metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	auto, err := crypto.NewAutoDecryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := NewUploader(auto, store).DownloadStream(ctx, "/old.enc", &out); err != nil {
+		t.Fatalf("DownloadStream: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), plaintext) {
+		t.Errorf("got %q, want %q", out.Bytes(), plaintext)
+	}
+}
+
+// payloadAfterHeader 返回存储中文件头部之后的密文
+func payloadAfterHeader(t *testing.T, store storage.Storage, storagePath string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := store.Download(context.Background(), storagePath, &buf); err != nil {
+		t.Fatal(err)
+	}
+	h, err := crypto.ReadHeader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()[len(h.Bytes()):]
+}
+
+func TestRekeyKeepsPayload(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemStorage()
+	oldEnc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newEnc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := bytes.Repeat([]byte("rekey me "), 10000)
+	meta := map[string]string{"original_name": "data.bin"}
+	if err := NewUploader(oldEnc, store).UploadStream(ctx, bytes.NewReader(plaintext), "/data.bin.enc", meta); err != nil {
+		t.Fatal(err)
+	}
+	before := payloadAfterHeader(t, store, "/data.bin.enc")
+
+	if err := NewUploader(oldEnc, store).Rekey(ctx, "/data.bin.enc", newEnc); err != nil {
+		t.Fatalf("Rekey: %v", err)
+	}
+	if after := payloadAfterHeader(t, store, "/data.bin.enc"); !bytes.Equal(before, after) {
+		t.Error("Rekey rewrote the encrypted payload")
+	}
+
+	stored, err := store.GetMetadata(ctx, "/data.bin.enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored["key_fingerprint"] != newEnc.GetMetadata()["key_fingerprint"] {
+		t.Errorf("key_fingerprint = %q, want the new key's fingerprint", stored["key_fingerprint"])
+	}
+
+	var out bytes.Buffer
+	if err := NewUploader(newEnc, store).DownloadStream(ctx, "/data.bin.enc", &out); err != nil {
+		t.Fatalf("download with new key: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), plaintext) {
+		t.Error("round trip mismatch after rekey")
+	}
+	out.Reset()
+	if err := NewUploader(oldEnc, store).DownloadStream(ctx, "/data.bin.enc", &out); !errors.Is(err, crypto.ErrKeyMismatch) {
+		t.Errorf("download with old key: got %v, want ErrKeyMismatch", err)
+	}
+}
+
+// copyObject 将存储中的文件和修改后的元数据复制到dst
+func copyObject(t *testing.T, store storage.Storage, src, dst string, modify func(map[string]string)) {
+	t.Helper()
+	ctx := context.Background()
+	var data bytes.Buffer
+	if err := store.Download(ctx, src, &data); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.GetMetadata(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := make(map[string]string)
+	for k, v := range stored {
+		metadata[k] = v
+	}
+	if modify != nil {
+		modify(metadata)
+	}
+	if err := store.Upload(ctx, dst, &data, metadata); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAssociatedDataBindsPathAndMetadata(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemStorage()
+	enc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{5}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := NewUploader(enc, store, WithPadding("pow2"))
+
+	plaintext := []byte("quarterly numbers")
+	meta := map[string]string{"original_name": "q3.xlsx", "original_size": "17"}
+	if err := u.UploadStream(ctx, bytes.NewReader(plaintext), "/finance/q3.xlsx.enc", meta); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := u.DownloadStream(ctx, "/finance/q3.xlsx.enc", &out); err != nil {
+		t.Fatalf("untouched file: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), plaintext) {
+		t.Fatalf("untouched file: got %q, want %q", out.Bytes(), plaintext)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		modify func(map[string]string)
+	}{
+		{"moved to another path", "/finance/q4.xlsx.enc", nil},
+		{"moved to another directory", "/public/q3.xlsx.enc", nil},
+		{"original_name changed", "/finance/renamed.enc", func(m map[string]string) { m["original_name"] = "q4.xlsx" }},
+		{"original_name removed", "/finance/unnamed.enc", func(m map[string]string) { delete(m, "original_name") }},
+		{"original_size changed", "/finance/resized.enc", func(m map[string]string) { m["original_size"] = "16" }},
+		{"padding removed", "/finance/unpadded.enc", func(m map[string]string) { delete(m, paddingKey) }},
+	}
+	for _, tt := range tests {
+		copyObject(t, store, "/finance/q3.xlsx.enc", tt.path, tt.modify)
+		out.Reset()
+		err := u.DownloadStream(ctx, tt.path, &out)
+		if err == nil {
+			t.Errorf("%s: download succeeded", tt.name)
+		}
+		if out.Len() != 0 {
+			t.Errorf("%s: wrote %d bytes before failing", tt.name, out.Len())
+		}
+	}
+
+	// 在原路径上修改元数据同样被拒绝
+	copyObject(t, store, "/finance/q3.xlsx.enc", "/finance/q3.xlsx.enc", func(m map[string]string) { m["original_size"] = "1" })
+	if err := u.DownloadStream(ctx, "/finance/q3.xlsx.enc", io.Discard); err == nil {
+		t.Error("metadata edited in place was accepted")
+	}
+}
+
+func TestLoadNameSalt(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt, err := LoadNameSalt(ctx, store)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if len(salt) != crypto.NameSaltSize || bytes.Equal(salt, make([]byte, crypto.NameSaltSize)) {
+		t.Fatalf("generated salt %x", salt)
+	}
+	again, err := LoadNameSalt(ctx, store)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !bytes.Equal(salt, again) {
+		t.Error("the stored salt was replaced")
+	}
+
+	// 其他仓库生成不同的盐
+	other, err := LoadNameSalt(ctx, storage.NewMemStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(salt, other) {
+		t.Error("two repositories got the same salt")
+	}
+
+	// 盐文件不出现在文件列表中
+	enc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{3}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := NewUploader(enc, store).ListFiles(ctx, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("ListFiles returned %+v", files)
+	}
+
+	if err := store.Upload(ctx, NameSaltPath, bytes.NewReader([]byte("short")), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadNameSalt(ctx, store); err == nil {
+		t.Error("a truncated salt was accepted")
+	}
+}
+
+func TestDeleteFileWithEncryptedNames(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemStorage()
+	enc, err := crypto.NewAESEncryptor(bytes.Repeat([]byte{4}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := crypto.NewNameCipher(bytes.Repeat([]byte{4}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := NewUploader(enc, store, WithEncryptedNames(names))
+
+	for _, p := range []string{"/payroll/q3.xlsx.enc", "/payroll/q4.xlsx.enc"} {
+		if err := u.UploadStream(ctx, bytes.NewReader([]byte(p)), p, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	storagePath, err := names.EncryptPath("/payroll/q3.xlsx.enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := store.Exists(ctx, "/payroll/q3.xlsx.enc"); exists {
+		t.Fatal("file was stored under its plaintext name")
+	}
+
+	// 明文路径映射为存储中的加密名后删除，其他文件不受影响
+	if err := u.DeleteFile(ctx, "/payroll/q3.xlsx.enc"); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	if exists, _ := store.Exists(ctx, storagePath); exists {
+		t.Error("encrypted file still exists after delete")
+	}
+	files, err := u.ListFiles(ctx, "/payroll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "/payroll/q4.xlsx.enc" {
+		t.Errorf("remaining files: %+v", files)
+	}
+}
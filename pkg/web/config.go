@@ -8,7 +8,7 @@ import (
 type ServerConfig struct {
 	Host        string           // Server host (default: 0.0.0.0)
 	Port        int              // Server port (default: 8080)
-	StoragePath string           // Path to storage directory
+	StoragePath string           // Storage path or URL, opened with storage.Open when Storage is nil
 	Username    string           // Login username
 	PasswordHash string          // Hashed login password
 	Storage     storage.Storage  // Storage instance
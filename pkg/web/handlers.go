@@ -5,8 +5,11 @@ import (
 	"context"
 	"crypto/rand"
 	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/keyring"
+	"cryptobackup/pkg/storage"
 	"cryptobackup/pkg/uploader"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
@@ -67,9 +70,23 @@ func (h *Handler) Logout(c *gin.Context) {
 }
 
 // Dashboard displays the file list dashboard
+// When a key is supplied, encrypted file names are shown decrypted
 func (h *Handler) Dashboard(c *gin.Context) {
 	ctx := context.Background()
 
+	var names *crypto.NameCipher
+	if key := c.Query("key"); key != "" {
+		var err error
+		names, err = createNameCipher(h.Config.Storage, c.Query("key_type"), key)
+		if err != nil {
+			c.HTML(http.StatusOK, "dashboard.html", gin.H{
+				"Error": fmt.Sprintf("Invalid key: %v", err),
+				"Files": []interface{}{},
+			})
+			return
+		}
+	}
+
 	// List all files
 	files, err := h.Config.Storage.List(ctx, "/")
 	if err != nil {
@@ -83,20 +100,29 @@ func (h *Handler) Dashboard(c *gin.Context) {
 	// Filter out directories and format file list
 	var fileList []gin.H
 	for _, file := range files {
-		if !file.IsDir {
+		if !file.IsDir && !uploader.IsRepositoryFile(file.Path) {
+			name := filepath.Base(file.Path)
+			storedName := ""
+			if names != nil {
+				if plain, err := names.DecryptName(name); err == nil {
+					name, storedName = plain, name
+				}
+			}
 			fileList = append(fileList, gin.H{
-				"Path":     file.Path,
-				"Name":     filepath.Base(file.Path),
-				"Size":     formatSize(file.Size),
-				"ModTime":  file.ModTime,
-				"Metadata": file.Metadata,
+				"Path":       file.Path,
+				"Name":       name,
+				"StoredName": storedName,
+				"Size":       formatSize(file.Size),
+				"ModTime":    file.ModTime,
+				"Metadata":   file.Metadata,
 			})
 		}
 	}
 
 	c.HTML(http.StatusOK, "dashboard.html", gin.H{
-		"Files":   fileList,
-		"Success": c.Query("success"),
+		"Files":       fileList,
+		"Success":     c.Query("success"),
+		"NameKeyType": c.Query("key_type"),
 	})
 }
 
@@ -118,11 +144,24 @@ func (h *Handler) UploadPost(c *gin.Context) {
 
 	remotePath := c.PostForm("remote_path")
 	algorithm := c.PostForm("algorithm")
+	keyType := c.PostForm("key_type")
 	keyHex := c.PostForm("key")
 
+	encryptNames := c.PostForm("encrypt_names") != ""
+	sealMetadata := c.PostForm("seal_metadata") != ""
+	insecure := c.PostForm("insecure") != ""
+	compression := c.PostForm("compression")
+	hideSize := c.PostForm("hide_size") != ""
+
 	if remotePath == "" {
 		remotePath = "/" + file.Filename
 	}
+	if _, err := storage.CleanPath(remotePath); err != nil {
+		c.HTML(http.StatusBadRequest, "upload.html", gin.H{
+			"Error": fmt.Sprintf("Invalid remote path: %v", err),
+		})
+		return
+	}
 
 	// Validate inputs
 	if keyHex == "" {
@@ -133,7 +172,7 @@ func (h *Handler) UploadPost(c *gin.Context) {
 	}
 
 	// Create encryptor
-	encryptor, err := createEncryptor(algorithm, keyHex)
+	encryptor, err := createKeyedEncryptor(algorithm, keyType, keyHex)
 	if err != nil {
 		c.HTML(http.StatusOK, "upload.html", gin.H{
 			"Error": fmt.Sprintf("Failed to create encryptor: %v", err),
@@ -152,17 +191,36 @@ func (h *Handler) UploadPost(c *gin.Context) {
 	defer src.Close()
 
 	// Create uploader
-	ul := uploader.NewUploader(encryptor, h.Config.Storage)
-
-	// Read file to buffer
-	var buf bytes.Buffer
-	_, err = buf.ReadFrom(src)
-	if err != nil {
-		c.HTML(http.StatusOK, "upload.html", gin.H{
-			"Error": fmt.Sprintf("Failed to read file: %v", err),
-		})
-		return
+	var opts []uploader.Option
+	if encryptNames {
+		names, err := createNameCipher(h.Config.Storage, keyType, keyHex)
+		if err != nil {
+			c.HTML(http.StatusOK, "upload.html", gin.H{
+				"Error": fmt.Sprintf("Cannot encrypt file names: %v", err),
+			})
+			return
+		}
+		opts = append(opts, uploader.WithEncryptedNames(names))
+	}
+	if sealMetadata {
+		opts = append(opts, uploader.WithSealedMetadata())
+	}
+	if insecure {
+		opts = append(opts, uploader.WithInsecure())
 	}
+	if compression != "" {
+		if _, err := uploader.ParseCompression(compression); err != nil {
+			c.HTML(http.StatusOK, "upload.html", gin.H{
+				"Error": fmt.Sprintf("Invalid compression: %v", err),
+			})
+			return
+		}
+		opts = append(opts, uploader.WithCompression(compression))
+	}
+	if hideSize {
+		opts = append(opts, uploader.WithPadding(uploader.PaddingPadme), uploader.WithoutOriginalSize())
+	}
+	ul := uploader.NewUploader(encryptor, h.Config.Storage, opts...)
 
 	// Upload file
 	ctx := context.Background()
@@ -170,7 +228,19 @@ func (h *Handler) UploadPost(c *gin.Context) {
 		"original_name": file.Filename,
 		"original_size": fmt.Sprintf("%d", file.Size),
 	}
-	err = ul.UploadStream(ctx, &buf, remotePath, metadata)
+	err = ul.UploadStream(ctx, src, remotePath, metadata)
+	if errors.Is(err, storage.ErrInvalidPath) {
+		c.HTML(http.StatusBadRequest, "upload.html", gin.H{
+			"Error": fmt.Sprintf("Invalid remote path: %v", err),
+		})
+		return
+	}
+	if errors.Is(err, uploader.ErrInsecureAlgorithm) {
+		c.HTML(http.StatusOK, "upload.html", gin.H{
+			"Error": "XOR has no integrity protection and leaks data when a key is reused; choose AES or ChaCha, or explicitly allow insecure algorithms",
+		})
+		return
+	}
 	if err != nil {
 		c.HTML(http.StatusOK, "upload.html", gin.H{
 			"Error": fmt.Sprintf("Failed to upload file: %v", err),
@@ -192,6 +262,7 @@ func (h *Handler) Download(c *gin.Context) {
 
 	// Get encryption key from form
 	keyHex := c.Query("key")
+	keyType := c.Query("key_type")
 	algorithm := c.Query("algorithm")
 
 	if keyHex == "" {
@@ -200,39 +271,97 @@ func (h *Handler) Download(c *gin.Context) {
 	}
 
 	// Create encryptor
-	encryptor, err := createEncryptor(algorithm, keyHex)
+	encryptor, err := createKeyedEncryptor(algorithm, keyType, keyHex)
 	if err != nil {
-		c.String(http.StatusBadRequest, "Invalid encryption algorithm")
+		c.String(http.StatusBadRequest, "Invalid encryption algorithm or key")
 		return
 	}
 
+	// Files stored under encrypted names are addressed by their plaintext path
+	var opts []uploader.Option
+	remotePath := path
+	if names, err := createNameCipher(h.Config.Storage, keyType, keyHex); err == nil {
+		if plain, err := names.DecryptPath(path); err == nil {
+			opts = append(opts, uploader.WithEncryptedNames(names))
+			remotePath = plain
+		}
+	}
+
 	// Create uploader
-	ul := uploader.NewUploader(encryptor, h.Config.Storage)
+	ul := uploader.NewUploader(encryptor, h.Config.Storage, opts...)
 
-	// Download and decrypt file
-	ctx := context.Background()
-	var buf bytes.Buffer
-	err = ul.DownloadStream(ctx, path, &buf)
+	// Get original filename from metadata; headers must be set before streaming starts
+	ctx := c.Request.Context()
+	metadata, _ := ul.GetFileInfo(ctx, remotePath)
+	filename := metadata["original_name"]
+	if filename == "" {
+		filename = filepath.Base(remotePath)
+		// Remove .enc extension if present
+		filename = strings.TrimSuffix(filename, ".enc")
+	}
+
+	// Decrypt straight into the response instead of buffering the whole file
+	w := &downloadWriter{c: c, filename: filename}
+	err = ul.DownloadStream(ctx, remotePath, w)
+	if err != nil && w.started {
+		// Part of the file was already sent, so the status can no longer change.
+		// Break the connection so the browser reports a failed download instead of saving a short file
+		abortResponse(c)
+		return
+	}
+	if errors.Is(err, crypto.ErrKeyMismatch) {
+		c.String(http.StatusBadRequest, "Wrong decryption key for this file")
+		return
+	}
+	if errors.Is(err, storage.ErrInvalidPath) {
+		c.String(http.StatusBadRequest, "Invalid file path: %v", err)
+		return
+	}
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to download file: %v", err)
 		return
 	}
+	w.start() // empty files never call Write
+}
 
-	// Get original filename from metadata
-	metadata, _ := h.Config.Storage.GetMetadata(ctx, path)
-	filename := metadata["original_name"]
-	if filename == "" {
-		filename = filepath.Base(path)
-		// Remove .enc extension if present
-		filename = strings.TrimSuffix(filename, ".enc")
+// downloadWriter writes the download headers before the first byte of plaintext,
+// so errors found before any output still get a proper status code
+type downloadWriter struct {
+	c        *gin.Context
+	filename string
+	started  bool
+}
+
+// start sends the response headers once
+func (w *downloadWriter) start() {
+	if w.started {
+		return
 	}
+	w.started = true
+	w.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", w.filename))
+	w.c.Header("Content-Type", "application/octet-stream")
+	w.c.Status(http.StatusOK)
+	w.c.Writer.WriteHeaderNow()
+}
 
-	// Send file to browser
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	c.Data(http.StatusOK, "application/octet-stream", buf.Bytes())
+// Write implements io.Writer
+func (w *downloadWriter) Write(p []byte) (int, error) {
+	w.start()
+	return w.c.Writer.Write(p)
+}
+
+// abortResponse closes the client connection in the middle of a response
+func abortResponse(c *gin.Context) {
+	c.Abort()
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		return
+	}
+	conn.Close()
 }
 
 // Delete handles file deletion
+// When a key is supplied, plaintext paths are mapped to their encrypted names
 func (h *Handler) Delete(c *gin.Context) {
 	path := c.Param("path")
 	if path == "" {
@@ -240,8 +369,29 @@ func (h *Handler) Delete(c *gin.Context) {
 		return
 	}
 
+	// With a key, the path is a plaintext path of a file stored under an
+	// encrypted name; paths that are already encrypted are used as they are
+	remotePath := path
+	if key := c.PostForm("key"); key != "" {
+		names, err := createNameCipher(h.Config.Storage, c.PostForm("key_type"), key)
+		if err != nil {
+			c.String(http.StatusBadRequest, "Invalid key: %v", err)
+			return
+		}
+		if _, err := names.DecryptPath(path); err != nil {
+			if remotePath, err = names.EncryptPath(path); err != nil {
+				c.String(http.StatusBadRequest, "Invalid file path: %v", err)
+				return
+			}
+		}
+	}
+
 	ctx := context.Background()
-	err := h.Config.Storage.Delete(ctx, path)
+	err := h.Config.Storage.Delete(ctx, remotePath)
+	if errors.Is(err, storage.ErrInvalidPath) {
+		c.String(http.StatusBadRequest, "Invalid file path: %v", err)
+		return
+	}
 	if err != nil {
 		c.Redirect(http.StatusFound, fmt.Sprintf("/?error=Failed to delete file: %v", err))
 		return
@@ -251,6 +401,7 @@ func (h *Handler) Delete(c *gin.Context) {
 }
 
 // Info displays file information
+// When a key is supplied, sealed metadata is decrypted and shown
 func (h *Handler) Info(c *gin.Context) {
 	path := c.Param("path")
 	if path == "" {
@@ -259,17 +410,71 @@ func (h *Handler) Info(c *gin.Context) {
 	}
 
 	ctx := context.Background()
-	metadata, err := h.Config.Storage.GetMetadata(ctx, path)
+	key := c.Query("key")
+	keyType := c.Query("key_type")
+	if key == "" {
+		metadata, err := h.Config.Storage.GetMetadata(ctx, path)
+		if errors.Is(err, storage.ErrInvalidPath) {
+			c.HTML(http.StatusBadRequest, "info.html", gin.H{
+				"Error": fmt.Sprintf("Invalid file path: %v", err),
+			})
+			return
+		}
+		if err != nil {
+			c.HTML(http.StatusOK, "info.html", gin.H{
+				"Error": fmt.Sprintf("Failed to get file info: %v", err),
+			})
+			return
+		}
+
+		_, sealed := metadata["sealed"]
+		delete(metadata, "sealed")
+		c.HTML(http.StatusOK, "info.html", gin.H{
+			"Path":     path,
+			"Name":     filepath.Base(path),
+			"Metadata": metadata,
+			"Sealed":   sealed,
+		})
+		return
+	}
+
+	// The algorithm is detected from the file header
+	encryptor, err := createKeyedEncryptor("auto", keyType, key)
+	if err != nil {
+		c.HTML(http.StatusOK, "info.html", gin.H{
+			"Error": fmt.Sprintf("Failed to create decryptor: %v", err),
+		})
+		return
+	}
+
+	// Files stored under encrypted names are addressed by their plaintext path
+	var opts []uploader.Option
+	remotePath := path
+	if names, err := createNameCipher(h.Config.Storage, keyType, key); err == nil {
+		if plain, err := names.DecryptPath(path); err == nil {
+			opts = append(opts, uploader.WithEncryptedNames(names))
+			remotePath = plain
+		}
+	}
+
+	ul := uploader.NewUploader(encryptor, h.Config.Storage, opts...)
+	metadata, err := ul.GetFileInfo(ctx, remotePath)
+	if errors.Is(err, storage.ErrInvalidPath) {
+		c.HTML(http.StatusBadRequest, "info.html", gin.H{
+			"Error": fmt.Sprintf("Invalid file path: %v", err),
+		})
+		return
+	}
 	if err != nil {
 		c.HTML(http.StatusOK, "info.html", gin.H{
-			"Error": fmt.Sprintf("Failed to get file info: %v", err),
+			"Error": fmt.Sprintf("Failed to decrypt file info: %v", err),
 		})
 		return
 	}
 
 	c.HTML(http.StatusOK, "info.html", gin.H{
 		"Path":     path,
-		"Name":     filepath.Base(path),
+		"Name":     filepath.Base(remotePath),
 		"Metadata": metadata,
 	})
 }
@@ -279,8 +484,17 @@ func (h *Handler) GenKeyPage(c *gin.Context) {
 	c.HTML(http.StatusOK, "genkey.html", gin.H{})
 }
 
-// GenKeyPost handles key generation
+// GenKeyPost handles key generation and restoring a key from its mnemonic
 func (h *Handler) GenKeyPost(c *gin.Context) {
+	if mnemonic := c.PostForm("mnemonic"); mnemonic != "" {
+		h.restoreKey(c, mnemonic)
+		return
+	}
+	if c.PostForm("type") == "x25519" {
+		h.genKeyPair(c)
+		return
+	}
+
 	sizeStr := c.PostForm("size")
 	var size int
 	fmt.Sscanf(sizeStr, "%d", &size)
@@ -304,9 +518,75 @@ func (h *Handler) GenKeyPost(c *gin.Context) {
 
 	keyHex := hex.EncodeToString(key)
 
+	// Sizes that are not a multiple of 4 bytes have no mnemonic
+	mnemonic, _ := crypto.EncodeMnemonic(key)
+	c.HTML(http.StatusOK, "genkey.html", gin.H{
+		"GeneratedKey":   keyHex,
+		"Size":           size,
+		"Mnemonic":       mnemonic,
+		"KeyFingerprint": crypto.FingerprintString(key),
+	})
+}
+
+// restoreKey decodes a key written down as a mnemonic
+func (h *Handler) restoreKey(c *gin.Context, mnemonic string) {
+	key, err := crypto.DecodeMnemonic(mnemonic)
+	if err != nil {
+		c.HTML(http.StatusOK, "genkey.html", gin.H{
+			"Error": fmt.Sprintf("Invalid mnemonic: %v", err),
+		})
+		return
+	}
+
 	c.HTML(http.StatusOK, "genkey.html", gin.H{
-		"GeneratedKey": keyHex,
-		"Size":         size,
+		"GeneratedKey":   hex.EncodeToString(key),
+		"Size":           len(key),
+		"Restored":       true,
+		"KeyFingerprint": crypto.FingerprintString(key),
+	})
+}
+
+// GenKeySheet renders a printable recovery sheet for a key
+func (h *Handler) GenKeySheet(c *gin.Context) {
+	key, err := keyring.NewKey("", c.PostForm("type"), c.PostForm("key"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid key: %v", err)
+		return
+	}
+	sheet := keyring.NewRecoverySheet(key)
+
+	// The sheet contains the key, keep it out of caches
+	c.Header("Cache-Control", "no-store")
+	if c.PostForm("format") == "text" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=cryptobackup-recovery-%s.txt", key.ID))
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(sheet.Text()))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := sheet.WriteHTML(&buf); err != nil {
+		c.String(http.StatusInternalServerError, "Failed to render recovery sheet: %v", err)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// genKeyPair generates an X25519 key pair for public-key encryption
+func (h *Handler) genKeyPair(c *gin.Context) {
+	priv, pub, err := crypto.GenerateX25519KeyPair()
+	if err != nil {
+		c.HTML(http.StatusOK, "genkey.html", gin.H{
+			"Error": fmt.Sprintf("Failed to generate key pair: %v", err),
+		})
+		return
+	}
+
+	mnemonic, _ := crypto.EncodeMnemonic(priv)
+	c.HTML(http.StatusOK, "genkey.html", gin.H{
+		"PrivateKey":     hex.EncodeToString(priv),
+		"Mnemonic":       mnemonic,
+		"PublicKey":      hex.EncodeToString(pub),
+		"KeyFingerprint": crypto.FingerprintString(pub),
 	})
 }
 
@@ -314,18 +594,75 @@ func (h *Handler) GenKeyPost(c *gin.Context) {
 
 // createEncryptor creates an encryptor based on algorithm and key
 func createEncryptor(algo string, keyHex string) (crypto.Encryptor, error) {
+	cfg := &crypto.Config{Algorithm: algo}
+
+	// age keys use their own text encoding
+	if algo == "age" || strings.HasPrefix(keyHex, "AGE-SECRET-KEY-1") {
+		cfg.Algorithm = "age"
+		cfg.Key = []byte(keyHex)
+		return crypto.NewEncryptor(cfg)
+	}
+
 	key, err := hex.DecodeString(keyHex)
 	if err != nil {
 		return nil, fmt.Errorf("invalid key format: %w", err)
 	}
+	cfg.Key = key
+	return crypto.NewEncryptor(cfg)
+}
+
+// createPassphraseEncryptor creates an encryptor that derives its key from a passphrase
+func createPassphraseEncryptor(algo string, passphrase string) (crypto.Encryptor, error) {
+	return crypto.NewEncryptor(&crypto.Config{
+		Algorithm: algo,
+		Options:   map[string]interface{}{crypto.OptionPassphrase: passphrase},
+	})
+}
+
+// createRecipientEncryptor creates an encryptor for comma-separated recipient public keys
+// age recipients (age1...) produce age-format files
+func createRecipientEncryptor(recipients string) (crypto.Encryptor, error) {
+	algo := "x25519"
+	if strings.HasPrefix(strings.TrimSpace(recipients), "age1") {
+		algo = "age"
+	}
+	return crypto.NewEncryptor(&crypto.Config{
+		Algorithm: algo,
+		Options:   map[string]interface{}{crypto.OptionRecipients: recipients},
+	})
+}
+
+// createNameCipher creates a file name cipher from a hex key or a passphrase
+// Passphrase names use the name salt stored in the repository, created on first use
+func createNameCipher(store storage.Storage, keyType, key string) (*crypto.NameCipher, error) {
+	switch keyType {
+	case "passphrase":
+		salt, err := uploader.LoadNameSalt(context.Background(), store)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.NewNameCipherWithPassphrase(key, salt)
+	case "recipients":
+		return nil, fmt.Errorf("encrypted names require a hex key or passphrase")
+	default:
+		k, err := hex.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key format: %w", err)
+		}
+		return crypto.NewNameCipher(k)
+	}
+}
 
-	switch algo {
-	case "aes":
-		return crypto.NewAESEncryptor(key)
-	case "xor":
-		return crypto.NewXOREncryptor(key)
+// createKeyedEncryptor creates an encryptor from a hex key, a passphrase or a list
+// of recipient public keys, depending on the key type selected in the form
+func createKeyedEncryptor(algo, keyType, key string) (crypto.Encryptor, error) {
+	switch keyType {
+	case "passphrase":
+		return createPassphraseEncryptor(algo, key)
+	case "recipients":
+		return createRecipientEncryptor(key)
 	default:
-		return nil, fmt.Errorf("unsupported algorithm: %s", algo)
+		return createEncryptor(algo, key)
 	}
 }
 
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"cryptobackup/pkg/crypto"
+	"cryptobackup/pkg/storage"
+	"cryptobackup/pkg/uploader"
+)
+
+// postDelete 向删除接口提交表单，返回响应
+func postDelete(h *Handler, path string, form url.Values) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/delete/*path", h.Delete)
+
+	req := httptest.NewRequest(http.MethodPost, "/delete"+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDeleteMapsPlaintextPath(t *testing.T) {
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{9}, 32)
+	enc, err := crypto.NewAESEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keyType string
+		key     string
+		names   func(storage.Storage) (*crypto.NameCipher, error)
+	}{
+		{"hex key", "hex", hex.EncodeToString(key), func(storage.Storage) (*crypto.NameCipher, error) {
+			return crypto.NewNameCipher(key)
+		}},
+		{"passphrase", "passphrase", "correct horse battery staple", func(store storage.Storage) (*crypto.NameCipher, error) {
+			salt, err := uploader.LoadNameSalt(ctx, store)
+			if err != nil {
+				return nil, err
+			}
+			return crypto.NewNameCipherWithPassphrase("correct horse battery staple", salt)
+		}},
+	}
+	for _, tt := range tests {
+		store := storage.NewMemStorage()
+		h := NewHandler(&ServerConfig{Storage: store})
+		names, err := tt.names(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ul := uploader.NewUploader(enc, store, uploader.WithEncryptedNames(names))
+		for _, p := range []string{"/payroll/q3.xlsx.enc", "/payroll/q4.xlsx.enc"} {
+			if err := ul.UploadStream(ctx, strings.NewReader(p), p, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		q3, _ := names.EncryptPath("/payroll/q3.xlsx.enc")
+		q4, _ := names.EncryptPath("/payroll/q4.xlsx.enc")
+
+		// 明文路径映射为加密名
+		form := url.Values{"key": {tt.key}, "key_type": {tt.keyType}}
+		if w := postDelete(h, "/payroll/q3.xlsx.enc", form); w.Code != http.StatusFound {
+			t.Fatalf("%s: plaintext path: status %d: %s", tt.name, w.Code, w.Body)
+		}
+		if exists, _ := store.Exists(ctx, q3); exists {
+			t.Errorf("%s: file deleted by plaintext path still exists", tt.name)
+		}
+
+		// 列表中显示的加密路径原样使用
+		if w := postDelete(h, q4, form); w.Code != http.StatusFound {
+			t.Fatalf("%s: encrypted path: status %d: %s", tt.name, w.Code, w.Body)
+		}
+		if exists, _ := store.Exists(ctx, q4); exists {
+			t.Errorf("%s: file deleted by encrypted path still exists", tt.name)
+		}
+
+		// 仓库的文件名盐不受影响
+		if tt.keyType == "passphrase" {
+			if exists, _ := store.Exists(ctx, uploader.NameSaltPath); !exists {
+				t.Errorf("%s: name salt was removed", tt.name)
+			}
+		}
+	}
+}
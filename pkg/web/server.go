@@ -1,6 +1,7 @@
 package web
 
 import (
+	"cryptobackup/pkg/storage"
 	"embed"
 	"fmt"
 	"html/template"
@@ -74,6 +75,7 @@ func setupRouter(handler *Handler) *gin.Engine {
 		protected.GET("/info/*path", handler.Info)
 		protected.GET("/genkey", handler.GenKeyPage)
 		protected.POST("/genkey", handler.GenKeyPost)
+		protected.POST("/genkey/sheet", handler.GenKeySheet)
 		protected.GET("/logout", handler.Logout)
 	}
 
@@ -88,8 +90,17 @@ func (s *Server) Start() error {
 	return s.Router.Run(addr)
 }
 
-// StartServer is a convenience function to create and start the server
+// StartServer is a convenience function to create and start the server.
+// If config.Storage is nil, config.StoragePath is opened as a storage URL.
 func StartServer(config *ServerConfig) error {
+	if config.Storage == nil {
+		store, err := storage.Open(config.StoragePath)
+		if err != nil {
+			return fmt.Errorf("failed to open storage: %w", err)
+		}
+		config.Storage = store
+	}
+
 	server := NewServer(config)
 	return server.Start()
 }